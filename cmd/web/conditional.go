@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// notModified() sets the ETag and Last-Modified validators on the response and
+// reports whether the client's copy, named by If-None-Match or
+// If-Modified-Since, is still current. If it is, a 304 has been written and the
+// caller must not write anything else. An empty etag or zero lastModified is
+// left out.
+//
+// NOTE: If-Modified-Since is only looked at when there is no If-None-Match, an
+// ETag is the more precise of the two (RFC 9110 section 13.2.2).
+func notModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	var current bool
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		current = etag != "" && etagMatches(match, etag)
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastModified.IsZero() {
+		// HTTP dates only have whole seconds.
+		current = !lastModified.Truncate(time.Second).After(since)
+	}
+
+	if !current {
+		return false
+	}
+
+	// a 304 has no body, so the headers describing one go.
+	for _, header := range []string{"Content-Type", "Content-Length", "Content-Disposition"} {
+		w.Header().Del(header)
+	}
+	w.WriteHeader(http.StatusNotModified)
+
+	return true
+}
+
+// etagMatches() reports whether an If-None-Match header lists etag, using the
+// weak comparison If-None-Match calls for: W/"x" and "x" are the same.
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hashETag() builds a strong ETag from a hash of body.
+func hashETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// weakETag() builds a weak ETag from a hash of v encoded as JSON. It is weak
+// because it fingerprints what a page is built from rather than its bytes.
+func weakETag(v any) (string, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return "W/" + hashETag(js), nil
+}
+
+// hashFS() fingerprints every file in fsys, so page ETags change when a new
+// build changes the templates or static files they are rendered with.
+func hashFS(fsys fs.FS) (string, error) {
+	h := sha256.New()
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(h, "%s\x00%d\x00", name, len(content))
+		h.Write(content)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
+
+// pageETag() is the ETag for a page rendered from data. It is "" in -dev mode,
+// where the templates can change between requests without the data changing.
+func (app *application) pageETag(data *templateData) (string, error) {
+	if app.uiVersion == "" {
+		return "", nil
+	}
+
+	return weakETag(struct {
+		UI   string
+		Data *templateData
+	}{app.uiVersion, data})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		etag   string
+		want   bool
+	}{
+		{"exact", `"abc"`, `"abc"`, true},
+		{"different", `"abc"`, `"abd"`, false},
+		{"weak header", `W/"abc"`, `"abc"`, true},
+		{"weak etag", `"abc"`, `W/"abc"`, true},
+		{"both weak", `W/"abc"`, `W/"abc"`, true},
+		{"list", `"x", "abc", "y"`, `"abc"`, true},
+		{"list without spaces", `"x","abc"`, `"abc"`, true},
+		{"list without it", `"x", "y"`, `"abc"`, false},
+		{"wildcard", `*`, `"abc"`, true},
+		{"wildcard in a list", `"x", *`, `"abc"`, true},
+		{"unquoted", `abc`, `"abc"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.header, tt.etag); got != tt.want {
+				t.Errorf("etagMatches(%q, %q) = %t, want %t", tt.header, tt.etag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 500, time.UTC)
+
+	tests := []struct {
+		name         string
+		method       string
+		header       map[string]string
+		etag         string
+		lastModified time.Time
+		want         bool
+	}{
+		{"no validators", http.MethodGet, nil, `"abc"`, modified, false},
+		{"matching etag", http.MethodGet, map[string]string{"If-None-Match": `"abc"`}, `"abc"`, modified, true},
+		{"stale etag", http.MethodGet, map[string]string{"If-None-Match": `"old"`}, `"abc"`, modified, false},
+		{"etag in a list", http.MethodGet, map[string]string{"If-None-Match": `"old", W/"abc"`}, `"abc"`, modified, true},
+		{"wildcard", http.MethodGet, map[string]string{"If-None-Match": `*`}, `"abc"`, modified, true},
+		{"no etag to match", http.MethodGet, map[string]string{"If-None-Match": `*`}, "", modified, false},
+		{"head", http.MethodHead, map[string]string{"If-None-Match": `"abc"`}, `"abc"`, modified, true},
+		{"post", http.MethodPost, map[string]string{"If-None-Match": `"abc"`}, `"abc"`, modified, false},
+		{"modified since", http.MethodGet, map[string]string{"If-Modified-Since": modified.Add(-time.Minute).Format(http.TimeFormat)}, `"abc"`, modified, false},
+		{"not modified since", http.MethodGet, map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, `"abc"`, modified, true},
+		{"bad date", http.MethodGet, map[string]string{"If-Modified-Since": "yesterday"}, `"abc"`, modified, false},
+		{"no last modified", http.MethodGet, map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, `"abc"`, time.Time{}, false},
+		{
+			"etag wins over date", http.MethodGet,
+			map[string]string{"If-None-Match": `"old"`, "If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat)},
+			`"abc"`, modified, false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			rr.Header().Set("Content-Type", "text/plain")
+
+			r := httptest.NewRequest(tt.method, "/", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+
+			got := notModified(rr, r, tt.etag, tt.lastModified)
+			if got != tt.want {
+				t.Fatalf("got %t, want %t", got, tt.want)
+			}
+
+			// the validators are always sent, so the client can use them next time.
+			if rr.Header().Get("ETag") != tt.etag {
+				t.Errorf("got ETag %q, want %q", rr.Header().Get("ETag"), tt.etag)
+			}
+			if !tt.lastModified.IsZero() && rr.Header().Get("Last-Modified") != tt.lastModified.Format(http.TimeFormat) {
+				t.Errorf("got Last-Modified %q", rr.Header().Get("Last-Modified"))
+			}
+
+			if tt.want {
+				if rr.Code != http.StatusNotModified {
+					t.Errorf("got status %d, want 304", rr.Code)
+				}
+				if rr.Header().Get("Content-Type") != "" {
+					t.Errorf("304 kept Content-Type %q", rr.Header().Get("Content-Type"))
+				}
+			} else if rr.Code != http.StatusOK || rr.Body.Len() != 0 {
+				// nothing is written, the caller sends the response.
+				t.Errorf("got status %d and %d bytes written", rr.Code, rr.Body.Len())
+			}
+		})
+	}
+}
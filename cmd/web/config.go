@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/ratelimit"
+)
+
+// envPrefix is put in front of a setting's name to get its environment
+// variable, e.g. session-lifetime is read from SNIPPETBOX_SESSION_LIFETIME.
+const envPrefix = "SNIPPETBOX_"
+
+// config holds every setting the application can be started with.
+//
+// NOTE: each setting is defined once, as a flag in newConfigFlags(), and that
+// one name is used everywhere: -session-lifetime on the command line,
+// SNIPPETBOX_SESSION_LIFETIME in the environment and "session-lifetime" in the
+// config file. Settings are applied in layers, each overriding the last:
+// defaults, then the config file, then the environment, then flags.
+type config struct {
+	Port         string // listen address, kept as "port" for backwards compatibility
+	DB           string // postgres connection string (may contain a password) or sqlite:path
+	MetricsAddr  string
+	LogFormat    string
+	DrainTimeout time.Duration
+	AutoMigrate  bool // apply pending migrations on startup
+	Dev          bool // read the ui from disk and reload templates on every request
+
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	QueryTimeout time.Duration // per database query, 0 for no limit
+
+	CacheSize int // snippets (and listing pages) kept in memory, 0 turns the cache off
+	CacheTTL  time.Duration
+
+	// requests allowed per client, for each group of routes. See rateLimit().
+	RateLimitReads  ratelimit.Limit // pages and the API, for anyone
+	RateLimitWrites ratelimit.Limit // creating and changing things, for logged in users
+	RateLimitAuth   ratelimit.Limit // signing up and logging in
+	TrustedProxies  string          // comma separated addresses and CIDR ranges allowed to set X-Forwarded-For
+
+	SessionLifetime     time.Duration
+	SessionCookieSecure bool
+
+	TLSCert         string
+	TLSKey          string
+	TLSSelfSigned   bool   // generate a throwaway certificate, for development
+	TLSRedirectAddr string // where to listen for plain HTTP and redirect it to HTTPS, empty for nowhere
+
+	Features features
+}
+
+// features are the parts of the app that can be switched off.
+type features struct {
+	Webhooks      bool
+	Notifications bool
+	LiveUpdates   bool
+}
+
+func defaultConfig() config {
+	return config{
+		Port:         ":4000",
+		MetricsAddr:  "127.0.0.1:9090",
+		LogFormat:    "text",
+		DrainTimeout: 15 * time.Second,
+
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  time.Minute,
+		QueryTimeout: 3 * time.Second,
+
+		CacheSize: 1000,
+		CacheTTL:  30 * time.Second,
+
+		RateLimitReads:  ratelimit.Limit{Burst: 300, Period: time.Minute},
+		RateLimitWrites: ratelimit.Limit{Burst: 30, Period: time.Minute},
+		RateLimitAuth:   ratelimit.Limit{Burst: 10, Period: time.Minute},
+
+		SessionLifetime:     12 * time.Hour,
+		SessionCookieSecure: true,
+
+		Features: features{
+			Webhooks:      true,
+			Notifications: true,
+			LiveUpdates:   true,
+		},
+	}
+}
+
+// secretSettings are redacted by -print-config.
+var secretSettings = map[string]bool{"db": true}
+
+// settings that only make sense on the command line, so they can't be set
+// from the config file and aren't printed.
+const (
+	configFlag      = "config"
+	printConfigFlag = "print-config"
+)
+
+// newConfigFlags() defines the flags for every setting, writing into cfg. The
+// defaults shown by -help are whatever cfg holds when this is called.
+func newConfigFlags(cfg *config) *flag.FlagSet {
+	fs := flag.NewFlagSet("snippetbox", flag.ContinueOnError)
+
+	fs.String(configFlag, "", "path to a JSON config file, unknown settings in it are an error (env "+envPrefix+"CONFIG)")
+	fs.Bool(printConfigFlag, false, "print the final config, with secrets redacted, and exit")
+
+	// we can easily change the port at runtime with the -port flag
+	fs.StringVar(&cfg.Port, "port", cfg.Port, "HTTP server address")
+
+	// we can easily change databases at runtime with the -db flag
+	fs.StringVar(&cfg.DB, "db", cfg.DB, "postgres connection string, or sqlite:path for a SQLite file")
+
+	// metrics are served on their own address, only on the loopback interface
+	// by default, so they aren't exposed publicly along with the app. An empty
+	// address turns them off.
+	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", cfg.MetricsAddr, "Prometheus metrics listen address, empty to disable")
+
+	// text logs are easier to read in a terminal, json is what log aggregators want.
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "log format, text or json")
+
+	// with several instances, whichever starts first applies the migrations and
+	// the rest wait for it, see the migrations package.
+	fs.BoolVar(&cfg.AutoMigrate, "auto-migrate", cfg.AutoMigrate, "apply pending database migrations on startup")
+
+	// the templates and static files are embedded in the binary, -dev reads
+	// them from ./ui instead so they can be edited without rebuilding.
+	fs.BoolVar(&cfg.Dev, "dev", cfg.Dev, "serve templates and static files from ./ui on disk and reload templates on every request")
+
+	// how long to wait for requests in flight (and webhook deliveries) when
+	// shutting down.
+	fs.DurationVar(&cfg.DrainTimeout, "drain-timeout", cfg.DrainTimeout, "how long to wait for in-flight requests on shutdown")
+
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", cfg.ReadTimeout, "how long a client gets to send a request")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", cfg.WriteTimeout, "how long a handler gets to write its response")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", cfg.IdleTimeout, "how long keep-alive connections are kept open between requests")
+
+	// a query that takes longer than this is cancelled and the request gets a
+	// 503, rather than it holding a connection while the handler waits.
+	fs.DurationVar(&cfg.QueryTimeout, "query-timeout", cfg.QueryTimeout, "how long a single database query may run, 0 for no limit")
+
+	// the cache is per instance, with several instances an edit takes up to
+	// cache-ttl to show up on the others.
+	fs.IntVar(&cfg.CacheSize, "cache-size", cfg.CacheSize, "how many snippets and listing pages to cache in memory, 0 to disable")
+	fs.DurationVar(&cfg.CacheTTL, "cache-ttl", cfg.CacheTTL, "how long a cached snippet or listing page is served for")
+
+	// limits are written as requests/period, e.g. 30/1m allows 30 at once and
+	// then one every two seconds.
+	fs.Var(&cfg.RateLimitReads, "rate-limit-reads", "requests per client for pages and the API, as `requests/period`, 0 to disable")
+	fs.Var(&cfg.RateLimitWrites, "rate-limit-writes", "requests per user for creating and changing things, as `requests/period`, 0 to disable")
+	fs.Var(&cfg.RateLimitAuth, "rate-limit-auth", "signup and login attempts per client, as `requests/period`, 0 to disable")
+
+	// without this X-Forwarded-For is ignored, anyone could send one.
+	fs.StringVar(&cfg.TrustedProxies, "trusted-proxies", cfg.TrustedProxies, "comma separated proxy addresses or CIDR ranges whose X-Forwarded-For header is trusted")
+
+	fs.DurationVar(&cfg.SessionLifetime, "session-lifetime", cfg.SessionLifetime, "how long a login lasts")
+	fs.BoolVar(&cfg.SessionCookieSecure, "session-cookie-secure", cfg.SessionCookieSecure, "only send the session cookie over HTTPS")
+
+	fs.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "path to the TLS certificate")
+	fs.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "path to the TLS private key")
+	fs.BoolVar(&cfg.TLSSelfSigned, "tls-self-signed", cfg.TLSSelfSigned, "serve HTTPS with a self-signed certificate generated on startup (development only)")
+	fs.StringVar(&cfg.TLSRedirectAddr, "tls-redirect-addr", cfg.TLSRedirectAddr, "plain HTTP address that redirects to HTTPS, empty to disable")
+
+	fs.BoolVar(&cfg.Features.Webhooks, "webhooks", cfg.Features.Webhooks, "enable webhooks")
+	fs.BoolVar(&cfg.Features.Notifications, "notifications", cfg.Features.Notifications, "enable in-app notifications")
+	fs.BoolVar(&cfg.Features.LiveUpdates, "live-updates", cfg.Features.LiveUpdates, "enable the live updates stream")
+
+	return fs
+}
+
+// loadConfig() builds the config from the defaults, the config file, the
+// environment and the command line args, in that order. It returns true if
+// -print-config was given.
+func loadConfig(args []string, stderr io.Writer) (*config, bool, error) {
+	cfg := defaultConfig()
+
+	fs := newConfigFlags(&cfg)
+	fs.SetOutput(stderr)
+
+	// parse the flags first, to find the config file and -print-config. The
+	// values they wrote into cfg are thrown away and applied again at the end,
+	// so they override the file and the environment.
+	if err := fs.Parse(args); err != nil {
+		return nil, false, err
+	}
+
+	if fs.NArg() > 0 {
+		return nil, false, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	flags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+
+	cfg = defaultConfig()
+
+	path, ok := flags[configFlag]
+	if !ok {
+		path = os.Getenv(envPrefix + "CONFIG")
+	}
+
+	if path != "" {
+		if err := loadConfigFile(fs, path); err != nil {
+			return nil, false, err
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == configFlag || f.Name == printConfigFlag || err != nil {
+			return
+		}
+
+		env := envName(f.Name)
+		if value, ok := os.LookupEnv(env); ok {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("environment variable %s: invalid value %q: %w", env, value, setErr)
+			}
+		}
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	for name, value := range flags {
+		if err := fs.Set(name, value); err != nil {
+			return nil, false, fmt.Errorf("flag -%s: %w", name, err)
+		}
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, false, err
+	}
+
+	return &cfg, fs.Lookup(printConfigFlag).Value.String() == "true", nil
+}
+
+// loadConfigFile() applies the settings in a JSON config file. The file is a
+// single object keyed by setting name, e.g.
+//
+//	{"port": ":443", "session-lifetime": "24h", "webhooks": false}
+//
+// JSON is the only format. Anything that isn't one object of strings, numbers
+// and booleans, and any setting we don't know, is an error, so a typo stops
+// the server starting instead of being quietly ignored.
+func loadConfigFile(fs *flag.FlagSet, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer f.Close()
+
+	var settings map[string]any
+
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+
+	if err := dec.Decode(&settings); err != nil {
+		return fmt.Errorf("config file %s: must be a JSON object: %w", path, err)
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("config file %s: unexpected data after the JSON object", path)
+	}
+
+	for name, value := range settings {
+		if fs.Lookup(name) == nil || name == configFlag || name == printConfigFlag {
+			return fmt.Errorf("config file %s: unknown setting %q", path, name)
+		}
+
+		switch value.(type) {
+		case string, json.Number, bool:
+		default:
+			return fmt.Errorf("config file %s: %q must be a string, number or boolean", path, name)
+		}
+
+		if err := fs.Set(name, fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("config file %s: invalid value %v for %q: %w", path, value, name, err)
+		}
+	}
+
+	return nil
+}
+
+// envName() returns the environment variable for a setting.
+func envName(setting string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(setting, "-", "_"))
+}
+
+// validate() checks the settings make sense together, returning every problem
+// found rather than just the first.
+func (cfg *config) validate() error {
+	var errs []error
+
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(cfg.Port != "", "port: must not be empty")
+	check(cfg.DB != "", "db: a postgres connection string or sqlite:path is required (-db, %s or \"db\" in the config file)", envName("db"))
+	check(cfg.LogFormat == "text" || cfg.LogFormat == "json", "log-format: must be text or json, not %q", cfg.LogFormat)
+	check(cfg.DrainTimeout > 0, "drain-timeout: must be positive")
+	check(cfg.ReadTimeout > 0, "read-timeout: must be positive")
+	check(cfg.WriteTimeout > 0, "write-timeout: must be positive")
+	check(cfg.IdleTimeout > 0, "idle-timeout: must be positive")
+	check(cfg.QueryTimeout >= 0, "query-timeout: must not be negative")
+	check(cfg.CacheSize >= 0, "cache-size: must not be negative")
+	check(cfg.CacheSize == 0 || cfg.CacheTTL > 0, "cache-ttl: must be positive")
+	_, err := parseTrustedProxies(cfg.TrustedProxies)
+	check(err == nil, "trusted-proxies: %v", err)
+	check(cfg.SessionLifetime > 0, "session-lifetime: must be positive")
+	check((cfg.TLSCert == "") == (cfg.TLSKey == ""), "tls-cert and tls-key: set both or neither")
+	check(!(cfg.TLSSelfSigned && cfg.TLSCert != ""), "tls-self-signed: can't be used with tls-cert and tls-key")
+
+	if cfg.TLSRedirectAddr != "" {
+		check(cfg.tlsEnabled(), "tls-redirect-addr: needs HTTPS, set tls-cert and tls-key or tls-self-signed")
+		check(cfg.TLSRedirectAddr != cfg.Port, "tls-redirect-addr: must be different from port")
+	}
+
+	if cfg.MetricsAddr != "" {
+		check(cfg.MetricsAddr != cfg.Port, "metrics-addr: must be different from port")
+	}
+
+	return errors.Join(errs...)
+}
+
+// tlsEnabled() reports whether the server should serve HTTPS.
+func (cfg *config) tlsEnabled() bool {
+	return cfg.TLSCert != "" || cfg.TLSSelfSigned
+}
+
+// printConfig() writes the config as a JSON config file, with secrets
+// redacted, so it shows exactly what the app would run with.
+func printConfig(w io.Writer, cfg *config) error {
+	fs := newConfigFlags(cfg)
+
+	settings := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == configFlag || f.Name == printConfigFlag {
+			return
+		}
+
+		value := f.Value.String()
+		if secretSettings[f.Name] {
+			value = redactDSN(value)
+		}
+		settings[f.Name] = value
+	})
+
+	// encoding/json sorts the keys, so the output is stable.
+	js, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(js))
+	return err
+}
+
+var dsnPassword = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// redactDSN() hides the password in a postgres connection string, in either
+// the URL or the key=value form.
+func redactDSN(dsn string) string {
+	if dsn == "" {
+		return ""
+	}
+
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "REDACTED")
+		}
+
+		query := u.Query()
+		if query.Has("password") {
+			query.Set("password", "REDACTED")
+			u.RawQuery = query.Encode()
+		}
+
+		return u.String()
+	}
+
+	return dsnPassword.ReplaceAllString(dsn, "${1}REDACTED")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile() writes content to a config file and returns its path.
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "snippetbox.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, _, err := loadConfig([]string{"-db", "sqlite:test.db"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// metrics stay off the public interfaces unless asked for.
+	if cfg.MetricsAddr != "127.0.0.1:9090" {
+		t.Errorf("got metrics-addr %q, want 127.0.0.1:9090", cfg.MetricsAddr)
+	}
+	if cfg.Port != ":4000" {
+		t.Errorf("got port %q, want :4000", cfg.Port)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `{"db": "sqlite:file.db", "port": ":5000", "session-lifetime": "24h", "cache-size": 10, "webhooks": false}`)
+
+	t.Setenv(envName("port"), ":6000")
+
+	cfg, _, err := loadConfig([]string{"-config", path, "-cache-size", "20"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.DB != "sqlite:file.db" || cfg.SessionLifetime != 24*time.Hour || cfg.Features.Webhooks {
+		t.Errorf("settings from the file weren't applied: %+v", cfg)
+	}
+	if cfg.Port != ":6000" {
+		t.Errorf("got port %q, want the environment's :6000", cfg.Port)
+	}
+	if cfg.CacheSize != 20 {
+		t.Errorf("got cache-size %d, want the flag's 20", cfg.CacheSize)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"unknown setting", `{"db": "sqlite:test.db", "sesion-lifetime": "24h"}`, `unknown setting "sesion-lifetime"`},
+		{"config in the config", `{"config": "other.json"}`, `unknown setting "config"`},
+		{"not json", "port: \":443\"\n", "must be a JSON object"},
+		{"not an object", `[":443"]`, "must be a JSON object"},
+		{"trailing data", `{"port": ":443"} {"port": ":80"}`, "unexpected data after the JSON object"},
+		{"nested value", `{"port": {"addr": ":443"}}`, `"port" must be a string, number or boolean`},
+		{"null value", `{"port": null}`, `"port" must be a string, number or boolean`},
+		{"invalid value", `{"session-lifetime": "a day"}`, `invalid value a day for "session-lifetime"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, tt.content)
+
+			_, _, err := loadConfig([]string{"-config", path, "-db", "sqlite:test.db"}, io.Discard)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// contextKey is the type of the keys we store in a request context, so they
+// can't collide with keys set by other packages.
+type contextKey string
+
+const (
+	requestIDContextKey   = contextKey("requestID")
+	requestInfoContextKey = contextKey("requestInfo")
+)
+
+// requestInfo collects what the access log line and the request metrics need
+// to know from further down the chain. logRequest() puts one in the context,
+// and it is filled in as the request is handled.
+type requestInfo struct {
+	route  string // the pattern of the matched route, empty if none matched
+	userID int
+}
+
+// labelRoute() records the route pattern a handler was registered under on the
+// requestInfo, since httprouter doesn't tell us which route matched.
+func labelRoute(pattern string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok {
+			info.route = pattern
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestID() returns the ID assignRequestID() middleware assigned to the request.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// requestLogger() returns the application logger with the request ID attached,
+// use it for anything logged while handling a request.
+func (app *application) requestLogger(r *http.Request) *slog.Logger {
+	if id := requestID(r); id != "" {
+		return app.logger.With("request_id", id)
+	}
+	return app.logger
+}
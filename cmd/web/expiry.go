@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+	"github.com/corbinlazarone/snippetbox/internal/webhook"
+	"github.com/corbinlazarone/snippetbox/internal/worker"
+)
+
+// expiryWatcher periodically looks for snippets that have expired and sends the
+// snippet.expired webhook event for each of them. Snippets don't "do" anything
+// when they expire, they just stop being returned by queries, so this is the
+// only place that notices.
+type expiryWatcher struct {
+	snippets models.SnippetModelInterface
+	webhooks *webhook.Dispatcher
+	logger   *slog.Logger
+	interval time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newExpiryWatcher(snippets models.SnippetModelInterface, webhooks *webhook.Dispatcher, logger *slog.Logger, interval time.Duration) *expiryWatcher {
+	return &expiryWatcher{
+		snippets: snippets,
+		webhooks: webhooks,
+		logger:   logger,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Run() checks for expired snippets every interval until Stop() is called. It is
+// meant to be started in its own goroutine.
+func (e *expiryWatcher) Run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.check()
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// Stop() stops the watcher and waits for a check in progress to finish.
+func (e *expiryWatcher) Stop() {
+	close(e.stop)
+	<-e.done
+}
+
+func (e *expiryWatcher) check() {
+	defer worker.Recover(e.logger, "expiry watcher")
+
+	expired, err := e.snippets.MarkExpired(context.Background())
+	if err != nil {
+		e.logger.Error("finding expired snippets", "error", err)
+		return
+	}
+
+	for _, snippet := range expired {
+		e.webhooks.Publish(snippet.UserID, models.EventSnippetExpired, snippet)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+// maxArchiveSnippets caps how many snippets can be bundled into one archive so
+// a single request can't make us build an arbitrarily large file in memory.
+const maxArchiveSnippets = 50
+
+// archive formats supported by the archive endpoints, keyed by the value of the
+// ?format= query parameter.
+var archiveFormats = map[string]struct {
+	contentType string
+	extension   string
+	write       func(snippets []models.Snippet) (*bytes.Buffer, error)
+}{
+	"zip":    {"application/zip", ".zip", writeZipArchive},
+	"tar.gz": {"application/gzip", ".tar.gz", writeTarGzArchive},
+}
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// snippetFilename builds a file name for a snippet from its id and title,
+// e.g. "3-first-autumn-morning.txt". Markdown snippets get a ".md" extension.
+func snippetFilename(snippet *models.Snippet) string {
+	extension := ".txt"
+	if snippet.ContentType == models.ContentTypeMarkdown {
+		extension = ".md"
+	}
+
+	slug := strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(snippet.Title), "-"), "-")
+	if slug == "" {
+		return fmt.Sprintf("%d%s", snippet.ID, extension)
+	}
+
+	return fmt.Sprintf("%d-%s%s", snippet.ID, slug, extension)
+}
+
+// setSnippetCacheHeaders lets clients and proxies keep a snippet response, but
+// makes them check back with the ETag before every use.
+//
+// NOTE: there is no max-age. A snippet can be edited, deleted or expire at any
+// time, and a cached copy must not keep serving it after that.
+func setSnippetCacheHeaders(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "public, no-cache")
+}
+
+// snippetETag returns the ETag for a snippet's raw content. The content only
+// changes when the snippet is edited, which always makes a new revision.
+func snippetETag(snippet *models.Snippet) string {
+	return fmt.Sprintf(`"%d-%d"`, snippet.ID, snippet.Revision)
+}
+
+// archiveETag returns the ETag for an archive of snippets in the given format.
+func archiveETag(format string, snippets []models.Snippet) string {
+	key := []byte(format)
+	for _, snippet := range snippets {
+		key = fmt.Appendf(key, "/%d-%d", snippet.ID, snippet.Revision)
+	}
+
+	return hashETag(key)
+}
+
+// lastUpdated returns the latest update time across a set of snippets, which
+// is when an archive of them last changed.
+func lastUpdated(snippets []models.Snippet) (lastModified time.Time) {
+	for _, snippet := range snippets {
+		if snippet.Updated.After(lastModified) {
+			lastModified = snippet.Updated
+		}
+	}
+
+	return lastModified
+}
+
+// writeZipArchive writes each snippet as its own file into a zip archive.
+func writeZipArchive(snippets []models.Snippet) (*bytes.Buffer, error) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+
+	for i := range snippets {
+		f, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     snippetFilename(&snippets[i]),
+			Method:   zip.Deflate,
+			Modified: snippets[i].Updated,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = f.Write([]byte(snippets[i].Content)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// writeTarGzArchive writes each snippet as its own file into a gzipped tarball.
+func writeTarGzArchive(snippets []models.Snippet) (*bytes.Buffer, error) {
+	buf := new(bytes.Buffer)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+
+	for i := range snippets {
+		content := snippets[i].Content
+
+		err := tw.WriteHeader(&tar.Header{
+			Name:    snippetFilename(&snippets[i]),
+			Mode:    0644,
+			Size:    int64(len(content)),
+			ModTime: snippets[i].Updated,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = tw.Write([]byte(content)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/corbinlazarone/snippetbox/internal/markdown"
 	"github.com/corbinlazarone/snippetbox/internal/models"
 	"github.com/corbinlazarone/snippetbox/internal/validator"
+	"github.com/corbinlazarone/snippetbox/internal/webhook"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -22,10 +28,57 @@ import (
 type snippetCreateForm struct {
 	Title               string     `form:"title"`
 	Content             string     `form:"content"`
+	ContentType         string     `form:"content_type"`
 	Expires             int        `form:"expires"`
 	validator.Validator `form:"-"` // tells the from decoder to ignore this field
 }
 
+// commentForm holds a new or edited comment. ParentID is only used when
+// replying to another comment.
+type commentForm struct {
+	Body                string `form:"body"`
+	ParentID            int    `form:"parent_id"`
+	Line                int    `form:"line"`
+	Revision            int    `form:"revision"`
+	validator.Validator `form:"-"`
+}
+
+// maximum length of a comment, in characters.
+const maxCommentChars = 5000
+
+// validate() runs the checks shared by creating and editing a comment.
+func (f *commentForm) validate() {
+	f.CheckField(validator.NotBlank(f.Body), "body", "This field cannot be blank")
+	f.CheckField(validator.MaxChars(f.Body, maxCommentChars), "body", fmt.Sprintf("This field cannot be more than %d characters long", maxCommentChars))
+}
+
+type webhookForm struct {
+	URL                 string   `form:"url"`
+	Events              []string `form:"events"`
+	validator.Validator `form:"-"`
+}
+
+// how many delivery attempts the delivery log page shows.
+const webhookDeliveryLogSize = 100
+
+// statsDays is how many days of daily views the stats page shows.
+const statsDays = 30
+
+type notificationPreferencesForm struct {
+	Kinds               []string `form:"kinds"` // the kinds of notification to switch on
+	validator.Validator `form:"-"`
+}
+
+// how many notifications the notifications page shows.
+const notificationPageSize = 50
+
+type snippetEditForm struct {
+	Title               string `form:"title"`
+	Content             string `form:"content"`
+	ContentType         string `form:"content_type"`
+	validator.Validator `form:"-"`
+}
+
 type userSignUpForm struct {
 	Name                string     `form:"name"`
 	Email               string     `form:"email"`
@@ -33,121 +86,1141 @@ type userSignUpForm struct {
 	validator.Validator `form:"-"` // tells the from decoder to ignore this field
 }
 
-type userLoginForm struct {
-	Email               string `form:"email"`
-	Password            string `form:"password"`
-	validator.Validator `form:"-"`
+type userLoginForm struct {
+	Email               string `form:"email"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) home(w http.ResponseWriter, r *http.Request) {
+	params, ok := app.readListParams(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := app.snippets.List(r.Context(), params.Sort, params.Limit, params.Cursor)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			app.clientError(w, http.StatusBadRequest)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	mostStarred, err := app.stars.MostStarredThisWeek(r.Context(), 5)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// use our templateData holding struct
+	data := app.newTemplateData(r)
+	data.Snippets = &page.Snippets
+	data.Page = page
+	data.Listing = params
+	data.MostStarred = mostStarred
+
+	// use render helper function to render our template page
+	app.render(w, r, "home.tmpl.html", data, http.StatusOK)
+}
+
+// renders the html for our snippet create form
+func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+
+	// Initialize a new createSnippetForm instance and pass it to the template.
+	// Notice how this is also a great opportunity to set any default or
+	// 'initial' values for the form --- here we set the initial value for the
+	// snippet expiry to 365 days.
+	data.Form = snippetCreateForm{
+		ContentType: models.ContentTypeText,
+		Expires:     365,
+	}
+
+	app.render(w, r, "create.tmpl.html", data, http.StatusOK)
+}
+
+// creates the submitted snippet to the database
+func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form snippetCreateForm
+
+	// we pass a pointer to our form to the Decoder and the request and
+	// it will fill out our struct that holds the form values with the values
+	// from the HTML form.
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Check that the title field is not blank.
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+
+	// Check the the title field is not more than 100 characters long.
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+
+	// Check that the content value isn't blank
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+
+	// Check that the content type is one we know how to display.
+	form.CheckField(validator.PermittedString(form.ContentType, models.ContentTypeText, models.ContentTypeMarkdown), "content_type", "This field must equal text or markdown")
+
+	// Check that the expires value matches one of our permitted values (1, 7 or
+	// 365).
+	form.CheckField(validator.PermittedInt(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+
+	// If any errors in our map than re render the create.tmpl.html page
+	// with a 422 status code error.
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, "create.tmpl.html", data, http.StatusUnprocessableEntity)
+		return
+	}
+
+	id, err := app.snippets.Insert(r.Context(), app.authenticatedUserID(r), form.Title, form.Content, form.ContentType, form.Expires)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	app.metrics.snippetsCreated.Inc()
+	app.publishSnippetEvent(r, models.EventSnippetCreated, id)
+
+	// Use the Put() method to add a string value and the corresponding key to
+	// session data.
+	app.sessionManager.Put(r.Context(), "flash", "Snippet created successfully created!")
+
+	// redirect the user to the relvant snippet id page
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
+	// when httprouter is parsing a request, the values of any named parameters
+	// will be stored in the request context. We can use the ParamsFromContext()
+	// function to retrive the slice containing these parameter names and values.
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 { // convert id to int and makes sure its greater than 1
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	// ?rev= shows an older revision of the snippet, along with the line comments
+	// that were written against it.
+	latestRevision := snippet.Revision
+	if rev := r.URL.Query().Get("rev"); rev != "" {
+		revision, err := strconv.Atoi(rev)
+		if err != nil || revision < 1 {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+
+		if revision != snippet.Revision {
+			snippet, err = app.snippets.GetRevision(r.Context(), id, revision)
+			if err != nil {
+				app.modelError(w, r, err)
+				return
+			}
+		}
+	}
+
+	// count the view. This only touches the in-memory buffer, the count is
+	// written to the database in batches by the view counter.
+	app.viewCounter.Record(snippet.ID, r.Referer())
+
+	data, err := app.snippetViewData(r, snippet, latestRevision)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// snippetViewData() adds the buffered views, so this is the up to date count.
+	app.live.Publish(liveViews, liveCount{ID: snippet.ID, Count: data.Snippet.Views})
+
+	// ?line= opens the comment box under that line.
+	form := commentForm{}
+	if line, err := strconv.Atoi(r.URL.Query().Get("line")); err == nil && line > 0 {
+		form.Line = line
+		form.Revision = snippet.Revision
+	}
+	data.Form = form
+
+	// NOTE: the view count is left out of the ETag, it goes up on every view so
+	// the page would never match. The page keeps its count current over
+	// /events instead. The view above is still counted on a 304, no-cache makes
+	// the browser come back here every time.
+	//
+	// There is no Last-Modified, stars and comments change the page without
+	// changing the snippet.
+	if data.IsAuthenticated {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, no-cache")
+	}
+
+	// the flash was popped from the session building data, so a page with one
+	// always has to be sent in full or it is never seen. It gets no ETag
+	// either, the flash is only meant to be shown once.
+	if data.Flash == "" {
+		fingerprint, counted := *data, *data.Snippet
+		counted.Views = 0
+		fingerprint.Snippet = &counted
+
+		etag, err := app.pageETag(&fingerprint)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if notModified(w, r, etag, time.Time{}) {
+			return
+		}
+	}
+
+	app.render(w, r, "view.tmpl.html", data, http.StatusOK)
+}
+
+// snippetEdit() renders the edit form for a snippet. Only the owner can edit it.
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.snippetForOwner(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetEditForm{
+		Title:       snippet.Title,
+		Content:     snippet.Content,
+		ContentType: snippet.ContentType,
+	}
+
+	app.render(w, r, "edit.tmpl.html", data, http.StatusOK)
+}
+
+// snippetEditPost() saves an edit as a new revision of the snippet.
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.snippetForOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetEditForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(validator.PermittedString(form.ContentType, models.ContentTypeText, models.ContentTypeMarkdown), "content_type", "This field must equal text or markdown")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, r, "edit.tmpl.html", data, http.StatusUnprocessableEntity)
+		return
+	}
+
+	_, err = app.snippets.Update(r.Context(), snippet.ID, form.Title, form.Content, form.ContentType)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	app.publishSnippetEvent(r, models.EventSnippetUpdated, snippet.ID)
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet updated successfully!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// snippetDeletePost() deletes a snippet. Only the owner can delete it.
+func (app *application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.snippetForOwner(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := app.snippets.Delete(r.Context(), snippet.ID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	app.viewCounter.Forget(snippet.ID)
+
+	if app.config.Features.Webhooks {
+		app.webhooks.Publish(deleted.UserID, models.EventSnippetDeleted, deleted)
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet deleted.")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// snippetForOwner() looks up the snippet in the :id route parameter and checks
+// it belongs to the logged in user, writing the error response itself and
+// returning false if not.
+func (app *application) snippetForOwner(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return nil, false
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return nil, false
+	}
+
+	if snippet.UserID == 0 || snippet.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// codeLine is a single line of a text snippet on the view page, along with the
+// comment threads attached to it.
+type codeLine struct {
+	Number  int
+	Text    string
+	Threads []models.Comment
+}
+
+// snippetViewData() gathers everything the snippet view page shows alongside the
+// snippet itself. It is shared with the handlers that re-display the page, e.g.
+// when a comment fails validation. snippet may be an older revision, in which
+// case latestRevision is the snippet's current one.
+func (app *application) snippetViewData(r *http.Request, snippet *models.Snippet, latestRevision int) (*templateData, error) {
+	var err error
+
+	// add on the views that are still buffered so the count on the page
+	// doesn't lag behind.
+	snippet.Views += app.viewCounter.Pending(snippet.ID)
+
+	// use our templateData holding struct
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.LatestRevision = latestRevision
+
+	if snippet.Revision > 1 {
+		data.PrevRevision = snippet.Revision - 1
+	}
+	if snippet.Revision < latestRevision {
+		data.NextRevision = snippet.Revision + 1
+	}
+
+	data.StarCount, err = app.stars.Count(r.Context(), snippet.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.IsAuthenticated {
+		data.IsStarred, err = app.stars.IsStarred(r.Context(), data.AuthenticatedUserID, snippet.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	comments, err := app.comments.ForSnippet(r.Context(), snippet.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// markdown snippets are rendered (and sanitised) into HTML, everything
+	// else is shown line by line so comments can be attached to a line.
+	if snippet.ContentType == models.ContentTypeMarkdown {
+		data.SnippetHTML, err = markdown.Render(snippet.Content)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for i, text := range strings.Split(snippet.Content, "\n") {
+			data.Lines = append(data.Lines, codeLine{Number: i + 1, Text: text})
+		}
+	}
+
+	// line comments only line up with the revision they were written on. The
+	// ones on other revisions are listed separately with a link to their
+	// revision, instead of being shown next to what is now a different line.
+	for _, comment := range comments {
+		switch {
+		case comment.Line == 0:
+			data.Comments = append(data.Comments, comment)
+		case comment.Revision == snippet.Revision && comment.Line <= len(data.Lines):
+			data.Lines[comment.Line-1].Threads = append(data.Lines[comment.Line-1].Threads, comment)
+		default:
+			data.OtherRevisionComments = append(data.OtherRevisionComments, comment)
+		}
+	}
+
+	return data, nil
+}
+
+// commentCreatePost() adds a comment, or a reply when parent_id is set, to the
+// snippet in the :id route parameter. Setting line and revision attaches a new
+// comment to that line of that revision of the snippet.
+func (app *application) commentCreatePost(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	var form commentForm
+
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	latestRevision := snippet.Revision
+
+	// a line comment has to point at a real line of a real revision of a text
+	// snippet. Replies take their line from the comment they reply to.
+	if form.Line != 0 && form.ParentID == 0 {
+		if form.Revision != snippet.Revision {
+			snippet, err = app.snippets.GetRevision(r.Context(), id, form.Revision)
+			if err != nil {
+				if errors.Is(err, models.ErrNoRecord) {
+					app.clientError(w, http.StatusBadRequest)
+				} else {
+					app.serverError(w, r, err)
+				}
+				return
+			}
+		}
+
+		lines := strings.Count(snippet.Content, "\n") + 1
+		if snippet.ContentType != models.ContentTypeText || form.Line < 1 || form.Line > lines {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	} else {
+		form.Line, form.Revision = 0, 0
+	}
+
+	form.validate()
+
+	// re-display the snippet page with the errors next to the comment box.
+	if !form.Valid() {
+		data, err := app.snippetViewData(r, snippet, latestRevision)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data.Form = form
+		app.render(w, r, "view.tmpl.html", data, http.StatusUnprocessableEntity)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	commentID, err := app.comments.Insert(r.Context(), snippet.ID, userID, form.ParentID, form.Line, form.Revision, form.Body)
+	if err != nil {
+		// the comment being replied to doesn't exist (or is on another snippet).
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusBadRequest)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if app.config.Features.Notifications {
+		app.notifier.Notify(models.NotifyComment, userID, snippet.ID, commentID)
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d?rev=%d#comment-%d", snippet.ID, snippet.Revision, commentID), http.StatusSeeOther)
+}
+
+// commentEdit() renders the form for editing a comment. Only the author of a
+// comment can edit it.
+func (app *application) commentEdit(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.commentForAuthor(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Comment = comment
+	data.Form = commentForm{Body: comment.Body}
+
+	app.render(w, r, "comment_edit.tmpl.html", data, http.StatusOK)
+}
+
+// commentEditPost() saves the edited comment.
+func (app *application) commentEditPost(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.commentForAuthor(w, r)
+	if !ok {
+		return
+	}
+
+	var form commentForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Comment = comment
+		data.Form = form
+		app.render(w, r, "comment_edit.tmpl.html", data, http.StatusUnprocessableEntity)
+		return
+	}
+
+	err = app.comments.Update(r.Context(), comment.ID, form.Body)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d#comment-%d", comment.SnippetID, comment.ID), http.StatusSeeOther)
+}
+
+// commentDeletePost() deletes a comment. Authors can delete their own comments
+// and the owner of a snippet can delete any comment on it.
+func (app *application) commentDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	comment, err := app.comments.Get(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	if comment.UserID != userID {
+		snippet, err := app.snippets.Get(r.Context(), comment.SnippetID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if snippet == nil || snippet.UserID != userID {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+	}
+
+	err = app.comments.Delete(r.Context(), comment.ID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Comment deleted.")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", comment.SnippetID), http.StatusSeeOther)
+}
+
+// commentForAuthor() looks up the comment in the :id route parameter and checks
+// it belongs to the logged in user, writing the error response itself and
+// returning false if not.
+func (app *application) commentForAuthor(w http.ResponseWriter, r *http.Request) (*models.Comment, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return nil, false
+	}
+
+	comment, err := app.comments.Get(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return nil, false
+	}
+
+	if comment.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return nil, false
+	}
+
+	return comment, true
+}
+
+// snippetStats() shows the owner of a snippet its daily views over the last
+// month and where its visitors came from.
+func (app *application) snippetStats(w http.ResponseWriter, r *http.Request) {
+	// only the owner gets to see the analytics.
+	snippet, ok := app.snippetForOwner(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := app.views.Stats(r.Context(), snippet.ID, statsDays)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	snippet.Views += app.viewCounter.Pending(snippet.ID)
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Stats = stats
+
+	app.render(w, r, "stats.tmpl.html", data, http.StatusOK)
+}
+
+// snippetStarPost() stars a snippet for the logged in user. Starring an already
+// starred snippet is a no-op, so the request is safe to repeat.
+func (app *application) snippetStarPost(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	_, err = app.snippets.Get(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	added, err := app.stars.Star(r.Context(), userID, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// only a new star is news, starring the same snippet again isn't.
+	if added {
+		if app.config.Features.Notifications {
+			app.notifier.Notify(models.NotifyStar, userID, id, 0)
+		}
+		app.publishStarCount(r, id)
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+// snippetUnstarPost() removes the logged in user's star from a snippet. Like
+// starring, unstarring twice is a no-op.
+func (app *application) snippetUnstarPost(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	removed, err := app.stars.Unstar(r.Context(), app.authenticatedUserID(r), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if removed {
+		app.publishStarCount(r, id)
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
 }
 
-func (app *application) home(w http.ResponseWriter, r *http.Request) {
-	snippets, err := app.snippets.Latest()
+// accountStarred() lists the snippets the logged in user has starred.
+func (app *application) accountStarred(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.stars.Starred(r.Context(), app.authenticatedUserID(r))
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
-	// use our templateData holding struct
 	data := app.newTemplateData(r)
 	data.Snippets = &snippets
 
-	// use render helper function to render our template page
-	app.render(w, "home.tmpl.html", data, http.StatusOK)
+	app.render(w, r, "starred.tmpl.html", data, http.StatusOK)
 }
 
-// renders the html for our snippet create form
-func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
+// liveEvents() streams new snippets and view/star count changes as Server-Sent
+// Events until the client goes away or the server shuts down.
+func (app *application) liveEvents(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
 
-	// Initialize a new createSnippetForm instance and pass it to the template.
-	// Notice how this is also a great opportunity to set any default or
-	// 'initial' values for the form --- here we set the initial value for the
-	// snippet expiry to 365 days.
-	data.Form = snippetCreateForm{
-		Expires: 365,
+	// NOTE: the server's WriteTimeout is a deadline for the whole response, so
+	// it would cut the stream off after a few seconds. Clearing the deadline
+	// only affects this response.
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	sub := app.live.Subscribe()
+	defer app.live.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // stop nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+
+	// tell the browser how long to wait before reconnecting if we go away.
+	fmt.Fprint(w, "retry: 5000\n\n")
+
+	heartbeat := time.NewTicker(liveHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case msg, ok := <-sub.Messages():
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Event, msg.Data)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// snippetRaw() writes the snippet content back as plain text so it can be piped
+// straight into a shell, e.g. curl .../snippet/raw/1 | sh
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.snippetForExport(w, r)
+	if !ok {
+		return
+	}
+
+	setSnippetCacheHeaders(w)
+	if notModified(w, r, snippetETag(snippet), snippet.Updated) {
+		return
 	}
 
-	app.render(w, "create.tmpl.html", data, http.StatusOK)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(snippet.Content))
 }
 
-// creates the submitted snippet to the database
-func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
-	var form snippetCreateForm
+// snippetDownload() is the same as snippetRaw() but asks the browser to save the
+// content as a file instead of displaying it.
+func (app *application) snippetDownload(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.snippetForExport(w, r)
+	if !ok {
+		return
+	}
 
-	// we pass a pointer to our form to the Decoder and the request and
-	// it will fill out our struct that holds the form values with the values
-	// from the HTML form.
-	err := app.decodePostForm(r, &form)
-	if err != nil {
+	setSnippetCacheHeaders(w)
+	if notModified(w, r, snippetETag(snippet), snippet.Updated) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": snippetFilename(snippet)}))
+	w.Write([]byte(snippet.Content))
+}
+
+// snippetArchive() bundles one or more snippets into a zip or tar.gz archive.
+// A single snippet is selected with the :id route parameter, and a collection
+// with repeated ?id= query parameters on /snippet/archive.
+func (app *application) snippetArchive(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "zip"
+	}
+
+	archiveFormat, ok := archiveFormats[format]
+	if !ok {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	// Check that the title field is not blank.
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	var ids []int
+	if id, err := app.readIDParam(r); err == nil {
+		ids = append(ids, id)
+	} else {
+		for _, value := range r.URL.Query()["id"] {
+			id, err := strconv.Atoi(value)
+			if err != nil || id < 1 {
+				app.clientError(w, http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, id)
+		}
+	}
 
-	// Check the the title field is not more than 100 characters long.
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	if len(ids) == 0 || len(ids) > maxArchiveSnippets {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
 
-	// Check that the content value isn't blank
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	// expired snippets are left out by GetMany(), so if none are left there is
+	// nothing to archive.
+	snippets, err := app.snippets.GetMany(r.Context(), ids)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
 
-	// Check that the expires value matches one of our permitted values (1, 7 or
-	// 365).
-	form.CheckField(validator.PermittedInt(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	if len(snippets) == 0 {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	// there is no need to build the archive if the client already has it.
+	setSnippetCacheHeaders(w)
+	if notModified(w, r, archiveETag(format, snippets), lastUpdated(snippets)) {
+		return
+	}
+
+	buf, err := archiveFormat.write(snippets)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	filename := "snippets" + archiveFormat.extension
+	if len(snippets) == 1 {
+		filename = fmt.Sprintf("snippet-%d%s", snippets[0].ID, archiveFormat.extension)
+	}
+
+	w.Header().Set("Content-Type", archiveFormat.contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	buf.WriteTo(w)
+}
+
+// apiSnippetList() is the JSON version of the home listing. It takes the same
+// sort, limit and cursor query parameters and hands back the cursors for the
+// pages either side.
+func (app *application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	params, ok := app.readListParams(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := app.snippets.List(r.Context(), params.Sort, params.Limit, params.Cursor)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			app.clientError(w, http.StatusBadRequest)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	js, err := json.Marshal(map[string]any{
+		"snippets":    page.Snippets,
+		"next_cursor": page.NextCursor,
+		"prev_cursor": page.PrevCursor,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// the listing is the same for everyone but changes all the time (new
+	// snippets, expiry, view counts), so caches have to check it on every use.
+	// A listing has no single modification time, so it only gets an ETag.
+	w.Header().Set("Cache-Control", "public, no-cache")
+	if notModified(w, r, hashETag(js), time.Time{}) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
+// snippetForExport() looks up the snippet for the raw and download endpoints,
+// writing the error response itself and returning false if there isn't one.
+func (app *application) snippetForExport(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return nil, false
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// accountWebhooks() lists the logged in user's webhooks, with a form to add a
+// new one.
+func (app *application) accountWebhooks(w http.ResponseWriter, r *http.Request) {
+	data, err := app.webhooksData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Form = webhookForm{Events: models.WebhookEvents}
+
+	app.render(w, r, "webhooks.tmpl.html", data, http.StatusOK)
+}
+
+// accountWebhooksPost() adds a webhook. The signing secret is generated for the
+// user and shown on the webhooks page.
+func (app *application) accountWebhooksPost(w http.ResponseWriter, r *http.Request) {
+	var form webhookForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.URL), "url", "This field cannot be blank")
+	form.CheckField(validator.ValidURL(form.URL), "url", "This field must be an http or https URL")
+	form.CheckField(webhook.CheckURL(form.URL) == nil, "url", "This URL points at a private address")
+	form.CheckField(len(form.Events) > 0, "events", "Pick at least one event")
+	for _, event := range form.Events {
+		form.CheckField(validator.PermittedString(event, models.WebhookEvents...), "events", "Unknown event")
+	}
 
-	// If any errors in our map than re render the create.tmpl.html page
-	// with a 422 status code error.
 	if !form.Valid() {
-		data := app.newTemplateData(r)
+		data, err := app.webhooksData(r)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
 		data.Form = form
-		app.render(w, "create.tmpl.html", data, http.StatusUnprocessableEntity)
+		app.render(w, r, "webhooks.tmpl.html", data, http.StatusUnprocessableEntity)
 		return
 	}
 
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	secret, err := newWebhookSecret()
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
-	// Use the Put() method to add a string value and the corresponding key to
-	// session data.
-	app.sessionManager.Put(r.Context(), "flash", "Snippet created successfully created!")
+	_, err = app.webhookStore.Insert(r.Context(), app.authenticatedUserID(r), form.URL, secret, form.Events)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
-	// redirect the user to the relvant snippet id page
-	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+	app.sessionManager.Put(r.Context(), "flash", "Webhook added.")
+
+	http.Redirect(w, r, "/account/webhooks", http.StatusSeeOther)
 }
 
-func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
-	// when httprouter is parsing a request, the values of any named parameters
-	// will be stored in the request context. We can use the ParamsFromContext()
-	// function to retrive the slice containing these parameter names and values.
-	params := httprouter.ParamsFromContext(r.Context())
+// webhookDeletePost() removes one of the logged in user's webhooks.
+func (app *application) webhookDeletePost(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.webhookForOwner(w, r)
+	if !ok {
+		return
+	}
 
-	id, err := strconv.Atoi(params.ByName("id"))
-	if err != nil || id < 1 { // convert id to int and makes sure its greater than 1
+	err := app.webhookStore.Delete(r.Context(), webhook.ID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Webhook deleted.")
+
+	http.Redirect(w, r, "/account/webhooks", http.StatusSeeOther)
+}
+
+// webhookDeliveries() shows the delivery log for one of the logged in user's
+// webhooks: every attempt, with the response status we got back.
+func (app *application) webhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.webhookForOwner(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := app.webhookStore.Deliveries(r.Context(), webhook.ID, webhookDeliveryLogSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Webhook = webhook
+	data.Deliveries = deliveries
+
+	app.render(w, r, "deliveries.tmpl.html", data, http.StatusOK)
+}
+
+// webhooksData() gathers the data for the webhooks page.
+func (app *application) webhooksData(r *http.Request) (*templateData, error) {
+	webhooks, err := app.webhookStore.ForUser(r.Context(), app.authenticatedUserID(r))
+	if err != nil {
+		return nil, err
+	}
+
+	data := app.newTemplateData(r)
+	data.Webhooks = webhooks
+	data.WebhookEvents = models.WebhookEvents
+
+	return data, nil
+}
+
+// webhookForOwner() looks up the webhook in the :id route parameter and checks
+// it belongs to the logged in user, writing the error response itself and
+// returning false if not.
+func (app *application) webhookForOwner(w http.ResponseWriter, r *http.Request) (*models.Webhook, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
 		app.clientError(w, http.StatusNotFound)
+		return nil, false
+	}
+
+	webhook, err := app.webhookStore.Get(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return nil, false
+	}
+
+	if webhook.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return nil, false
+	}
+
+	return webhook, true
+}
+
+// accountNotifications() lists the logged in user's notifications along with
+// the form for choosing which kinds they get.
+func (app *application) accountNotifications(w http.ResponseWriter, r *http.Request) {
+	data, err := app.notificationsData(r)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
-	snippet, err := app.snippets.Get(id)
+	prefs, err := app.notifications.Preferences(r.Context(), app.authenticatedUserID(r))
 	if err != nil {
-		if errors.Is(err, models.ErrNoRecord) {
-			app.clientError(w, http.StatusNotFound)
-		} else {
-			app.serverError(w, err)
+		app.serverError(w, r, err)
+		return
+	}
+
+	form := notificationPreferencesForm{}
+	for _, kind := range models.NotificationKinds {
+		if prefs[kind] {
+			form.Kinds = append(form.Kinds, kind)
 		}
+	}
+	data.Form = form
+
+	app.render(w, r, "notifications.tmpl.html", data, http.StatusOK)
+}
+
+// accountNotificationsPost() saves which kinds of notification the logged in
+// user wants.
+func (app *application) accountNotificationsPost(w http.ResponseWriter, r *http.Request) {
+	var form notificationPreferencesForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	// fix new lines
-	snippet.Content = strings.ReplaceAll(snippet.Content, "\\n", "\n")
+	for _, kind := range form.Kinds {
+		form.CheckField(validator.PermittedString(kind, models.NotificationKinds...), "kinds", "Unknown notification")
+	}
+
+	if !form.Valid() {
+		data, err := app.notificationsData(r)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data.Form = form
+		app.render(w, r, "notifications.tmpl.html", data, http.StatusUnprocessableEntity)
+		return
+	}
+
+	err = app.notifications.SetPreferences(r.Context(), app.authenticatedUserID(r), form.Kinds)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Notification preferences saved.")
+
+	http.Redirect(w, r, "/account/notifications", http.StatusSeeOther)
+}
+
+// notificationReadPost() marks one of the logged in user's notifications as read.
+func (app *application) notificationReadPost(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	err = app.notifications.MarkRead(r.Context(), id, app.authenticatedUserID(r))
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/account/notifications", http.StatusSeeOther)
+}
+
+// notificationsReadAllPost() marks all of the logged in user's notifications as
+// read.
+func (app *application) notificationsReadAllPost(w http.ResponseWriter, r *http.Request) {
+	err := app.notifications.MarkAllRead(r.Context(), app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/account/notifications", http.StatusSeeOther)
+}
+
+// notificationsData() gathers the data for the notifications page.
+func (app *application) notificationsData(r *http.Request) (*templateData, error) {
+	notifications, err := app.notifications.ForUser(r.Context(), app.authenticatedUserID(r), notificationPageSize)
+	if err != nil {
+		return nil, err
+	}
 
-	// use our templateData holding struct
 	data := app.newTemplateData(r)
-	data.Snippet = snippet
+	data.Notifications = notifications
+	data.NotificationKinds = models.NotificationKinds
 
-	app.render(w, "view.tmpl.html", data, http.StatusOK)
+	return data, nil
 }
 
 // userSignUp() renders the user sign up html form.
@@ -155,7 +1228,7 @@ func (app *application) userSignUp(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = userSignUpForm{}
 
-	app.render(w, "signup.tmpl.html", data, http.StatusOK)
+	app.render(w, r, "signup.tmpl.html", data, http.StatusOK)
 }
 
 // userSignUpPost() handles the user sign up post request and validates the form data and
@@ -189,11 +1262,11 @@ func (app *application) userSignUpPost(w http.ResponseWriter, r *http.Request) {
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, "signup.tmpl.html", data, http.StatusUnprocessableEntity)
+		app.render(w, r, "signup.tmpl.html", data, http.StatusUnprocessableEntity)
 		return
 	}
 
-	err = app.users.Insert(form.Name, form.Email, form.Password)
+	err = app.users.Insert(r.Context(), form.Name, form.Email, form.Password)
 	if err != nil {
 		// check for duplicate email error
 		if errors.Is(err, models.ErrDuplicateEmail) {
@@ -203,8 +1276,11 @@ func (app *application) userSignUpPost(w http.ResponseWriter, r *http.Request) {
 			// re render the signup page with the new field error
 			data := app.newTemplateData(r)
 			data.Form = form
-			app.render(w, "signup.tmpl.html", data, http.StatusUnprocessableEntity)
+			app.render(w, r, "signup.tmpl.html", data, http.StatusUnprocessableEntity)
+		} else {
+			app.modelError(w, r, err)
 		}
+		return
 	}
 
 	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
@@ -220,7 +1296,7 @@ func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = userLoginForm{}
 
-	app.render(w, "login.tmpl.html", data, http.StatusOK)
+	app.render(w, r, "login.tmpl.html", data, http.StatusOK)
 }
 
 func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
@@ -239,22 +1315,22 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, "login.tmpl.html", data, http.StatusUnprocessableEntity)
+		app.render(w, r, "login.tmpl.html", data, http.StatusUnprocessableEntity)
 		return
 	}
 
 	// Check whether the credentials are valid. If they're not, add a generic
 	// non-field error message and re-display the login page
-	id, err := app.users.Authenticate(form.Email, form.Password)
+	id, err := app.users.Authenticate(r.Context(), form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
 			form.AddNonFieldErros("Email or password is incorrect")
 
 			data := app.newTemplateData(r)
 			data.Form = form
-			app.render(w, "login.tmpl.html", data, http.StatusUnprocessableEntity)
+			app.render(w, r, "login.tmpl.html", data, http.StatusUnprocessableEntity)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
@@ -264,7 +1340,7 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	// state or privilege levels change for the users (e.g. login and logout operations).
 	err = app.sessionManager.RenewToken(r.Context())
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -279,7 +1355,7 @@ func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 	// Use the RenewToken() method on the current session to change the session ID.
 	err := app.sessionManager.RenewToken(r.Context())
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -292,3 +1368,49 @@ func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 	// Redirect the user to the home page
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
+
+// readyzDBTimeout is how long /readyz waits for the database to answer.
+const readyzDBTimeout = 2 * time.Second
+
+// healthz() is the liveness probe: if we can answer at all, the process is alive.
+func (app *application) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// readyz() is the readiness probe. We are ready to take traffic when the
+// database answers through the pool, the templates are loaded and we aren't
+// shutting down. The response lists the result of each check, with a 503 if
+// any of them failed.
+func (app *application) readyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{
+		"database":  "ok",
+		"templates": "ok",
+		"shutdown":  "ok",
+	}
+	status := http.StatusOK
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyzDBTimeout)
+	defer cancel()
+
+	// NOTE: the probes are public, so the reason the database is down goes to the
+	// log rather than into the response.
+	if err := app.db.Ping(ctx); err != nil {
+		app.requestLogger(r).Warn("readiness check failed", "check", "database", "error", err)
+		checks["database"] = "unreachable"
+		status = http.StatusServiceUnavailable
+	}
+
+	if len(app.templateCache) == 0 {
+		checks["templates"] = "template cache is empty"
+		status = http.StatusServiceUnavailable
+	}
+
+	if app.shuttingDown.Load() {
+		checks["shutdown"] = "shutting down"
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	app.writeJSON(w, r, status, map[string]any{"checks": checks})
+}
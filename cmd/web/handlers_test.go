@@ -0,0 +1,917 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+func TestHealthz(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	res := ts.get(t, "/healthz")
+	if res.status != http.StatusOK || res.body != "ok" {
+		t.Errorf("got %d %q, want 200 \"ok\"", res.status, res.body)
+	}
+
+	res = ts.get(t, "/readyz")
+	if res.status != http.StatusOK {
+		t.Errorf("/readyz got %d, want 200", res.status)
+	}
+
+	app.shuttingDown.Store(true)
+
+	res = ts.get(t, "/readyz")
+	if res.status != http.StatusServiceUnavailable || !strings.Contains(res.body, "shutting down") {
+		t.Errorf("/readyz while shutting down got %d %q, want a 503", res.status, res.body)
+	}
+}
+
+func TestHome(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	newSnippet(t, m, 0, "An old silent pond", "A frog jumps into the pond")
+	newSnippet(t, m, 0, "Over the wintry forest", "winds howl in rage")
+
+	res := ts.get(t, "/")
+	if res.status != http.StatusOK {
+		t.Fatalf("got status %d, want 200", res.status)
+	}
+	for _, want := range []string{"An old silent pond", "Over the wintry forest"} {
+		if !strings.Contains(res.body, want) {
+			t.Errorf("home page doesn't contain %q", want)
+		}
+	}
+
+	for _, query := range []string{"?sort=sideways", "?limit=0", "?limit=101", "?cursor=nope"} {
+		if res := ts.get(t, "/"+query); res.status != http.StatusBadRequest {
+			t.Errorf("/%s got %d, want 400", query, res.status)
+		}
+	}
+
+	if res := ts.get(t, "/no/such/page"); res.status != http.StatusNotFound {
+		t.Errorf("unknown route got %d, want 404", res.status)
+	}
+}
+
+func TestSnippetView(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	id := newSnippet(t, m, 0, "An old silent pond", "A frog jumps into the pond")
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"valid id", "/snippet/view/1", http.StatusOK, "A frog jumps into the pond"},
+		{"missing id", "/snippet/view/2", http.StatusNotFound, ""},
+		{"negative id", "/snippet/view/-1", http.StatusNotFound, ""},
+		{"decimal id", "/snippet/view/1.23", http.StatusNotFound, ""},
+		{"string id", "/snippet/view/foo", http.StatusNotFound, ""},
+		{"empty id", "/snippet/view/", http.StatusNotFound, ""},
+		{"missing revision", "/snippet/view/1?rev=2", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.get(t, tt.path)
+
+			if res.status != tt.wantCode {
+				t.Errorf("got status %d, want %d", res.status, tt.wantCode)
+			}
+			if !strings.Contains(res.body, tt.wantBody) {
+				t.Errorf("body doesn't contain %q", tt.wantBody)
+			}
+		})
+	}
+
+	// the view is counted.
+	if pending := app.viewCounter.Pending(id); pending != 1 {
+		t.Errorf("got %d buffered views, want 1", pending)
+	}
+
+	// expired snippets are gone.
+	m.snippets.Now = func() time.Time { return time.Now().UTC().AddDate(0, 0, 8) }
+	if res := ts.get(t, "/snippet/view/1"); res.status != http.StatusNotFound {
+		t.Errorf("expired snippet got %d, want 404", res.status)
+	}
+}
+
+func TestSnippetViewNotModified(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	newSnippet(t, m, 0, "An old silent pond", "A frog jumps into the pond")
+
+	res := ts.get(t, "/snippet/view/1")
+	etag := res.header.Get("ETag")
+	if res.status != http.StatusOK || etag == "" {
+		t.Fatalf("got %d with ETag %q", res.status, etag)
+	}
+
+	if res := ts.get(t, "/snippet/view/1", "If-None-Match", etag); res.status != http.StatusNotModified || res.body != "" {
+		t.Errorf("with its ETag got %d, want 304 with no body", res.status)
+	}
+
+	// a new view is still counted.
+	if pending := app.viewCounter.Pending(1); pending != 2 {
+		t.Errorf("got %d buffered views, want 2", pending)
+	}
+
+	// the page after creating a snippet carries a flash, which is popped as it
+	// is read. Even a wildcard mustn't turn it into a 304.
+	ts.login(t, m, "alice")
+
+	form := url.Values{"title": {"O snail"}, "content": {"Climb Mount Fuji"}, "content_type": {"text"}, "expires": {"7"}}
+	if res := ts.postForm(t, "/snippet/create", form); res.status != http.StatusSeeOther {
+		t.Fatalf("creating a snippet got %d, want 303", res.status)
+	}
+
+	res = ts.get(t, "/snippet/view/2", "If-None-Match", "*")
+	if res.status != http.StatusOK || !strings.Contains(res.body, "Snippet created successfully created!") {
+		t.Errorf("page with a flash got %d, want 200 with the flash", res.status)
+	}
+	if res.header.Get("ETag") != "" {
+		t.Errorf("page with a flash got ETag %q", res.header.Get("ETag"))
+	}
+
+	// once it has been shown, the page can be revalidated again.
+	if res := ts.get(t, "/snippet/view/2", "If-None-Match", "*"); res.status != http.StatusNotModified {
+		t.Errorf("page without the flash got %d, want 304", res.status)
+	}
+}
+
+func TestUserSignup(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	if res := ts.get(t, "/user/signup"); res.status != http.StatusOK || !strings.Contains(res.body, "<form") {
+		t.Errorf("signup form got %d", res.status)
+	}
+
+	valid := url.Values{"name": {"Bob"}, "email": {"bob@example.com"}, "password": {"validPa$$word"}}
+
+	res := ts.postForm(t, "/user/signup", valid)
+	if res.status != http.StatusSeeOther || res.header.Get("Location") != "/user/login" {
+		t.Fatalf("got %d to %q, want 303 to /user/login", res.status, res.header.Get("Location"))
+	}
+
+	tests := []struct {
+		name     string
+		field    string
+		value    string
+		wantBody string
+	}{
+		{"empty name", "name", "", "This field can not be blank"},
+		{"invalid email", "email", "bob@example.", "This field must be a valid email address"},
+		{"short password", "password", "pa$$", "This field must be at least 8 characters long"},
+		{"duplicate email", "email", "bob@example.com", "Email address is already in use"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"name": {"Alice"}, "email": {"alice@example.com"}, "password": {"validPa$$word"}}
+			form.Set(tt.field, tt.value)
+
+			res := ts.postForm(t, "/user/signup", form)
+			if res.status != http.StatusUnprocessableEntity {
+				t.Errorf("got status %d, want 422", res.status)
+			}
+			if !strings.Contains(res.body, tt.wantBody) {
+				t.Errorf("body doesn't contain %q", tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUserLogin(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	res := ts.postForm(t, "/user/login", url.Values{"email": {"nobody@example.com"}, "password": {"pa55word123"}})
+	if res.status != http.StatusUnprocessableEntity || !strings.Contains(res.body, "Email or password is incorrect") {
+		t.Errorf("unknown user got %d", res.status)
+	}
+
+	ts.login(t, m, "alice")
+
+	// logged in, the create form is the first page we are sent to.
+	res = ts.get(t, "/snippet/create")
+	if res.status != http.StatusOK || !strings.Contains(res.body, "<form") {
+		t.Errorf("create form got %d", res.status)
+	}
+
+	res = ts.postForm(t, "/user/logout", nil)
+	if res.status != http.StatusSeeOther || res.header.Get("Location") != "/" {
+		t.Errorf("logout got %d to %q", res.status, res.header.Get("Location"))
+	}
+
+	if res := ts.get(t, "/"); !strings.Contains(res.body, "You have been logged out.") {
+		t.Error("no logged out flash on the home page")
+	}
+
+	if res := ts.get(t, "/snippet/create"); res.status != http.StatusSeeOther {
+		t.Errorf("create form after logging out got %d, want 303", res.status)
+	}
+}
+
+func TestProtectedRoutes(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	newSnippet(t, m, 0, "title", "content")
+
+	routes := []struct {
+		method, path string
+	}{
+		{http.MethodGet, "/snippet/create"},
+		{http.MethodPost, "/snippet/create"},
+		{http.MethodGet, "/snippet/edit/1"},
+		{http.MethodPost, "/snippet/delete/1"},
+		{http.MethodGet, "/snippet/stats/1"},
+		{http.MethodPost, "/snippet/star/1"},
+		{http.MethodPost, "/snippet/unstar/1"},
+		{http.MethodPost, "/snippet/comment/1"},
+		{http.MethodGet, "/comment/edit/1"},
+		{http.MethodPost, "/comment/edit/1"},
+		{http.MethodPost, "/comment/delete/1"},
+		{http.MethodGet, "/account/starred"},
+		{http.MethodGet, "/account/webhooks"},
+		{http.MethodGet, "/account/notifications"},
+		{http.MethodPost, "/user/logout"},
+	}
+
+	for _, route := range routes {
+		req, err := http.NewRequest(route.method, ts.URL+route.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := ts.do(t, req)
+		if res.status != http.StatusSeeOther || res.header.Get("Location") != "/user/login" {
+			t.Errorf("%s %s got %d to %q, want 303 to /user/login", route.method, route.path, res.status, res.header.Get("Location"))
+		}
+	}
+
+	ts.login(t, m, "alice")
+
+	for _, path := range []string{"/snippet/create", "/account/starred", "/account/webhooks", "/account/notifications"} {
+		res := ts.get(t, path)
+		if res.status != http.StatusOK {
+			t.Errorf("%s got %d, want 200", path, res.status)
+		}
+		if cc := res.header.Get("Cache-Control"); cc != "private, no-cache" {
+			t.Errorf("%s got Cache-Control %q, want private, no-cache", path, cc)
+		}
+	}
+}
+
+func TestSnippetCreatePost(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	userID := ts.login(t, m, "alice")
+
+	form := url.Values{"title": {"O snail"}, "content": {"Climb Mount Fuji"}, "content_type": {"text"}, "expires": {"7"}}
+
+	res := ts.postForm(t, "/snippet/create", form)
+	if res.status != http.StatusSeeOther || res.header.Get("Location") != "/snippet/view/1" {
+		t.Fatalf("got %d to %q, want 303 to /snippet/view/1", res.status, res.header.Get("Location"))
+	}
+
+	res = ts.get(t, "/snippet/view/1")
+	for _, want := range []string{"O snail", "Climb Mount Fuji", "Snippet created successfully created!"} {
+		if !strings.Contains(res.body, want) {
+			t.Errorf("snippet page doesn't contain %q", want)
+		}
+	}
+
+	snippet, err := m.snippets.Get(t.Context(), 1)
+	if err != nil || snippet.UserID != userID {
+		t.Errorf("got snippet %+v, %v, want one owned by %d", snippet, err, userID)
+	}
+
+	tests := []struct {
+		field, value, wantBody string
+	}{
+		{"title", "", "This field cannot be blank"},
+		{"title", strings.Repeat("a", 101), "This field cannot be more than 100 characters long"},
+		{"content", "", "This field cannot be blank"},
+		{"content_type", "html", "This field must equal text or markdown"},
+		{"expires", "2", "This field must equal 1, 7 or 365"},
+	}
+
+	for _, tt := range tests {
+		invalid := url.Values{}
+		for k, v := range form {
+			invalid[k] = v
+		}
+		invalid.Set(tt.field, tt.value)
+
+		res := ts.postForm(t, "/snippet/create", invalid)
+		if res.status != http.StatusUnprocessableEntity || !strings.Contains(res.body, tt.wantBody) {
+			t.Errorf("%s=%q got %d, want 422 with %q", tt.field, tt.value, res.status, tt.wantBody)
+		}
+	}
+}
+
+func TestSnippetOwnerOnly(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	ts.login(t, m, "mallory")
+	id := newSnippet(t, m, 99, "someone else's", "content")
+
+	edit := url.Values{"title": {"mine now"}, "content": {"content"}, "content_type": {"text"}}
+
+	for _, res := range []response{
+		ts.get(t, "/snippet/edit/1"),
+		ts.postForm(t, "/snippet/edit/1", edit),
+		ts.postForm(t, "/snippet/delete/1", nil),
+		ts.get(t, "/snippet/stats/1"),
+	} {
+		if res.status != http.StatusForbidden {
+			t.Errorf("got %d, want 403", res.status)
+		}
+	}
+
+	if _, err := m.snippets.Get(t.Context(), id); err != nil {
+		t.Errorf("snippet is gone: %v", err)
+	}
+}
+
+func TestSnippetEditDelete(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	userID := ts.login(t, m, "alice")
+	id := newSnippet(t, m, userID, "first draft", "old content")
+
+	res := ts.postForm(t, "/snippet/edit/1", url.Values{"title": {"second draft"}, "content": {"new content"}, "content_type": {"text"}})
+	if res.status != http.StatusSeeOther {
+		t.Fatalf("edit got %d, want 303", res.status)
+	}
+
+	if res := ts.get(t, "/snippet/view/1"); !strings.Contains(res.body, "new content") {
+		t.Error("snippet page doesn't show the edit")
+	}
+	if res := ts.get(t, "/snippet/view/1?rev=1"); res.status != http.StatusOK || !strings.Contains(res.body, "old content") {
+		t.Errorf("first revision got %d", res.status)
+	}
+
+	// a view still in the buffer when the snippet is deleted is dropped.
+	app.viewCounter.Record(id, "")
+
+	res = ts.postForm(t, "/snippet/delete/1", nil)
+	if res.status != http.StatusSeeOther || res.header.Get("Location") != "/" {
+		t.Fatalf("delete got %d to %q, want 303 to /", res.status, res.header.Get("Location"))
+	}
+
+	if res := ts.get(t, "/snippet/view/1"); res.status != http.StatusNotFound {
+		t.Errorf("deleted snippet got %d, want 404", res.status)
+	}
+	if pending := app.viewCounter.Pending(id); pending != 0 {
+		t.Errorf("got %d buffered views for a deleted snippet, want 0", pending)
+	}
+}
+
+func TestStarsAndComments(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	ts.login(t, m, "alice")
+	id := newSnippet(t, m, 99, "starred snippet", "line one\nline two")
+
+	for range 2 {
+		res := ts.postForm(t, "/snippet/star/1", nil)
+		if res.status != http.StatusSeeOther || res.header.Get("Location") != "/snippet/view/1" {
+			t.Fatalf("star got %d to %q", res.status, res.header.Get("Location"))
+		}
+	}
+	if count, _ := m.stars.Count(t.Context(), id); count != 1 {
+		t.Errorf("got %d stars, want 1", count)
+	}
+
+	if res := ts.get(t, "/account/starred"); !strings.Contains(res.body, "starred snippet") {
+		t.Error("starred page doesn't list the snippet")
+	}
+
+	if res := ts.postForm(t, "/snippet/star/2", nil); res.status != http.StatusNotFound {
+		t.Errorf("starring a missing snippet got %d, want 404", res.status)
+	}
+
+	res := ts.postForm(t, "/snippet/comment/1", url.Values{"body": {"what a *lovely* snippet"}})
+	if res.status != http.StatusSeeOther || !strings.HasPrefix(res.header.Get("Location"), "/snippet/view/1?rev=1#comment-") {
+		t.Fatalf("comment got %d to %q", res.status, res.header.Get("Location"))
+	}
+
+	if res := ts.get(t, "/snippet/view/1"); !strings.Contains(res.body, "<em>lovely</em>") || !strings.Contains(res.body, "alice") {
+		t.Error("snippet page doesn't show the comment")
+	}
+
+	for _, tt := range []struct {
+		form     url.Values
+		wantCode int
+	}{
+		{url.Values{"body": {""}}, http.StatusUnprocessableEntity},
+		{url.Values{"body": {"off the end"}, "line": {"3"}, "revision": {"1"}}, http.StatusBadRequest},
+		{url.Values{"body": {"a reply"}, "parent_id": {"42"}}, http.StatusBadRequest},
+	} {
+		if res := ts.postForm(t, "/snippet/comment/1", tt.form); res.status != tt.wantCode {
+			t.Errorf("comment %v got %d, want %d", tt.form, res.status, tt.wantCode)
+		}
+	}
+}
+
+func TestUnstar(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	userID := ts.login(t, m, "alice")
+	id := newSnippet(t, m, 99, "starred snippet", "content")
+
+	if _, err := m.stars.Star(t.Context(), userID, id); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		wantCode     int
+		wantLocation string
+	}{
+		{"starred", "/snippet/unstar/1", http.StatusSeeOther, "/snippet/view/1"},
+		{"not starred", "/snippet/unstar/1", http.StatusSeeOther, "/snippet/view/1"},
+		{"missing snippet", "/snippet/unstar/2", http.StatusSeeOther, "/snippet/view/2"},
+		{"bad id", "/snippet/unstar/x", http.StatusNotFound, ""},
+		{"negative id", "/snippet/unstar/-1", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.postForm(t, tt.path, nil)
+			if res.status != tt.wantCode || res.header.Get("Location") != tt.wantLocation {
+				t.Errorf("got %d to %q, want %d to %q", res.status, res.header.Get("Location"), tt.wantCode, tt.wantLocation)
+			}
+		})
+	}
+
+	if count, _ := m.stars.Count(t.Context(), id); count != 0 {
+		t.Errorf("got %d stars, want 0", count)
+	}
+	if res := ts.get(t, "/account/starred"); strings.Contains(res.body, "starred snippet") {
+		t.Error("starred page still lists the snippet")
+	}
+}
+
+// TestComments checks who can edit and delete a comment: only its author can
+// edit it, and its author or the owner of the snippet can delete it.
+func TestComments(t *testing.T) {
+	app, m := newTestApplication(t)
+
+	// each user has their own client, and so their own session.
+	owner, alice, bob := newTestServer(t, app.routes()), newTestServer(t, app.routes()), newTestServer(t, app.routes())
+	ownerID := owner.login(t, m, "olive")
+	aliceID := alice.login(t, m, "alice")
+	bobID := bob.login(t, m, "bob")
+
+	id := newSnippet(t, m, ownerID, "commented snippet", "content")
+
+	newComment := func(userID int, body string) int {
+		t.Helper()
+
+		commentID, err := m.comments.Insert(t.Context(), id, userID, 0, 0, 0, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return commentID
+	}
+
+	aliceComment := newComment(aliceID, "alice was here")
+	bobComment := newComment(bobID, "bob was here")
+	ownComment := newComment(aliceID, "alice again")
+
+	t.Run("edit form", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			ts       *testServer
+			path     string
+			wantCode int
+		}{
+			{"author", alice, fmt.Sprintf("/comment/edit/%d", aliceComment), http.StatusOK},
+			{"someone else", bob, fmt.Sprintf("/comment/edit/%d", aliceComment), http.StatusForbidden},
+			{"snippet owner", owner, fmt.Sprintf("/comment/edit/%d", aliceComment), http.StatusForbidden},
+			{"missing comment", alice, "/comment/edit/99", http.StatusNotFound},
+			{"bad id", alice, "/comment/edit/x", http.StatusNotFound},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				res := tt.ts.get(t, tt.path)
+				if res.status != tt.wantCode {
+					t.Errorf("got %d, want %d", res.status, tt.wantCode)
+				}
+				if tt.wantCode == http.StatusOK && !strings.Contains(res.body, "alice was here") {
+					t.Error("form doesn't hold the comment")
+				}
+			})
+		}
+	})
+
+	t.Run("edit", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			ts           *testServer
+			body         string
+			wantCode     int
+			wantLocation string
+		}{
+			{"someone else", bob, "bob's words", http.StatusForbidden, ""},
+			{"snippet owner", owner, "olive's words", http.StatusForbidden, ""},
+			{"empty", alice, "", http.StatusUnprocessableEntity, ""},
+			{"author", alice, "alice was edited", http.StatusSeeOther, fmt.Sprintf("/snippet/view/%d#comment-%d", id, aliceComment)},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				res := tt.ts.postForm(t, fmt.Sprintf("/comment/edit/%d", aliceComment), url.Values{"body": {tt.body}})
+				if res.status != tt.wantCode || res.header.Get("Location") != tt.wantLocation {
+					t.Errorf("got %d to %q, want %d to %q", res.status, res.header.Get("Location"), tt.wantCode, tt.wantLocation)
+				}
+			})
+		}
+
+		comment, err := m.comments.Get(t.Context(), aliceComment)
+		if err != nil || comment.Body != "alice was edited" || !comment.Edited {
+			t.Errorf("got %+v, %v, want the author's edit", comment, err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			ts        *testServer
+			commentID int
+			wantCode  int
+			wantGone  bool
+		}{
+			{"someone else", bob, aliceComment, http.StatusForbidden, false},
+			{"author", alice, ownComment, http.StatusSeeOther, true},
+			{"snippet owner", owner, bobComment, http.StatusSeeOther, true},
+			{"missing comment", alice, 99, http.StatusNotFound, true},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				res := tt.ts.postForm(t, fmt.Sprintf("/comment/delete/%d", tt.commentID), nil)
+				if res.status != tt.wantCode {
+					t.Errorf("got %d, want %d", res.status, tt.wantCode)
+				}
+				if tt.wantCode == http.StatusSeeOther && res.header.Get("Location") != fmt.Sprintf("/snippet/view/%d", id) {
+					t.Errorf("redirected to %q", res.header.Get("Location"))
+				}
+
+				_, err := m.comments.Get(t.Context(), tt.commentID)
+				if gone := errors.Is(err, models.ErrNoRecord); gone != tt.wantGone {
+					t.Errorf("got comment gone %t, want %t", gone, tt.wantGone)
+				}
+			})
+		}
+	})
+}
+
+// TestLiveEvents reads the stream for a new snippet, a view and a star.
+func TestLiveEvents(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got %d %q, want 200 text/event-stream", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	lines := bufio.NewScanner(res.Body)
+
+	// next() returns the next event or retry line, skipping the blank lines
+	// between them.
+	next := func() string {
+		t.Helper()
+
+		for lines.Scan() {
+			if line := lines.Text(); line != "" {
+				return line
+			}
+		}
+		t.Fatalf("stream ended: %v", lines.Err())
+		return ""
+	}
+
+	if line := next(); line != "retry: 5000" {
+		t.Fatalf("got %q, want the retry line first", line)
+	}
+
+	// the stream is subscribed once the first line is through, so nothing
+	// published from here on is missed.
+	userID := ts.login(t, m, "alice")
+	form := url.Values{"title": {"live snippet"}, "content": {"content"}, "content_type": {"text"}, "expires": {"7"}}
+	if res := ts.postForm(t, "/snippet/create", form); res.status != http.StatusSeeOther {
+		t.Fatalf("creating a snippet got %d, want 303", res.status)
+	}
+	ts.get(t, "/snippet/view/1")
+	if _, err := m.stars.Star(t.Context(), userID, 1); err != nil {
+		t.Fatal(err)
+	}
+	ts.postForm(t, "/snippet/unstar/1", nil)
+
+	tests := []struct {
+		event    string
+		wantData string
+	}{
+		{"event: snippet", `"title":"live snippet"`},
+		{"event: views", `{"id":1,"count":1}`},
+		{"event: stars", `{"id":1,"count":0}`},
+	}
+
+	for _, tt := range tests {
+		if event := next(); event != tt.event {
+			t.Fatalf("got %q, want %q", event, tt.event)
+		}
+		if data := next(); !strings.HasPrefix(data, "data: ") || !strings.Contains(data, tt.wantData) {
+			t.Errorf("%s got %q, want data with %s", tt.event, data, tt.wantData)
+		}
+	}
+}
+
+func TestAPISnippetList(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	for _, title := range []string{"one", "two", "three"} {
+		newSnippet(t, m, 0, title, "content")
+	}
+
+	res := ts.get(t, "/api/snippets?limit=2&sort=oldest")
+	if res.status != http.StatusOK || res.header.Get("Content-Type") != "application/json" {
+		t.Fatalf("got %d %q, want 200 JSON", res.status, res.header.Get("Content-Type"))
+	}
+
+	var page struct {
+		Snippets   []models.Snippet `json:"snippets"`
+		NextCursor string           `json:"next_cursor"`
+	}
+	if err := json.Unmarshal([]byte(res.body), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Snippets) != 2 || page.Snippets[0].Title != "one" || page.NextCursor == "" {
+		t.Errorf("got page %+v", page)
+	}
+
+	res = ts.get(t, "/api/snippets?limit=2&sort=oldest&cursor="+url.QueryEscape(page.NextCursor))
+	if res.status != http.StatusOK || !strings.Contains(res.body, `"three"`) {
+		t.Errorf("second page got %d %s", res.status, res.body)
+	}
+
+	if res := ts.get(t, "/api/snippets?sort=sideways"); res.status != http.StatusBadRequest {
+		t.Errorf("bad sort got %d, want 400", res.status)
+	}
+}
+
+func TestSnippetExport(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	newSnippet(t, m, 0, "haiku", "An old silent pond")
+	newSnippet(t, m, 0, "another", "winds howl in rage")
+
+	res := ts.get(t, "/snippet/raw/1")
+	if res.status != http.StatusOK || res.body != "An old silent pond" || !strings.HasPrefix(res.header.Get("Content-Type"), "text/plain") {
+		t.Errorf("raw got %d %q %q", res.status, res.header.Get("Content-Type"), res.body)
+	}
+
+	res = ts.get(t, "/snippet/download/1")
+	if res.status != http.StatusOK || !strings.HasPrefix(res.header.Get("Content-Disposition"), "attachment") {
+		t.Errorf("download got %d, Content-Disposition %q", res.status, res.header.Get("Content-Disposition"))
+	}
+
+	// snippets can be edited or deleted at any time, so caches have to check
+	// back every time.
+	for _, path := range []string{"/snippet/raw/1", "/snippet/download/1", "/snippet/archive/1"} {
+		res := ts.get(t, path)
+		if cc := res.header.Get("Cache-Control"); cc != "public, no-cache" {
+			t.Errorf("%s got Cache-Control %q, want public, no-cache", path, cc)
+		}
+
+		if res := ts.get(t, path, "If-None-Match", res.header.Get("ETag")); res.status != http.StatusNotModified {
+			t.Errorf("%s with its ETag got %d, want 304", path, res.status)
+		}
+	}
+
+	tests := []struct {
+		path        string
+		wantCode    int
+		contentType string
+	}{
+		{"/snippet/archive/1", http.StatusOK, "application/zip"},
+		{"/snippet/archive?id=1&id=2&format=tar.gz", http.StatusOK, "application/gzip"},
+		{"/snippet/archive/3", http.StatusNotFound, ""},
+		{"/snippet/archive?id=1&format=rar", http.StatusBadRequest, ""},
+		{"/snippet/archive?id=x", http.StatusBadRequest, ""},
+		{"/snippet/archive", http.StatusBadRequest, ""},
+		{"/snippet/raw/3", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		res := ts.get(t, tt.path)
+		if res.status != tt.wantCode {
+			t.Errorf("%s got %d, want %d", tt.path, res.status, tt.wantCode)
+		}
+		if tt.contentType != "" && res.header.Get("Content-Type") != tt.contentType {
+			t.Errorf("%s got Content-Type %q, want %q", tt.path, res.header.Get("Content-Type"), tt.contentType)
+		}
+	}
+}
+
+// content is served exactly as it was written, escapes and all.
+func TestSnippetContentAsStored(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	userID := ts.login(t, m, "alice")
+	content := `printf "a\nb\n"`
+	id := newSnippet(t, m, userID, "printf", content)
+
+	for _, path := range []string{"/snippet/raw/1", "/snippet/download/1"} {
+		if res := ts.get(t, path); res.body != content {
+			t.Errorf("%s got %q, want %q", path, res.body, content)
+		}
+	}
+
+	if res := ts.get(t, "/snippet/edit/1"); !strings.Contains(res.body, `a\nb\n`) {
+		t.Error("edit form doesn't hold the content as written")
+	}
+
+	// saving the form unchanged keeps the content.
+	res := ts.postForm(t, "/snippet/edit/1", url.Values{"title": {"printf"}, "content": {content}, "content_type": {"text"}})
+	if res.status != http.StatusSeeOther {
+		t.Fatalf("edit got %d, want 303", res.status)
+	}
+
+	snippet, err := m.snippets.Get(t.Context(), id)
+	if err != nil || snippet.Content != content {
+		t.Errorf("got content %q, %v, want %q", snippet.Content, err, content)
+	}
+}
+
+func TestWebhookPages(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	userID := ts.login(t, m, "alice")
+
+	res := ts.postForm(t, "/account/webhooks", url.Values{"url": {"https://example.com/hook"}, "events": {models.EventSnippetCreated}})
+	if res.status != http.StatusSeeOther {
+		t.Fatalf("adding a webhook got %d, want 303", res.status)
+	}
+
+	if res := ts.get(t, "/account/webhooks"); !strings.Contains(res.body, "https://example.com/hook") {
+		t.Error("webhooks page doesn't list the webhook")
+	}
+
+	tests := []struct {
+		form     url.Values
+		wantBody string
+	}{
+		{url.Values{"url": {"ftp://example.com"}, "events": {models.EventSnippetCreated}}, "This field must be an http or https URL"},
+		{url.Values{"url": {"http://169.254.169.254/latest"}, "events": {models.EventSnippetCreated}}, "This URL points at a private address"},
+		{url.Values{"url": {"http://localhost:8080"}, "events": {models.EventSnippetCreated}}, "This URL points at a private address"},
+		{url.Values{"url": {"https://example.com/hook"}}, "Pick at least one event"},
+	}
+
+	for _, tt := range tests {
+		res := ts.postForm(t, "/account/webhooks", tt.form)
+		if res.status != http.StatusUnprocessableEntity || !strings.Contains(res.body, tt.wantBody) {
+			t.Errorf("%v got %d, want 422 with %q", tt.form, res.status, tt.wantBody)
+		}
+	}
+
+	webhooks, _ := m.webhooks.ForUser(t.Context(), userID)
+	if len(webhooks) != 1 {
+		t.Fatalf("got %d webhooks, want 1", len(webhooks))
+	}
+
+	if res := ts.get(t, "/webhook/deliveries/1"); res.status != http.StatusOK {
+		t.Errorf("deliveries got %d, want 200", res.status)
+	}
+
+	// someone else's webhook.
+	other, _ := m.webhooks.Insert(t.Context(), userID+1, "https://example.com/other", "secret", []string{models.EventSnippetCreated})
+	if res := ts.postForm(t, fmt.Sprintf("/webhook/delete/%d", other), nil); res.status != http.StatusForbidden {
+		t.Errorf("deleting someone else's webhook got %d, want 403", res.status)
+	}
+	if _, err := m.webhooks.Get(t.Context(), other); err != nil {
+		t.Errorf("someone else's webhook is gone: %v", err)
+	}
+}
+
+func TestNotificationPages(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	userID := ts.login(t, m, "alice")
+	m.users.Insert(t.Context(), "bob", "bob@example.com", "pa55word123")
+	bob, _ := m.users.Authenticate(t.Context(), "bob@example.com", "pa55word123")
+
+	id := newSnippet(t, m, userID, "noticed", "content")
+	m.notifications.Insert(t.Context(), userID, bob, models.NotifyStar, id, 0)
+
+	res := ts.get(t, "/account/notifications")
+	if res.status != http.StatusOK || !strings.Contains(res.body, "bob") || !strings.Contains(res.body, "noticed") {
+		t.Errorf("notifications page got %d", res.status)
+	}
+
+	res = ts.postForm(t, "/account/notifications/read", nil)
+	if res.status != http.StatusSeeOther {
+		t.Errorf("mark all read got %d, want 303", res.status)
+	}
+	if count, _ := m.notifications.UnreadCount(t.Context(), userID); count != 0 {
+		t.Errorf("got %d unread, want 0", count)
+	}
+
+	res = ts.postForm(t, "/account/notifications", url.Values{"kinds": {models.NotifyComment}})
+	if res.status != http.StatusSeeOther {
+		t.Errorf("saving preferences got %d, want 303", res.status)
+	}
+	if prefs, _ := m.notifications.Preferences(t.Context(), userID); prefs[models.NotifyStar] || !prefs[models.NotifyComment] {
+		t.Errorf("got preferences %v", prefs)
+	}
+
+	if res := ts.postForm(t, "/notification/read/42", nil); res.status != http.StatusNotFound {
+		t.Errorf("marking a missing notification read got %d, want 404", res.status)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	app, m := newTestApplication(t)
+	app.config.RateLimitAuth.Burst = 2
+	ts := newTestServer(t, app.routes())
+
+	m.users.Insert(t.Context(), "alice", "alice@example.com", "pa55word123")
+	form := url.Values{"email": {"alice@example.com"}, "password": {"wrong password"}}
+
+	for i := range 2 {
+		if res := ts.postForm(t, "/user/login", form); res.status != http.StatusUnprocessableEntity {
+			t.Fatalf("attempt %d got %d, want 422", i+1, res.status)
+		}
+	}
+
+	res := ts.postForm(t, "/user/login", form)
+	if res.status != http.StatusTooManyRequests || res.header.Get("Retry-After") == "" {
+		t.Errorf("third attempt got %d, Retry-After %q, want a 429", res.status, res.header.Get("Retry-After"))
+	}
+
+	// reads have their own limit.
+	if res := ts.get(t, "/user/login"); res.status != http.StatusOK {
+		t.Errorf("login form got %d, want 200", res.status)
+	}
+}
+
+func TestStatic(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	res := ts.get(t, app.static.url("css/main.css"))
+	if res.status != http.StatusOK || !strings.Contains(res.header.Get("Cache-Control"), "immutable") {
+		t.Errorf("hashed stylesheet got %d, Cache-Control %q", res.status, res.header.Get("Cache-Control"))
+	}
+
+	if res := ts.get(t, "/static/css/nope.css"); res.status != http.StatusNotFound {
+		t.Errorf("missing file got %d, want 404", res.status)
+	}
+}
@@ -2,12 +2,19 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 
+	"github.com/corbinlazarone/snippetbox/internal/models"
 	"github.com/go-playground/form/v4"
+	"github.com/julienschmidt/httprouter"
 )
 
 // Return true if the current request is from an authenticated user, otherwise return false.
@@ -15,6 +22,133 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 	return app.sessionManager.Exists(r.Context(), "authenticatedUserID")
 }
 
+// authenticatedUserID() returns the id of the logged in user, or 0 if the
+// request isn't authenticated.
+func (app *application) authenticatedUserID(r *http.Request) int {
+	return app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+}
+
+// unreadNotifications() returns how many unread notifications the logged in
+// user has, for the count in the nav. It is shown on every page, so a failure
+// is logged and shown as no notifications rather than failing the page.
+func (app *application) unreadNotifications(r *http.Request) int {
+	userID := app.authenticatedUserID(r)
+	if userID == 0 || !app.config.Features.Notifications {
+		return 0
+	}
+
+	count, err := app.notifications.UnreadCount(r.Context(), userID)
+	if err != nil {
+		app.requestLogger(r).Error("counting unread notifications", "user_id", userID, "error", err)
+		return 0
+	}
+
+	return count
+}
+
+// publishSnippetEvent() sends a webhook event carrying the current state of a
+// snippet, and pushes new snippets to the live stream. The snippet is looked up
+// again so the payload matches what is in the database, errors are only logged
+// because the change itself has already been made.
+func (app *application) publishSnippetEvent(r *http.Request, event string, id int) {
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		app.requestLogger(r).Error("loading snippet for webhook event", "snippet_id", id, "event", event, "error", err)
+		return
+	}
+
+	if event == models.EventSnippetCreated {
+		app.live.Publish(liveSnippetCreated, newLiveSnippet(snippet))
+	}
+
+	if app.config.Features.Webhooks {
+		app.webhooks.Publish(snippet.UserID, event, snippet)
+	}
+}
+
+// newWebhookSecret() generates a random secret for signing webhook deliveries.
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// readIDParam() reads the ":id" route parameter from the request context and
+// returns an error if it is missing or not a positive integer.
+func (app *application) readIDParam(r *http.Request) (int, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid id parameter")
+	}
+
+	return id, nil
+}
+
+// listParams holds the query string options shared by the snippet listings.
+type listParams struct {
+	Sort   string
+	Limit  int
+	Cursor string
+}
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+// readListParams() reads the sort, limit and cursor query parameters for a
+// snippet listing, falling back to the newest 10 snippets. It writes a 400
+// response and returns false if any of them are invalid.
+func (app *application) readListParams(w http.ResponseWriter, r *http.Request) (listParams, bool) {
+	query := r.URL.Query()
+
+	params := listParams{
+		Sort:   query.Get("sort"),
+		Limit:  defaultPageSize,
+		Cursor: query.Get("cursor"),
+	}
+
+	if params.Sort == "" {
+		params.Sort = models.SortNewest
+	}
+
+	if !models.IsValidSort(params.Sort) {
+		app.clientError(w, http.StatusBadRequest)
+		return params, false
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxPageSize {
+			app.clientError(w, http.StatusBadRequest)
+			return params, false
+		}
+		params.Limit = n
+	}
+
+	return params, true
+}
+
+// writeJSON() encodes data as the JSON response body with the given status code.
+func (app *application) writeJSON(w http.ResponseWriter, r *http.Request, status int, data any) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
 // The second parameter here, destination, is the target destination that we want
 // to decode the form data into.
 func (app *application) decodePostForm(r *http.Request, destination any) error {
@@ -42,13 +176,28 @@ func (app *application) decodePostForm(r *http.Request, destination any) error {
 	return nil
 }
 
-func (app *application) render(w http.ResponseWriter, pageName string, data *templateData, statusCode int) {
-	tmplSet, ok := app.templateCache[pageName]
+func (app *application) render(w http.ResponseWriter, r *http.Request, pageName string, data *templateData, statusCode int) {
+	templateCache := app.templateCache
+
+	// in -dev mode the templates are parsed again on every request, so edits
+	// show up without a restart.
+	if app.config.Dev {
+		var err error
+		templateCache, err = newTemplateCache(app.ui, app.static)
+		if err != nil {
+			app.metrics.renderErrors.WithLabelValues(pageName).Inc()
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	tmplSet, ok := templateCache[pageName]
 
 	if !ok {
 		// the page tempalte is not in the map
 		err := fmt.Errorf("%s not found in template cache\n", pageName)
-		app.serverError(w, err)
+		app.metrics.renderErrors.WithLabelValues(pageName).Inc()
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -69,7 +218,8 @@ func (app *application) render(w http.ResponseWriter, pageName string, data *tem
 	// the http.ResponseWriter
 	err := tmplSet.ExecuteTemplate(buf, "base", data)
 	if err != nil {
-		app.serverError(w, err)
+		app.metrics.renderErrors.WithLabelValues(pageName).Inc()
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -80,18 +230,52 @@ func (app *application) render(w http.ResponseWriter, pageName string, data *tem
 	buf.WriteTo(w)
 }
 
-func (app *application) serverError(w http.ResponseWriter, err error) {
-	// debug.Stack() returns the stack trace of the error.
-	msg := fmt.Sprintf("%s\n%s\n", err.Error(), debug.Stack())
+func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	// the handler may have already set the caching headers for the page it
+	// meant to send, they don't apply to the error.
+	w.Header().Del("ETag")
+	w.Header().Del("Last-Modified")
+	w.Header().Set("Cache-Control", "no-store")
 
-	// log the error using our customer logger.
-	// Output(2, msg) says go down 2 on the stack trace
-	// to display where the serverError helper was called
-	// not where it was logged i.e right here.
-	app.errLog.Output(2, msg)
+	// a database that is down or too slow isn't a bug, so it gets a 503 and
+	// the client can try again.
+	if errors.Is(err, models.ErrTimeout) || errors.Is(err, models.ErrUnavailable) || errors.Is(err, context.DeadlineExceeded) {
+		app.requestLogger(r).Warn("database unavailable", "method", r.Method, "uri", r.URL.RequestURI(), "error", err)
 
-	// send a 500 http error back to the user
-	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		w.Header().Set("Retry-After", "5")
+		msg := fmt.Sprintf("Service Unavailable, please try again shortly (request ID %s)", requestID(r))
+		http.Error(w, msg, http.StatusServiceUnavailable)
+		return
+	}
+
+	// log the error along with the request it happened on. debug.Stack()
+	// returns the stack trace, so we can see where serverError was called from.
+	app.requestLogger(r).Error(err.Error(),
+		"method", r.Method,
+		"uri", r.URL.RequestURI(),
+		"trace", string(debug.Stack()),
+	)
+
+	// send a 500 http error back to the user, with the request ID so a bug report
+	// can be matched up with the log line.
+	msg := fmt.Sprintf("Internal Server Error (request ID %s)", requestID(r))
+	http.Error(w, msg, http.StatusInternalServerError)
+}
+
+// modelError() sends the response for an error from one of the models: a 404
+// for a record that doesn't exist, a 409 for a write the database refused, and
+// a 503 when the database is down or too slow (see serverError()). Anything
+// else is a 500.
+func (app *application) modelError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, models.ErrNoRecord):
+		app.clientError(w, http.StatusNotFound)
+	case errors.Is(err, models.ErrConstraint):
+		app.requestLogger(r).Warn("database refused a write", "method", r.Method, "uri", r.URL.RequestURI(), "error", err)
+		app.clientError(w, http.StatusConflict)
+	default:
+		app.serverError(w, r, err)
+	}
 }
 
 // Will make this return custom error messages later.
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+func TestModelError(t *testing.T) {
+	app, _ := newTestApplication(t)
+
+	tests := []struct {
+		name           string
+		err            error
+		wantCode       int
+		wantRetryAfter bool
+	}{
+		{"no record", models.ErrNoRecord, http.StatusNotFound, false},
+		{"wrapped no record", fmt.Errorf("getting snippet: %w", models.ErrNoRecord), http.StatusNotFound, false},
+		{"constraint", models.ErrConstraint, http.StatusConflict, false},
+		{"timeout", models.ErrTimeout, http.StatusServiceUnavailable, true},
+		{"unavailable", fmt.Errorf("%w: connection refused", models.ErrUnavailable), http.StatusServiceUnavailable, true},
+		{"deadline", context.DeadlineExceeded, http.StatusServiceUnavailable, true},
+		{"anything else", errors.New("boom"), http.StatusInternalServerError, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			// caching headers set for the page that was meant to be sent.
+			rr.Header().Set("ETag", `"abc"`)
+
+			app.modelError(rr, r, tt.err)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("got status %d, want %d", rr.Code, tt.wantCode)
+			}
+			if got := rr.Header().Get("Retry-After") != ""; got != tt.wantRetryAfter {
+				t.Errorf("got Retry-After %q, want one: %t", rr.Header().Get("Retry-After"), tt.wantRetryAfter)
+			}
+
+			if tt.wantCode >= 500 {
+				// the details stay in the log.
+				if strings.Contains(rr.Body.String(), tt.err.Error()) {
+					t.Errorf("body %q gives away the error", rr.Body.String())
+				}
+				if rr.Header().Get("ETag") != "" || rr.Header().Get("Cache-Control") != "no-store" {
+					t.Errorf("got ETag %q and Cache-Control %q on an error", rr.Header().Get("ETag"), rr.Header().Get("Cache-Control"))
+				}
+			}
+		})
+	}
+}
+
+// failingSnippets is a snippet store whose GetMany() always fails.
+type failingSnippets struct {
+	models.SnippetModelInterface
+	err error
+}
+
+func (s failingSnippets) GetMany(context.Context, []int) ([]models.Snippet, error) {
+	return nil, s.err
+}
+
+func TestSnippetArchiveModelError(t *testing.T) {
+	tests := []struct {
+		err      error
+		wantCode int
+	}{
+		{models.ErrTimeout, http.StatusServiceUnavailable},
+		{models.ErrUnavailable, http.StatusServiceUnavailable},
+		{models.ErrNoRecord, http.StatusNotFound},
+		{errors.New("boom"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		app, m := newTestApplication(t)
+		app.snippets = failingSnippets{m.snippets, tt.err}
+		ts := newTestServer(t, app.routes())
+
+		if res := ts.get(t, "/snippet/archive?id=1"); res.status != tt.wantCode {
+			t.Errorf("%v: got %d, want %d", tt.err, res.status, tt.wantCode)
+		}
+	}
+}
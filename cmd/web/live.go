@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+// events sent down the /events stream, see ui/static/js/main.js for the other
+// end.
+const (
+	liveSnippetCreated = "snippet" // a new snippet, as a liveSnippet
+	liveViews          = "views"   // a snippet's view count changed, as a liveCount
+	liveStars          = "stars"   // a snippet's star count changed, as a liveCount
+)
+
+// liveHeartbeat is how often an idle stream gets a comment line, so proxies
+// don't close it for inactivity and we notice clients that have gone away.
+const liveHeartbeat = 30 * time.Second
+
+// liveSnippet is what the home page needs to add a row for a new snippet.
+// Created is preformatted with humanDate so the row matches the server
+// rendered ones.
+type liveSnippet struct {
+	ID      int    `json:"id"`
+	Title   string `json:"title"`
+	Created string `json:"created"`
+	Views   int64  `json:"views"`
+}
+
+type liveCount struct {
+	ID    int   `json:"id"`
+	Count int64 `json:"count"`
+}
+
+func newLiveSnippet(snippet *models.Snippet) liveSnippet {
+	return liveSnippet{
+		ID:      snippet.ID,
+		Title:   snippet.Title,
+		Created: humanReadableDate(snippet.Created),
+		Views:   snippet.Views,
+	}
+}
+
+// publishStarCount() sends the current star count of a snippet to the live
+// stream. The star has already been saved, so errors are only logged.
+func (app *application) publishStarCount(r *http.Request, snippetID int) {
+	count, err := app.stars.Count(r.Context(), snippetID)
+	if err != nil {
+		app.requestLogger(r).Error("counting stars for live update", "snippet_id", snippetID, "error", err)
+		return
+	}
+
+	app.live.Publish(liveStars, liveCount{ID: snippetID, Count: count})
+}
@@ -2,16 +2,27 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
+	"fmt"
 	"html/template"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
+	"sync/atomic"
 	"time"
 
-	"github.com/alexedwards/scs/pgxstore"
 	"github.com/alexedwards/scs/v2"
+	"github.com/corbinlazarone/snippetbox/internal/cache"
+	"github.com/corbinlazarone/snippetbox/internal/live"
+	"github.com/corbinlazarone/snippetbox/internal/migrations"
 	"github.com/corbinlazarone/snippetbox/internal/models"
+	"github.com/corbinlazarone/snippetbox/internal/ratelimit"
+	"github.com/corbinlazarone/snippetbox/internal/webhook"
+	"github.com/corbinlazarone/snippetbox/ui"
 	"github.com/go-playground/form/v4"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -19,90 +30,278 @@ import (
 // Struct to hold our resources that needs to be
 // shared across our app.
 type application struct {
-	errLog         *log.Logger                   // field to introduce a custom error logger
-	infoLog        *log.Logger                   // field to introduce a custom info logger
-	snippets       *models.SnippetModel          // used so our handlers.go can see our model
+	config         *config
+	logger         *slog.Logger                  // structured logger, see requestLogger() for logging inside a request
+	snippets       models.SnippetModelInterface  // used so our handlers.go can see our model
 	templateCache  map[string]*template.Template // holds our cached templates
+	ui             fs.FS                         // the ui directory, embedded or on disk in -dev mode
+	static         *staticFiles                  // serves ui/static with content hashed URLs
+	uiVersion      string                        // hash of the ui files, part of page ETags. Empty in -dev mode
 	formDecoder    *form.Decoder                 // used so our handerls.go can auto parse forms
 	sessionManager *scs.SessionManager
-	users          *models.UserModel
+	users          models.UserModelInterface
+	views          models.ViewModelInterface
+	stars          models.StarModelInterface
+	comments       models.CommentModelInterface
+	webhookStore   models.WebhookModelInterface
+	notifications  models.NotificationModelInterface
+	viewCounter    *viewCounter        // buffers snippet views between flushes
+	webhooks       *webhook.Dispatcher // delivers snippet events in the background
+	expiryWatcher  *expiryWatcher      // nil when webhooks are switched off
+	notifier       *notifier           // writes notifications in the background
+	live           *live.Hub           // pushes updates to the /events stream
+	rateLimiter    ratelimit.Store     // token buckets for rateLimit()
+	trustedProxies []netip.Prefix      // proxies whose X-Forwarded-For we believe, see clientIP()
+	metrics        *metrics
+	db             pinger      // only used by /readyz
+	shuttingDown   atomic.Bool // set once we start shutting down, fails /readyz
+}
+
+// pinger checks the database is reachable, *pgxpool.Pool satisfies it and
+// pingFunc adapts a *sql.DB.
+type pinger interface {
+	Ping(ctx context.Context) error
 }
 
 func main() {
-	// we can easily change the port at runtime with the -port flag
-	port := flag.String("port", ":4000", "HTTP server port number")
+	// the migrate subcommand manages the database schema instead of starting
+	// the server, see migrate.go.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// settings come from the defaults, an optional config file, the
+	// environment and the flags, see config.go.
+	cfg, printOnly, err := loadConfig(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config:\n%s\n", err)
+		os.Exit(2)
+	}
+
+	if printOnly {
+		if err := printConfig(os.Stdout, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// we can easily change databases at runtime with the -db flag
-	datasource := flag.String("db", "YOUR_DB_URL", "my postgres db url")
+	logger, err := newLogger(cfg.LogFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	flag.Parse()
+	// the templates and static files are embedded in the binary, unless we are
+	// in -dev mode and want to see edits without rebuilding.
+	var uiFiles fs.FS = ui.Files
+	if cfg.Dev {
+		uiFiles = os.DirFS("./ui")
+		logger.Warn("dev mode: serving ./ui from disk and parsing templates on every request")
+	}
+
+	staticFS, err := fs.Sub(uiFiles, "static")
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	static, err := newStaticFiles(staticFS, !cfg.Dev)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
 
-	// info and error logging
-	infoLog := log.New(os.Stdout, "INFO:\t", log.Ldate|log.Ltime|log.Lshortfile)
-	errLog := log.New(os.Stderr, "ERROR:\t", log.Ldate|log.Ltime|log.Lshortfile)
+	// pages rendered by an older build must not match ETags from this one.
+	var uiVersion string
+	if !cfg.Dev {
+		uiVersion, err = hashFS(uiFiles)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
 
 	// initialize a new tempalte cache
-	templateCache, err := newTemplateCache()
+	templateCache, err := newTemplateCache(uiFiles, static)
 	if err != nil {
-		errLog.Fatal(err) // log the error with customer logger and kill the program
+		logger.Error(err.Error()) // log the error and kill the program
+		os.Exit(1)
+	}
+
+	// Initialize a tls.Config struct to hold the non-default TLS settings we
+	// want the server to use. Real certificates are reloaded from disk when
+	// they change, see certReloader.
+	var tlsConfig *tls.Config
+	var certs *certReloader
+
+	switch {
+	case cfg.TLSCert != "":
+		certs, err = newCertReloader(cfg.TLSCert, cfg.TLSKey, logger, time.Minute)
+		if err != nil {
+			logger.Error("loading the TLS certificate", "error", err)
+			os.Exit(1)
+		}
+		tlsConfig = newTLSConfig(certs.GetCertificate)
+	case cfg.TLSSelfSigned:
+		cert, err := selfSignedCertificate()
+		if err != nil {
+			logger.Error("generating a self-signed certificate", "error", err)
+			os.Exit(1)
+		}
+		tlsConfig = newTLSConfig(func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return cert, nil })
+		logger.Warn("serving HTTPS with a self-signed certificate, this is for development only")
+	case cfg.SessionCookieSecure:
+		// NOTE: browsers won't send a Secure cookie back over plain HTTP, so
+		// nobody can stay logged in unless something in front of us does HTTPS.
+		logger.Warn("serving plain HTTP with secure session cookies, logins only work behind an HTTPS proxy")
 	}
 
-	db, err := openDB(*datasource)
+	// the db setting picks the backend, postgres or a SQLite file, see storage.go.
+	store, err := openStorage(cfg.DB, cfg.QueryTimeout)
 	if err != nil {
-		errLog.Fatal(err)
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
 
-	defer db.Close() // make sure the db connection is closed right after opening it.
+	// bring the schema up to date before anything touches the database, or
+	// warn that it's behind.
+	if err := migrateOnStart(store, logger, cfg.AutoMigrate); err != nil {
+		logger.Error(err.Error())
+		store.close()
+		os.Exit(1)
+	}
 
 	// Initialze a new decoder instance.
 	formDecoder := form.NewDecoder()
 
-	// Initialize a new session manager with scs.New(), then configured it to use our Postgresql database
-	// as the session store, and set a lifetime of 12 hours.
+	// Initialize a new session manager with scs.New(), then configured it to use our database
+	// as the session store, and set its lifetime (12 hours by default).
 	sessionManager := scs.New()
-	sessionManager.Store = pgxstore.New(db)
-	sessionManager.Lifetime = 12 * time.Hour
+	metrics := newMetrics(store.pool)
+	// NOTE: Store is the scs.Store interface, tests can swap in scs's memstore.
+	sessionManager.Store = &instrumentedStore{Store: store.newSessionStore(), metrics: metrics}
+	sessionManager.Lifetime = cfg.SessionLifetime
 
 	// Cookie will only be sent by a user's web browser when a
 	// HTTPS connection is being used. (Will not be send over
-	// and HTTP connection).
-	sessionManager.Cookie.Secure = true
+	// and HTTP connection). Can be turned off for local development.
+	sessionManager.Cookie.Secure = cfg.SessionCookieSecure
+
+	webhooks := webhook.New(store.webhooks, logger, webhook.Config{})
+
+	// popular snippets and the listings are served from memory rather than
+	// costing a query on every hit, see the cache package.
+	var snippets models.SnippetModelInterface = store.snippets
+	if cfg.CacheSize > 0 {
+		cached := cache.NewSnippetModel(store.snippets,
+			cache.NewLRU[models.Snippet](cfg.CacheSize), cache.NewLRU[models.SnippetPage](cfg.CacheSize), cfg.CacheTTL)
+		metrics.registry.MustRegister(newCacheCollector(cached))
+		snippets = cached
+	}
+
+	// validate() has already checked this parses.
+	trustedProxies, _ := parseTrustedProxies(cfg.TrustedProxies)
 
 	app := &application{
-		errLog:  errLog,
-		infoLog: infoLog,
-		snippets: &models.SnippetModel{
-			DB: db,
-		},
+		config:         cfg,
+		logger:         logger,
+		snippets:       snippets,
 		templateCache:  templateCache,
+		ui:             uiFiles,
+		static:         static,
+		uiVersion:      uiVersion,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
-		users: &models.UserModel{
-			DB: db,
-		},
+		users:          store.users,
+		views:          store.views,
+		stars:          store.stars,
+		comments:       store.comments,
+		webhookStore:   store.webhooks,
+		notifications:  store.notifications,
+		viewCounter:    newViewCounter(store.views, logger, 10*time.Second),
+		webhooks:       webhooks,
+		notifier:       newNotifier(store.notifications, snippets, store.comments, logger, 1000),
+		live:           live.NewHub(logger),
+		metrics:        metrics,
+		db:             store.db,
+		rateLimiter:    ratelimit.NewMemoryStore(5 * time.Minute),
+		trustedProxies: trustedProxies,
 	}
 
-	// Initialize a tls.Config struct to hold the non-default TLS settings we
-	// want the server to use. In this case the only thing that we're changing
-	// is the curve preferences value, so that only elliptic curves with
-	// assembly implementations are used.
-	// tlsConfig := &tls.Config{
-	// 	CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
-	// }
+	// the expiry watcher only exists to send the snippet.expired webhook event.
+	if cfg.Features.Webhooks {
+		app.expiryWatcher = newExpiryWatcher(snippets, webhooks, logger, time.Minute)
+		go app.expiryWatcher.Run()
+	}
+
+	go app.viewCounter.Run()
+	go app.notifier.Run()
+	app.webhooks.Start()
 
 	srv := &http.Server{
-		Addr:     *port,
-		Handler:  app.routes(),
-		ErrorLog: errLog,
-		// TLSConfig:    tlsConfig,
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-	}
-
-	infoLog.Printf("Server running on %s...\n", *port)
-	err = srv.ListenAndServe()
-	errLog.Fatal(err)
+		Addr:         cfg.Port,
+		Handler:      app.routes(),
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
+		TLSConfig:    tlsConfig,
+		IdleTimeout:  cfg.IdleTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout, // cleared for the /events stream, see liveEvents()
+	}
+
+	// end the /events streams when shutting down, otherwise Shutdown() would
+	// wait on them until it times out.
+	srv.RegisterOnShutdown(app.live.Close)
+
+	if certs != nil {
+		go certs.Run()
+	}
+
+	var redirectSrv *http.Server
+	if cfg.TLSRedirectAddr != "" {
+		redirectSrv = app.serveRedirect(cfg.TLSRedirectAddr, cfg.Port)
+	}
+
+	var metricsSrv *http.Server
+	if cfg.MetricsAddr != "" {
+		metricsSrv = app.serveMetrics(cfg.MetricsAddr)
+	}
+
+	// stop taking requests on SIGINT/SIGTERM, then shut everything else down
+	// and close the database last, whether or not the server stopped cleanly.
+	serveErr := app.serve(srv, cfg.DrainTimeout)
+	if serveErr != nil {
+		logger.Error(serveErr.Error())
+	}
+
+	if redirectSrv != nil {
+		logger.Info("stopping the redirect server")
+		redirectSrv.Close()
+	}
+
+	if certs != nil {
+		certs.Stop()
+	}
+
+	app.stopBackground(cfg.DrainTimeout)
+
+	// the metrics stay up until now so the drain can be watched.
+	if metricsSrv != nil {
+		logger.Info("stopping metrics server")
+		metricsSrv.Close()
+	}
+
+	logger.Info("closing database connections")
+	store.close()
+
+	if serveErr != nil {
+		os.Exit(1)
+	}
+
+	logger.Info("server stopped")
 }
 
 func openDB(dataSource string) (*pgxpool.Pool, error) {
@@ -120,3 +319,50 @@ func openDB(dataSource string) (*pgxpool.Pool, error) {
 
 	return conn, nil
 }
+
+// migrateOnStart() applies any pending migrations when apply is true. When it
+// isn't, pending migrations are only logged, the server still starts.
+func migrateOnStart(store *storage, logger *slog.Logger, apply bool) error {
+	migrator, err := migrations.New(store.sqlDB, store.dialect, logger)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	if apply {
+		_, err := migrator.Up(ctx)
+		return err
+	}
+
+	// NOTE: a database user with only the privileges the app needs may not be
+	// able to create schema_migrations, that's not worth refusing to start over.
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		logger.Warn("checking for pending migrations", "error", err)
+		return nil
+	}
+
+	if pending > 0 {
+		logger.Warn("the database schema is out of date, run migrate up or start with -auto-migrate", "pending_migrations", pending)
+	}
+
+	return nil
+}
+
+// newLogger() creates the application logger, writing text or JSON lines to
+// stdout depending on format.
+func newLogger(format string) (*slog.Logger, error) {
+	var handler slog.Handler
+
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stdout, nil)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stdout, nil)
+	default:
+		return nil, fmt.Errorf("unknown log format %q, use text or json", format)
+	}
+
+	return slog.New(handler), nil
+}
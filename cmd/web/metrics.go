@@ -0,0 +1,213 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/corbinlazarone/snippetbox/internal/cache"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// unmatchedRoute labels requests that didn't match any route (404s and 405s),
+// so random paths don't each get their own time series.
+const unmatchedRoute = "unmatched"
+
+// metrics holds the Prometheus metrics we export on the metrics listener.
+type metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	sessionStore    *prometheus.CounterVec
+	snippetsCreated prometheus.Counter
+	renderErrors    *prometheus.CounterVec
+	rateLimited     *prometheus.CounterVec
+}
+
+func newMetrics(db *pgxpool.Pool) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snippetbox_http_requests_total",
+			Help: "HTTP requests handled, by route pattern, method and response status.",
+		}, []string{"route", "method", "status"}),
+
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "snippetbox_http_request_duration_seconds",
+			Help:    "How long HTTP requests took to handle, by route pattern and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+
+		sessionStore: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snippetbox_session_store_operations_total",
+			Help: "Session store operations, by operation and whether they failed.",
+		}, []string{"operation", "result"}),
+
+		snippetsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "snippetbox_snippets_created_total",
+			Help: "Snippets created.",
+		}),
+
+		renderErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snippetbox_template_render_errors_total",
+			Help: "Pages that failed to render, by page template.",
+		}, []string{"page"}),
+
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snippetbox_rate_limited_requests_total",
+			Help: "Requests turned away with a 429, by rate limit group.",
+		}, []string{"group"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.sessionStore,
+		m.snippetsCreated,
+		m.renderErrors,
+		m.rateLimited,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	// db is nil when the app runs against the in-memory models, e.g. in tests.
+	if db != nil {
+		m.registry.MustRegister(newPoolCollector(db))
+	}
+
+	return m
+}
+
+// handler() serves the metrics in the Prometheus text format.
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// observeRequest() records a handled request. route is the pattern the request
+// matched, e.g. /snippet/view/:id, or empty if it didn't match one.
+func (m *metrics) observeRequest(route, method string, status int, duration time.Duration) {
+	if route == "" {
+		route = unmatchedRoute
+	}
+
+	m.requests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	m.requestDuration.WithLabelValues(route, method).Observe(duration.Seconds())
+}
+
+// poolCollector reports the pgxpool statistics. The numbers are read from
+// the pool when Prometheus scrapes us, rather than being kept up to date as
+// they change.
+type poolCollector struct {
+	db *pgxpool.Pool
+
+	acquired        *prometheus.Desc
+	idle            *prometheus.Desc
+	total           *prometheus.Desc
+	max             *prometheus.Desc
+	acquires        *prometheus.Desc
+	emptyAcquires   *prometheus.Desc
+	acquireDuration *prometheus.Desc
+}
+
+func newPoolCollector(db *pgxpool.Pool) *poolCollector {
+	return &poolCollector{
+		db:              db,
+		acquired:        prometheus.NewDesc("snippetbox_db_pool_acquired_connections", "Connections currently in use.", nil, nil),
+		idle:            prometheus.NewDesc("snippetbox_db_pool_idle_connections", "Connections currently idle in the pool.", nil, nil),
+		total:           prometheus.NewDesc("snippetbox_db_pool_connections", "Connections currently open, in use or idle.", nil, nil),
+		max:             prometheus.NewDesc("snippetbox_db_pool_max_connections", "The most connections the pool will open.", nil, nil),
+		acquires:        prometheus.NewDesc("snippetbox_db_pool_acquires_total", "Connections acquired from the pool.", nil, nil),
+		emptyAcquires:   prometheus.NewDesc("snippetbox_db_pool_empty_acquires_total", "Acquires that had to wait for a connection because none were idle.", nil, nil),
+		acquireDuration: prometheus.NewDesc("snippetbox_db_pool_acquire_wait_seconds_total", "Total time spent waiting to acquire a connection.", nil, nil),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.db.Stat()
+
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
+
+// cacheCollector reports the snippet cache's statistics, read when Prometheus
+// scrapes us like the pool statistics.
+type cacheCollector struct {
+	cache *cache.SnippetModel
+
+	hits      *prometheus.Desc
+	misses    *prometheus.Desc
+	coalesced *prometheus.Desc
+	entries   *prometheus.Desc
+}
+
+func newCacheCollector(c *cache.SnippetModel) *cacheCollector {
+	return &cacheCollector{
+		cache:     c,
+		hits:      prometheus.NewDesc("snippetbox_snippet_cache_hits_total", "Snippet and listing reads answered from the cache.", nil, nil),
+		misses:    prometheus.NewDesc("snippetbox_snippet_cache_misses_total", "Snippet and listing reads that went to the database.", nil, nil),
+		coalesced: prometheus.NewDesc("snippetbox_snippet_cache_coalesced_total", "Misses that shared a database query with another miss.", nil, nil),
+		entries:   prometheus.NewDesc("snippetbox_snippet_cache_entries", "Values in the cache, by kind.", []string{"kind"}, nil),
+	}
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cache.Stats()
+
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.coalesced, prometheus.CounterValue, float64(stats.Coalesced))
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(stats.Snippets), "snippet")
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(stats.Pages), "page")
+}
+
+// instrumentedStore wraps the session store to count its operations.
+type instrumentedStore struct {
+	scs.Store
+	metrics *metrics
+}
+
+func (s *instrumentedStore) Find(token string) ([]byte, bool, error) {
+	b, found, err := s.Store.Find(token)
+	s.observe("find", err)
+	return b, found, err
+}
+
+func (s *instrumentedStore) Commit(token string, b []byte, expiry time.Time) error {
+	err := s.Store.Commit(token, b, expiry)
+	s.observe("commit", err)
+	return err
+}
+
+func (s *instrumentedStore) Delete(token string) error {
+	err := s.Store.Delete(token)
+	s.observe("delete", err)
+	return err
+}
+
+func (s *instrumentedStore) observe(operation string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+
+	s.metrics.sessionStore.WithLabelValues(operation, result).Inc()
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 // Add secure headers to all incoming requests
@@ -15,6 +19,12 @@ func secureHeaders(next http.Handler) http.Handler {
 		w.Header().Set("X-Frame-Options", "deny")
 		w.Header().Set("X-XSS-Protection", "0")
 
+		// tell browsers to only ever use HTTPS with us from now on. It is only
+		// sent over HTTPS, browsers ignore it over plain HTTP anyway.
+		if r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+		}
+
 		// NOTE: Any code here will execute on the way down the chain.
 		// Any early returns will break the chain.
 
@@ -24,10 +34,120 @@ func secureHeaders(next http.Handler) http.Handler {
 	})
 }
 
-// Will log the IP address, URL, and http method of the user for every incoming request
+// maxRequestIDLength caps the X-Request-ID we accept from clients, so a
+// client can't stuff arbitrary junk into our logs.
+const maxRequestIDLength = 64
+
+// Gives every request an ID, which is added to every log line written while
+// handling it and sent back in the X-Request-ID response header. An ID sent by
+// the client (or a proxy in front of us) in X-Request-ID is kept, so requests
+// can be traced across services.
+func assignRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b) // never returns an error
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder wraps a http.ResponseWriter to remember the status code and
+// how many bytes were written, for the access log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += n
+	return n, err
+}
+
+// NOTE: Unwrap() lets http.ResponseController get at the real ResponseWriter,
+// the /events stream needs it to flush and to clear its write deadline.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// Writes an access log line for every request once it has been handled: the
+// method, URL, status code, bytes written, how long it took and who made it.
+// The same numbers go to the request metrics.
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.infoLog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL.RequestURI())
+		start := time.Now()
+
+		info := &requestInfo{}
+		ctx := context.WithValue(r.Context(), requestInfoContextKey, info)
+
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sr, r.WithContext(ctx))
+
+		// nothing was written, so net/http sends a 200 with an empty body.
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+
+		duration := time.Since(start)
+		app.metrics.observeRequest(info.route, r.Method, sr.status, duration)
+
+		app.requestLogger(r).Info("request",
+			"remote_addr", r.RemoteAddr,
+			"proto", r.Proto,
+			"method", r.Method,
+			"uri", r.URL.RequestURI(),
+			"status", sr.status,
+			"bytes", sr.bytes,
+			"route", info.route,
+			"duration", duration,
+			"user_id", info.userID,
+		)
+	})
+}
+
+// Records the logged in user for the access log. It has to come after
+// LoadAndSave() in the chain, since that is what loads the session.
+func (app *application) recordUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok {
+			info.userID = app.authenticatedUserID(r)
+		}
 
 		next.ServeHTTP(w, r)
 	})
@@ -50,7 +170,7 @@ func (app *application) recoverFromPanic(next http.Handler) http.Handler {
 				w.Header().Set("Connetion", "close")
 
 				// show a 500 server error to the user
-				app.serverError(w, fmt.Errorf("%s", err))
+				app.serverError(w, r, fmt.Errorf("%s", err))
 			}
 		}()
 
@@ -69,9 +189,11 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 			return
 		}
 
-		// Otherwise set the "Cache-Control: no-store" header so that pages that require
-		// authentication will not be cached by the browser.
-		w.Header().Add("Cache-Control", "no-cache")
+		// Otherwise mark the page private, so shared caches never keep a page
+		// meant for one user, and no-cache, so the browser checks back before
+		// showing its copy again. It is Set rather than Add so a handler can
+		// replace it with something more specific.
+		w.Header().Set("Cache-Control", "private, no-cache")
 
 		// And call the next handler in the chain
 		next.ServeHTTP(w, r)
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/migrations"
+)
+
+const migrateUsage = `usage:
+  snippetbox migrate up [settings]         apply every pending migration
+  snippetbox migrate down [n] [settings]   roll back the last n migrations (default 1)
+  snippetbox migrate status [settings]     list migrations and whether they are applied
+  snippetbox migrate create <name>         add empty up and down files for every database
+                                           to ` + migrations.Dir + `
+
+settings are the same as the server's, e.g. -db or SNIPPETBOX_DB.
+`
+
+// runMigrate() runs the migrate subcommand and returns the exit code.
+func runMigrate(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, migrateUsage)
+		return 2
+	}
+
+	command, args := args[0], args[1:]
+
+	// create only writes files, so it doesn't need a config or a database.
+	if command == "create" {
+		if len(args) != 1 {
+			fmt.Fprint(stderr, migrateUsage)
+			return 2
+		}
+
+		paths, err := migrations.Create(migrations.Dir, args[0])
+		for _, path := range paths {
+			fmt.Fprintf(stdout, "created %s\n", path)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+
+		return 0
+	}
+
+	steps := 1
+	if command == "down" && len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			if n < 1 {
+				fmt.Fprintln(stderr, "migrate down: n must be at least 1")
+				return 2
+			}
+			steps, args = n, args[1:]
+		}
+	}
+
+	if command != "up" && command != "down" && command != "status" {
+		fmt.Fprintf(stderr, "unknown migrate command %q\n\n%s", command, migrateUsage)
+		return 2
+	}
+
+	cfg, _, err := loadConfig(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid config:\n%s\n", err)
+		return 2
+	}
+
+	logger, err := newLogger(cfg.LogFormat)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	store, err := openStorage(cfg.DB, cfg.QueryTimeout)
+	if err != nil {
+		logger.Error(err.Error())
+		return 1
+	}
+	defer store.close()
+
+	migrator, err := migrations.New(store.sqlDB, store.dialect, logger)
+	if err != nil {
+		logger.Error(err.Error())
+		return 1
+	}
+
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			logger.Error(err.Error())
+			return 1
+		}
+		logger.Info("migrations applied", "count", len(applied))
+	case "down":
+		rolledBack, err := migrator.Down(ctx, steps)
+		if err != nil {
+			logger.Error(err.Error())
+			return 1
+		}
+		logger.Info("migrations rolled back", "count", len(rolledBack))
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			logger.Error(err.Error())
+			return 1
+		}
+		printMigrationStatus(stdout, statuses)
+	}
+
+	return 0
+}
+
+func printMigrationStatus(w io.Writer, statuses []migrations.Status) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+
+	for _, s := range statuses {
+		applied := "pending"
+		if !s.Applied.IsZero() {
+			applied = s.Applied.Format(time.RFC3339)
+		}
+		if s.Missing {
+			applied += " (not in this binary)"
+		}
+
+		fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+
+	tw.Flush()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+	"github.com/corbinlazarone/snippetbox/internal/worker"
+)
+
+// activity is something a user did that might notify other users.
+type activity struct {
+	kind      string // models.NotifyStar or models.NotifyComment
+	actorID   int
+	snippetID int
+	commentID int
+}
+
+// notifier writes in-app notifications on a background goroutine, so starring
+// or commenting on a snippet doesn't wait on working out who to notify and
+// writing the notifications.
+//
+// NOTE: like the view counter, anything still queued is lost if the process is
+// killed. Stop() writes whatever is left on a normal shutdown.
+type notifier struct {
+	notifications models.NotificationModelInterface
+	snippets      models.SnippetModelInterface
+	comments      models.CommentModelInterface
+	logger        *slog.Logger
+
+	queue chan activity
+	done  chan struct{}
+
+	mu      sync.RWMutex
+	stopped bool
+}
+
+func newNotifier(notifications models.NotificationModelInterface, snippets models.SnippetModelInterface, comments models.CommentModelInterface, logger *slog.Logger, queueSize int) *notifier {
+	return &notifier{
+		notifications: notifications,
+		snippets:      snippets,
+		comments:      comments,
+		logger:        logger,
+		queue:         make(chan activity, queueSize),
+		done:          make(chan struct{}),
+	}
+}
+
+// Notify() queues an activity. It never blocks the caller: when the queue is
+// full the activity is dropped and logged.
+func (n *notifier) Notify(kind string, actorID, snippetID, commentID int) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.stopped {
+		return
+	}
+
+	select {
+	case n.queue <- activity{kind: kind, actorID: actorID, snippetID: snippetID, commentID: commentID}:
+	default:
+		n.logger.Warn("notifier queue full, dropping activity", "kind", kind, "snippet_id", snippetID)
+	}
+}
+
+// Run() writes notifications until Stop() is called. It is meant to be started
+// in its own goroutine.
+func (n *notifier) Run() {
+	defer close(n.done)
+
+	for a := range n.queue {
+		n.write(a)
+	}
+}
+
+// Stop() stops accepting activities and waits for the queued ones to be written.
+func (n *notifier) Stop() {
+	n.mu.Lock()
+	if !n.stopped {
+		n.stopped = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+
+	<-n.done
+}
+
+// write() works out who an activity concerns and notifies them. The owner of
+// the snippet hears about stars and comments, and the author of a comment hears
+// about replies to it.
+func (n *notifier) write(a activity) {
+	defer worker.Recover(n.logger, "notifier")
+
+	snippet, err := n.snippets.Get(context.Background(), a.snippetID)
+	if err != nil {
+		n.logger.Error("loading snippet to notify about", "snippet_id", a.snippetID, "error", err)
+		return
+	}
+
+	// the owner gets the comment notification unless they are also the author
+	// of the comment being replied to, in which case the reply covers it.
+	notifyOwner := snippet.UserID != 0
+
+	if a.kind == models.NotifyComment {
+		comment, err := n.comments.Get(context.Background(), a.commentID)
+		if err != nil {
+			n.logger.Error("loading comment to notify about", "comment_id", a.commentID, "error", err)
+			return
+		}
+
+		if comment.ParentID != 0 {
+			parent, err := n.comments.Get(context.Background(), comment.ParentID)
+			if err != nil {
+				n.logger.Error("loading comment to notify about", "comment_id", comment.ParentID, "error", err)
+				return
+			}
+
+			n.insert(parent.UserID, a.actorID, models.NotifyReply, a.snippetID, a.commentID)
+			notifyOwner = notifyOwner && parent.UserID != snippet.UserID
+		}
+	}
+
+	if notifyOwner {
+		n.insert(snippet.UserID, a.actorID, a.kind, a.snippetID, a.commentID)
+	}
+}
+
+func (n *notifier) insert(userID, actorID int, kind string, snippetID, commentID int) {
+	_, err := n.notifications.Insert(context.Background(), userID, actorID, kind, snippetID, commentID)
+	if err != nil {
+		n.logger.Error("adding notification", "kind", kind, "user_id", userID, "error", err)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/corbinlazarone/snippetbox/internal/ratelimit"
+	"github.com/justinas/alice"
+)
+
+// rateLimit() returns middleware that lets each client make limit's requests to
+// a group of routes, and answers the rest with a 429. Each group has its own
+// buckets. Logged in users are told apart by their user ID and everyone else
+// by their IP address, so it has to come after LoadAndSave() in the chain.
+func (app *application) rateLimit(group string, limit ratelimit.Limit) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		if limit.Unlimited() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := group + "/" + app.rateLimitKey(r)
+
+			ok, retryAfter, err := app.rateLimiter.Take(r.Context(), key, limit)
+			if err != nil {
+				// NOTE: a store that is down lets everyone through, rather than
+				// taking the site down with it.
+				app.requestLogger(r).Error("rate limit store failed", "group", group, "error", err)
+			} else if !ok {
+				app.metrics.rateLimited.WithLabelValues(group).Inc()
+
+				w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(retryAfter.Seconds())))))
+				app.clientError(w, http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey() is who a request counts against: the user when logged in,
+// the client's address otherwise.
+func (app *application) rateLimitKey(r *http.Request) string {
+	if id := app.authenticatedUserID(r); id != 0 {
+		return fmt.Sprintf("user:%d", id)
+	}
+
+	ip := app.clientIP(r)
+	if !ip.IsValid() {
+		return "addr:" + r.RemoteAddr
+	}
+
+	// one IPv6 client usually has a whole /64 to pick addresses from.
+	if ip.Is6() {
+		return "ip:" + netip.PrefixFrom(ip, 64).Masked().String()
+	}
+
+	return "ip:" + ip.String()
+}
+
+// clientIP() returns the address the request came from. When that is one of
+// our trusted proxies, the client is the last address in X-Forwarded-For that
+// isn't a trusted proxy: each proxy appends the address it got the request
+// from, so anything to the left of that could have been made up by the client.
+func (app *application) clientIP(r *http.Request) netip.Addr {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+
+	ip := addrPort.Addr().Unmap()
+	if !app.trustedProxy(ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+
+		ip = hop.Unmap()
+		if !app.trustedProxy(ip) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func (app *application) trustedProxy(ip netip.Addr) bool {
+	for _, prefix := range app.trustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseTrustedProxies() parses the trusted-proxies setting, a comma separated
+// list of addresses and CIDR ranges, e.g. "10.0.0.0/8, 127.0.0.1".
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for item := range strings.SplitSeq(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		ip, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, err
+		}
+		ip = ip.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+	}
+
+	return prefixes, nil
+}
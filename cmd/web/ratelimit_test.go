@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	app, _ := newTestApplication(t)
+
+	trusted, err := parseTrustedProxies("10.0.0.0/8, 192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		trusted    bool // whether the proxies above are trusted
+		remoteAddr string
+		forwarded  []string // X-Forwarded-For headers
+		want       string
+	}{
+		{"direct", true, "203.0.113.7:1234", nil, "203.0.113.7"},
+		{"direct with a forwarded header", true, "203.0.113.7:1234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"no trusted proxies", false, "10.0.0.1:1234", []string{"198.51.100.1"}, "10.0.0.1"},
+		{"through a proxy", true, "10.0.0.1:1234", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"through a single address proxy", true, "192.0.2.1:1234", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"through two proxies", true, "10.0.0.1:1234", []string{"203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"client made up earlier hops", true, "10.0.0.1:1234", []string{"198.51.100.1, 203.0.113.7"}, "203.0.113.7"},
+		{"client made up a trusted hop", true, "10.0.0.1:1234", []string{"10.0.0.9, 203.0.113.7"}, "203.0.113.7"},
+		{"several headers", true, "10.0.0.1:1234", []string{"198.51.100.1", "203.0.113.7"}, "203.0.113.7"},
+		{"unparseable hop", true, "10.0.0.1:1234", []string{"203.0.113.7, nonsense"}, "10.0.0.1"},
+		{"proxy without a forwarded header", true, "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"mapped proxy address", true, "[::ffff:10.0.0.1]:1234", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"ipv6 client", true, "10.0.0.1:1234", []string{"2001:db8::1"}, "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app.trustedProxies = nil
+			if tt.trusted {
+				app.trustedProxies = trusted
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := app.clientIP(r); got != netip.MustParseAddr(tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRateLimitForwardedFor checks a client can't get a fresh bucket by
+// sending a different X-Forwarded-For with every request.
+func TestRateLimitForwardedFor(t *testing.T) {
+	tests := []struct {
+		name        string
+		trusted     string
+		wantLimited bool
+	}{
+		// the test server's client is 127.0.0.1.
+		{"untrusted client", "10.0.0.0/8", true},
+		{"trusted proxy", "127.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _ := newTestApplication(t)
+			app.config.RateLimitReads.Burst = 2
+
+			var err error
+			app.trustedProxies, err = parseTrustedProxies(tt.trusted)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ts := newTestServer(t, app.routes())
+
+			limited := false
+			for i := range 5 {
+				res := ts.get(t, "/user/login", "X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i+1))
+				limited = limited || res.status == http.StatusTooManyRequests
+			}
+
+			if limited != tt.wantLimited {
+				t.Errorf("got limited %t, want %t", limited, tt.wantLimited)
+			}
+		})
+	}
+}
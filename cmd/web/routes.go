@@ -10,36 +10,96 @@ import (
 func (app *application) routes() http.Handler {
 	router := httprouter.New()
 
+	// handle() registers a route, labelling its requests with the route pattern
+	// for the access log and the metrics.
+	handle := func(method, pattern string, handler http.Handler) {
+		router.Handler(method, pattern, labelRoute(pattern, handler))
+	}
+
 	// custom wrapper to make httprouter use our client error helper function
 	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		app.clientError(w, http.StatusNotFound)
 	})
 
 	// route for static files
-	fileServer := http.FileServer(http.Dir("./ui/static"))
-	router.Handler(http.MethodGet, "/static/*filepath", http.StripPrefix("/static", fileServer))
+	handle(http.MethodGet, "/static/*filepath", http.StripPrefix("/static", app.static))
+
+	// live updates. NOTE: this skips the session middleware on purpose,
+	// LoadAndSave() buffers the whole response so it can add the session cookie,
+	// which would hold the stream back forever.
+	if app.config.Features.LiveUpdates {
+		handle(http.MethodGet, "/events", http.HandlerFunc(app.liveEvents))
+	}
 
 	// LoadAndSave() automatically loads and saves session data with every
 	// HTTP request and response.
-	dynamic := alice.New(app.sessionManager.LoadAndSave)
+	dynamic := alice.New(app.sessionManager.LoadAndSave, app.recordUser)
 
-	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
-	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
-	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignUp))
-	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignUpPost))
-	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
-	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
+	// each group of routes has its own rate limit, see rateLimit(). Reads are
+	// the public pages, auth is signing up and logging in, and writes are
+	// everything a logged in user POSTs, apart from logging out.
+	reads := dynamic.Append(app.rateLimit("reads", app.config.RateLimitReads))
+	auth := dynamic.Append(app.rateLimit("auth", app.config.RateLimitAuth))
+
+	handle(http.MethodGet, "/", reads.ThenFunc(app.home))
+	handle(http.MethodGet, "/snippet/view/:id", reads.ThenFunc(app.snippetView))
+	handle(http.MethodGet, "/snippet/raw/:id", reads.ThenFunc(app.snippetRaw))
+	handle(http.MethodGet, "/snippet/download/:id", reads.ThenFunc(app.snippetDownload))
+	handle(http.MethodGet, "/snippet/archive", reads.ThenFunc(app.snippetArchive))
+	handle(http.MethodGet, "/snippet/archive/:id", reads.ThenFunc(app.snippetArchive))
+	handle(http.MethodGet, "/api/snippets", reads.ThenFunc(app.apiSnippetList))
+	handle(http.MethodGet, "/user/signup", reads.ThenFunc(app.userSignUp))
+	handle(http.MethodPost, "/user/signup", auth.ThenFunc(app.userSignUpPost))
+	handle(http.MethodGet, "/user/login", reads.ThenFunc(app.userLogin))
+	handle(http.MethodPost, "/user/login", auth.ThenFunc(app.userLoginPost))
 
 	// Protected (authenticated-only) application routes.
 	protected := dynamic.Append(app.requireAuthentication)
+	writes := protected.Append(app.rateLimit("writes", app.config.RateLimitWrites))
+
+	handle(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate))
+	handle(http.MethodPost, "/snippet/create", writes.ThenFunc(app.snippetCreatePost))
+	handle(http.MethodGet, "/snippet/edit/:id", protected.ThenFunc(app.snippetEdit))
+	handle(http.MethodPost, "/snippet/edit/:id", writes.ThenFunc(app.snippetEditPost))
+	handle(http.MethodPost, "/snippet/delete/:id", writes.ThenFunc(app.snippetDeletePost))
+	handle(http.MethodGet, "/snippet/stats/:id", protected.ThenFunc(app.snippetStats))
+	handle(http.MethodPost, "/snippet/star/:id", writes.ThenFunc(app.snippetStarPost))
+	handle(http.MethodPost, "/snippet/unstar/:id", writes.ThenFunc(app.snippetUnstarPost))
+	handle(http.MethodPost, "/snippet/comment/:id", writes.ThenFunc(app.commentCreatePost))
+	handle(http.MethodGet, "/comment/edit/:id", protected.ThenFunc(app.commentEdit))
+	handle(http.MethodPost, "/comment/edit/:id", writes.ThenFunc(app.commentEditPost))
+	handle(http.MethodPost, "/comment/delete/:id", writes.ThenFunc(app.commentDeletePost))
+	handle(http.MethodGet, "/account/starred", protected.ThenFunc(app.accountStarred))
+
+	if app.config.Features.Webhooks {
+		handle(http.MethodGet, "/account/webhooks", protected.ThenFunc(app.accountWebhooks))
+		handle(http.MethodPost, "/account/webhooks", writes.ThenFunc(app.accountWebhooksPost))
+		handle(http.MethodPost, "/webhook/delete/:id", writes.ThenFunc(app.webhookDeletePost))
+		handle(http.MethodGet, "/webhook/deliveries/:id", protected.ThenFunc(app.webhookDeliveries))
+	}
+
+	if app.config.Features.Notifications {
+		handle(http.MethodGet, "/account/notifications", protected.ThenFunc(app.accountNotifications))
+		handle(http.MethodPost, "/account/notifications", writes.ThenFunc(app.accountNotificationsPost))
+		handle(http.MethodPost, "/account/notifications/read", writes.ThenFunc(app.notificationsReadAllPost))
+		handle(http.MethodPost, "/notification/read/:id", writes.ThenFunc(app.notificationReadPost))
+	}
+
+	handle(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
 
-	router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate))
-	router.Handler(http.MethodPost, "/snippet/create", protected.ThenFunc(app.snippetCreatePost))
-	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+	// our standard middleware that we want to run on every request. The request
+	// ID comes first so everything after it can log it, and logRequest() wraps
+	// recoverFromPanic() so a panic is still logged with its 500 status.
+	standard := alice.New(assignRequestID, app.logRequest, app.recoverFromPanic, secureHeaders)
 
-	// our standard middleware that we want to run on every request
-	standard := alice.New(app.recoverFromPanic, app.logRequest, secureHeaders)
+	// the probes are checked every few seconds by the orchestrator, so they are
+	// answered before the middleware chain: no session rows, no access log
+	// lines. Everything else goes through the router wrapped in our middleware
+	// chain.
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", app.healthz)
+	mux.HandleFunc("GET /readyz", app.readyz)
+	mux.Handle("/", standard.Then(router))
 
-	// wrapping the router in our middleware chain
-	return standard.Then(router)
+	return mux
 }
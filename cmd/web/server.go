@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve() runs the server until it fails or the process gets SIGINT/SIGTERM.
+// On a signal it stops accepting new connections and gives the requests in
+// flight up to drainTimeout to finish, anything still running after that is
+// cut off.
+func (app *application) serve(srv *http.Server, drainTimeout time.Duration) error {
+	shutdownErr := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-quit
+
+		// fail the readiness probe straight away, so no new traffic is sent our way.
+		app.shuttingDown.Store(true)
+
+		app.logger.Info("caught signal, draining connections", "signal", sig.String(), "timeout", drainTimeout.String())
+
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+
+		err := srv.Shutdown(ctx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			app.logger.Warn("drain timeout reached, closing the remaining connections")
+			err = srv.Close()
+		}
+
+		shutdownErr <- err
+	}()
+
+	app.logger.Info("starting server", "addr", srv.Addr)
+
+	// the certificate comes from TLSConfig.GetCertificate, so no files here.
+	var err error
+	if srv.TLSConfig != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownErr
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("connections drained")
+	return nil
+}
+
+// stopBackground() stops the background workers once the server has stopped
+// taking requests.
+//
+// NOTE: the order matters. The expiry watcher publishes webhook events, so it
+// stops before the webhook dispatcher. The notifier and the view counter write
+// what they have buffered to the database, so all of this has to happen before
+// the connection pool is closed.
+func (app *application) stopBackground(timeout time.Duration) {
+	// the expiry watcher only runs when webhooks are switched on.
+	if app.expiryWatcher != nil {
+		app.logger.Info("stopping the expiry watcher")
+		app.expiryWatcher.Stop()
+	}
+
+	app.logger.Info("waiting for webhook deliveries in flight")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := app.webhooks.Stop(ctx); err != nil {
+		app.logger.Error("stopping webhook deliveries", "error", err)
+	}
+
+	app.logger.Info("writing queued notifications")
+	app.notifier.Stop()
+
+	app.logger.Info("flushing buffered view counts")
+	app.viewCounter.Stop()
+}
+
+// serveMetrics() starts the Prometheus metrics server on its own listener in
+// the background. Failing to serve metrics is logged but doesn't take the app
+// down with it.
+func (app *application) serveMetrics(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", app.metrics.handler())
+
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		app.logger.Info("starting metrics server", "addr", addr)
+
+		err := srv.ListenAndServe()
+		if !errors.Is(err, http.ErrServerClosed) {
+			app.logger.Error("metrics server stopped", "error", err)
+		}
+	}()
+
+	return srv
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// staticFiles serves the files under ui/static. Each file also gets a URL with
+// a hash of its content in the name, e.g. /static/css/main.3f9a1b2c7d.css,
+// which is cached forever: when the file changes so does its URL, so browsers
+// never see a stale copy.
+//
+// NOTE: only URLs written with the "static" template function are hashed.
+// Files referenced from inside other static files (like the logo in main.css)
+// keep their plain URL, which browsers have to revalidate.
+type staticFiles struct {
+	fileServer http.Handler
+	hashed     map[string]string // "css/main.css" -> "css/main.3f9a1b2c7d.css"
+	original   map[string]string // the reverse of hashed
+}
+
+// newStaticFiles() hashes every file in fsys. With hash false (in -dev mode)
+// files keep their plain URLs, so edits show up on the next reload.
+func newStaticFiles(fsys fs.FS, hash bool) (*staticFiles, error) {
+	s := &staticFiles{
+		fileServer: http.FileServerFS(fsys),
+		hashed:     map[string]string{},
+		original:   map[string]string{},
+	}
+
+	if !hash {
+		return s, nil
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(content)
+		ext := path.Ext(name)
+		hashedName := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:5]) + ext
+
+		s.hashed[name] = hashedName
+		s.original[hashedName] = name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// url() returns the URL to use for a static file, e.g. "css/main.css". It is
+// the "static" template function.
+func (s *staticFiles) url(name string) string {
+	if hashedName, ok := s.hashed[name]; ok {
+		return "/static/" + hashedName
+	}
+	return "/static/" + name
+}
+
+// ServeHTTP() serves a file, the request path is relative to ui/static.
+func (s *staticFiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, ok := s.original[strings.TrimPrefix(r.URL.Path, "/")]
+	if !ok {
+		// plain URLs can change under the browser, so make it check every time.
+		w.Header().Set("Cache-Control", "no-cache")
+		s.fileServer.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = "/" + name
+	r2.URL.RawPath = ""
+	s.fileServer.ServeHTTP(w, r2)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/alexedwards/scs/pgxstore"
+	"github.com/alexedwards/scs/sqlite3store"
+	"github.com/alexedwards/scs/v2"
+	"github.com/corbinlazarone/snippetbox/internal/migrations"
+	"github.com/corbinlazarone/snippetbox/internal/models"
+	"github.com/corbinlazarone/snippetbox/internal/models/sqlite"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// sqliteScheme marks a db setting as a SQLite file rather than a postgres
+// connection string, e.g. sqlite:snippetbox.db or sqlite:///var/lib/snippetbox.db.
+const sqliteScheme = "sqlite:"
+
+// storage is everything that lives in the database, for whichever backend the
+// db setting picked.
+type storage struct {
+	snippets      models.SnippetModelInterface
+	users         models.UserModelInterface
+	views         models.ViewModelInterface
+	stars         models.StarModelInterface
+	comments      models.CommentModelInterface
+	webhooks      models.WebhookModelInterface
+	notifications models.NotificationModelInterface
+
+	db      pinger
+	pool    *pgxpool.Pool // nil for SQLite, only used for the pool metrics
+	sqlDB   *sql.DB       // what the migrations run on
+	dialect migrations.Dialect
+
+	newSessionStore func() scs.Store
+	close           func()
+}
+
+// openStorage() connects to the database named by dsn: a SQLite file when it
+// starts with sqlite:, otherwise a postgres server. Every query gives up after
+// queryTimeout, 0 for no limit.
+func openStorage(dsn string, queryTimeout time.Duration) (*storage, error) {
+	if path, ok := strings.CutPrefix(dsn, sqliteScheme); ok {
+		return openSQLite(strings.TrimPrefix(path, "//"), queryTimeout)
+	}
+
+	return openPostgres(dsn, queryTimeout)
+}
+
+func openPostgres(dsn string, queryTimeout time.Duration) (*storage, error) {
+	db, err := openDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: closing this *sql.DB leaves the pool open, so only the pool is closed.
+	sqlDB := stdlib.OpenDBFromPool(db)
+
+	return &storage{
+		snippets:        &models.SnippetModel{DB: db, Timeout: queryTimeout},
+		users:           &models.UserModel{DB: db, Timeout: queryTimeout},
+		views:           &models.ViewModel{DB: db, Timeout: queryTimeout},
+		stars:           &models.StarModel{DB: db, Timeout: queryTimeout},
+		comments:        &models.CommentModel{DB: db, Timeout: queryTimeout},
+		webhooks:        &models.WebhookModel{DB: db, Timeout: queryTimeout},
+		notifications:   &models.NotificationModel{DB: db, Timeout: queryTimeout},
+		db:              db,
+		pool:            db,
+		sqlDB:           sqlDB,
+		dialect:         migrations.Postgres,
+		newSessionStore: func() scs.Store { return pgxstore.New(db) },
+		close:           db.Close,
+	}, nil
+}
+
+func openSQLite(path string, queryTimeout time.Duration) (*storage, error) {
+	db, err := sqlite.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storage{
+		snippets:        &sqlite.SnippetModel{DB: db, Timeout: queryTimeout},
+		users:           &sqlite.UserModel{DB: db, Timeout: queryTimeout},
+		views:           &sqlite.ViewModel{DB: db, Timeout: queryTimeout},
+		stars:           &sqlite.StarModel{DB: db, Timeout: queryTimeout},
+		comments:        &sqlite.CommentModel{DB: db, Timeout: queryTimeout},
+		webhooks:        &sqlite.WebhookModel{DB: db, Timeout: queryTimeout},
+		notifications:   &sqlite.NotificationModel{DB: db, Timeout: queryTimeout},
+		db:              pingFunc(db.PingContext),
+		sqlDB:           db,
+		dialect:         migrations.SQLite,
+		newSessionStore: func() scs.Store { return sqlite3store.New(db) },
+		close:           func() { db.Close() },
+	}, nil
+}
+
+// pingFunc turns a function into a pinger, e.g. (*sql.DB).PingContext.
+type pingFunc func(ctx context.Context) error
+
+func (f pingFunc) Ping(ctx context.Context) error {
+	return f(ctx)
+}
@@ -2,22 +2,48 @@ package main
 
 import (
 	"html/template"
+	"io/fs"
 	"net/http"
-	"path/filepath"
+	"path"
+	"slices"
 	"time"
 
+	"github.com/corbinlazarone/snippetbox/internal/markdown"
 	"github.com/corbinlazarone/snippetbox/internal/models"
 )
 
 // templateData will act as a holding structure for
 // any dynamic data we want to pass to our html templates.
 type templateData struct {
-	CurrentYear     int
-	Snippet         *models.Snippet
-	Snippets        *[]models.Snippet
-	Form            any
-	Flash           string
-	IsAuthenticated bool
+	CurrentYear           int
+	Snippet               *models.Snippet
+	SnippetHTML           template.HTML // sanitised HTML for markdown snippets
+	Snippets              *[]models.Snippet
+	Page                  *models.SnippetPage // cursors for the next/previous links
+	Listing               listParams          // sort and page size the listing was requested with
+	Stats                 *models.SnippetStats
+	StarCount             int64
+	IsStarred             bool
+	MostStarred           []models.StarredSnippet
+	Comment               *models.Comment
+	Comments              []models.Comment
+	Lines                 []codeLine       // text snippets, line by line with their line comments
+	OtherRevisionComments []models.Comment // line comments written on a different revision
+	Webhook               *models.Webhook
+	Webhooks              []models.Webhook
+	WebhookEvents         []string
+	Deliveries            []models.WebhookDelivery
+	Notifications         []models.Notification
+	NotificationKinds     []string
+	UnreadNotifications   int // shown next to the bell in the nav
+	LatestRevision        int
+	PrevRevision          int // 0 when there is no older/newer revision
+	NextRevision          int
+	Form                  any
+	Flash                 string
+	IsAuthenticated       bool
+	AuthenticatedUserID   int
+	Features              features // which optional parts of the app are switched on
 }
 
 // initialize the templateData struct with a current year
@@ -30,6 +56,12 @@ func (app *application) newTemplateData(r *http.Request) *templateData {
 
 		// add the authentication status to the template data.
 		IsAuthenticated: app.isAuthenticated(r),
+
+		AuthenticatedUserID: app.authenticatedUserID(r),
+
+		UnreadNotifications: app.unreadNotifications(r),
+
+		Features: app.config.Features,
 	}
 }
 
@@ -42,18 +74,34 @@ func humanReadableDate(t time.Time) string {
 	return t.Format("02 Jan 2006 at 15:04")
 }
 
+// commentThread pairs a comment with the page it is shown on, so the "comment"
+// partial can see who is logged in and who owns the snippet.
+type commentThread struct {
+	Page    *templateData
+	Comment models.Comment
+}
+
+func newCommentThread(page *templateData, comment models.Comment) commentThread {
+	return commentThread{Page: page, Comment: comment}
+}
+
 var functions = template.FuncMap{
 	"humanDate": humanReadableDate,
+	"thread":    newCommentThread,
+	"contains":  slices.Contains[[]string],
+	"markdown":  markdown.Render, // sanitised, so it is safe to output as-is
 }
 
 // newTemplateCache() parses all our html pages when the app starts
 // and stores them in map (cache) so we can refrence them in our app, instead
 // of parsing and reading the template html page everytime the user goes to a new page.
-func newTemplateCache() (map[string]*template.Template, error) {
+// fsys holds the ui directory, either embedded in the binary or, in -dev mode,
+// read from disk.
+func newTemplateCache(fsys fs.FS, static *staticFiles) (map[string]*template.Template, error) {
 	cache := map[string]*template.Template{}
 
 	// Grab a slice for all our page tempaltes
-	matches, err := filepath.Glob("./ui/html/pages/*.tmpl.html")
+	matches, err := fs.Glob(fsys, "html/pages/*.tmpl.html")
 	if err != nil {
 		return nil, err
 	}
@@ -61,26 +109,20 @@ func newTemplateCache() (map[string]*template.Template, error) {
 	for _, page := range matches {
 		// grab the name of the page for the key in our map.
 		// name will be the last element of the path ex: home.tmpl.html
-		name := filepath.Base(page)
+		name := path.Base(page)
 
 		// NOTE: Customer template functions must be registerd before the template is parsed.
 		// This means we have to create a empty template set using template.New() to register the
 		// template.FuncMap and then parse the file.
+		//
+		// static needs to know the hashed file names, so it is added here
+		// rather than in functions.
+		funcs := template.FuncMap{"static": static.url}
 
-		// parse our base template file
-		tmplSet, err := template.New(name).Funcs(functions).ParseFiles("./ui/html/base.tmpl.html")
-		if err != nil {
-			return nil, err
-		}
-
-		// parse all the partials template files b/c we will add more later
-		tmplSet, err = tmplSet.ParseGlob("./ui/html/partials/*.tmpl.html")
-		if err != nil {
-			return nil, err
-		}
+		// parse the base template, all the partials and then the page template.
+		patterns := []string{"html/base.tmpl.html", "html/partials/*.tmpl.html", page}
 
-		// parse our page template
-		tmplSet, err = tmplSet.ParseFiles(page)
+		tmplSet, err := template.New(name).Funcs(functions).Funcs(funcs).ParseFS(fsys, patterns...)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/corbinlazarone/snippetbox/internal/live"
+	"github.com/corbinlazarone/snippetbox/internal/models/mocks"
+	"github.com/corbinlazarone/snippetbox/internal/ratelimit"
+	"github.com/corbinlazarone/snippetbox/internal/webhook"
+	"github.com/corbinlazarone/snippetbox/ui"
+	"github.com/go-playground/form/v4"
+)
+
+// testModels are the in-memory stores behind a test application, so tests can
+// set up data and check what the handlers did.
+type testModels struct {
+	snippets      *mocks.SnippetModel
+	users         *mocks.UserModel
+	views         *mocks.ViewModel
+	stars         *mocks.StarModel
+	comments      *mocks.CommentModel
+	webhooks      *mocks.WebhookModel
+	notifications *mocks.NotificationModel
+}
+
+// newTestApplication() returns an application wired up like main() does, with
+// the default config, the embedded ui and the in-memory models. Background
+// workers aren't started: views stay buffered, and webhooks and notifications
+// stay queued.
+func newTestApplication(t *testing.T) (*application, *testModels) {
+	t.Helper()
+
+	cfg := defaultConfig()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	staticFS, err := fs.Sub(ui.Files, "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	static, err := newStaticFiles(staticFS, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	templateCache, err := newTemplateCache(ui.Files, static)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uiVersion, err := hashFS(ui.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := mocks.NewUserModel()
+	snippets := mocks.NewSnippetModel()
+	m := &testModels{
+		snippets:      snippets,
+		users:         users,
+		views:         mocks.NewViewModel(snippets),
+		stars:         mocks.NewStarModel(snippets),
+		comments:      mocks.NewCommentModel(users),
+		webhooks:      mocks.NewWebhookModel(),
+		notifications: mocks.NewNotificationModel(users, snippets),
+	}
+
+	metrics := newMetrics(nil)
+
+	sessionManager := scs.New()
+	sessionManager.Store = &instrumentedStore{Store: memstore.New(), metrics: metrics}
+	sessionManager.Lifetime = cfg.SessionLifetime
+	sessionManager.Cookie.Secure = cfg.SessionCookieSecure
+
+	app := &application{
+		config:         &cfg,
+		logger:         logger,
+		snippets:       m.snippets,
+		templateCache:  templateCache,
+		ui:             ui.Files,
+		static:         static,
+		uiVersion:      uiVersion,
+		formDecoder:    form.NewDecoder(),
+		sessionManager: sessionManager,
+		users:          m.users,
+		views:          m.views,
+		stars:          m.stars,
+		comments:       m.comments,
+		webhookStore:   m.webhooks,
+		notifications:  m.notifications,
+		viewCounter:    newViewCounter(m.views, logger, time.Hour),
+		webhooks:       webhook.New(m.webhooks, logger, webhook.Config{}),
+		notifier:       newNotifier(m.notifications, m.snippets, m.comments, logger, 1000),
+		live:           live.NewHub(logger),
+		metrics:        metrics,
+		db:             pingFunc(func(context.Context) error { return nil }),
+		rateLimiter:    ratelimit.NewMemoryStore(5 * time.Minute),
+	}
+
+	return app, m
+}
+
+// testServer is an HTTPS test server for the app's routes, with a client that
+// keeps cookies and doesn't follow redirects.
+type testServer struct {
+	*httptest.Server
+}
+
+func newTestServer(t *testing.T, h http.Handler) *testServer {
+	t.Helper()
+
+	ts := httptest.NewTLSServer(h)
+	t.Cleanup(ts.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar = jar
+
+	// return redirects as they are, so tests can check where they go.
+	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &testServer{ts}
+}
+
+// response is what a test request got back.
+type response struct {
+	status int
+	header http.Header
+	body   string
+}
+
+func (ts *testServer) do(t *testing.T, req *http.Request) response {
+	t.Helper()
+
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return response{res.StatusCode, res.Header, string(bytes.TrimSpace(body))}
+}
+
+// get() makes a GET request, header is added to it.
+func (ts *testServer) get(t *testing.T, path string, header ...string) response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	return ts.do(t, req)
+}
+
+func (ts *testServer) postForm(t *testing.T, path string, form url.Values) response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return ts.do(t, req)
+}
+
+// login() signs a new user up through the models and logs the test client in
+// as them. It returns their id.
+func (ts *testServer) login(t *testing.T, m *testModels, name string) int {
+	t.Helper()
+
+	email := name + "@example.com"
+	if err := m.users.Insert(context.Background(), name, email, "pa55word123"); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := m.users.Authenticate(context.Background(), email, "pa55word123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := ts.postForm(t, "/user/login", url.Values{"email": {email}, "password": {"pa55word123"}})
+	if res.status != http.StatusSeeOther {
+		t.Fatalf("logging in as %s: got status %d", name, res.status)
+	}
+
+	return id
+}
+
+// newSnippet() adds a snippet that expires in a week and returns its id.
+func newSnippet(t *testing.T, m *testModels, userID int, title, content string) int {
+	t.Helper()
+
+	id, err := m.snippets.Insert(context.Background(), userID, title, content, "text", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// newTLSConfig() returns the TLS settings for the server. Certificates come
+// from getCertificate, so they can be swapped without a restart.
+func newTLSConfig(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+
+		// only use elliptic curves with assembly implementations.
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+
+		GetCertificate: getCertificate,
+	}
+}
+
+// certReloader serves the certificate and key from disk, reloading them when
+// the process gets SIGHUP or when either file changes, so renewed certificates
+// are picked up without a restart. If a reload fails the old certificate is
+// kept.
+//
+// NOTE: file changes are noticed by polling the modification times, which
+// works the same everywhere, including with the symlink swaps Kubernetes does
+// for mounted secrets.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+	interval time.Duration
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time // the newest modification time of the two files when last loaded
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newCertReloader() loads the certificate, returning an error if it can't, so
+// a bad path is caught at startup.
+func newCertReloader(certFile, keyFile string, logger *slog.Logger, interval time.Duration) (*certReloader, error) {
+	c := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetCertificate() is used as tls.Config.GetCertificate.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert, nil
+}
+
+// Run() watches for SIGHUP and for changes to the files until Stop() is called.
+// It is meant to be started in its own goroutine.
+func (c *certReloader) Run() {
+	defer close(c.done)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+			c.logger.Info("caught SIGHUP, reloading the TLS certificate")
+			c.reloadAndLog()
+		case <-ticker.C:
+			modTime, err := c.newestModTime()
+			if err != nil {
+				c.logger.Error("checking the TLS certificate files", "error", err)
+				continue
+			}
+
+			c.mu.RLock()
+			changed := modTime.After(c.modTime)
+			c.mu.RUnlock()
+
+			if changed {
+				c.logger.Info("TLS certificate files changed, reloading")
+				c.reloadAndLog()
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Stop() stops watching for changes.
+func (c *certReloader) Stop() {
+	close(c.stop)
+	<-c.done
+}
+
+func (c *certReloader) reloadAndLog() {
+	if err := c.reload(); err != nil {
+		c.logger.Error("reloading the TLS certificate, keeping the old one", "error", err)
+		return
+	}
+
+	c.logger.Info("TLS certificate reloaded")
+}
+
+func (c *certReloader) reload() error {
+	// read the times first, so a file written while we load is picked up on the
+	// next check rather than missed. They are recorded even if loading fails,
+	// so a broken pair is only retried once one of the files changes again
+	// (e.g. the key lands after the certificate), not on every check.
+	modTime, err := c.newestModTime()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.modTime = modTime
+	c.mu.Unlock()
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *certReloader) newestModTime() (time.Time, error) {
+	var newest time.Time
+
+	for _, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+
+	return newest, nil
+}
+
+// selfSignedCertificate() generates a throwaway certificate for localhost, so
+// HTTPS (and with it the secure session cookie) works in development without
+// any setup. Browsers will warn about it, which is expected.
+func selfSignedCertificate() (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Snippetbox development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// redirectToHTTPS() sends every plain HTTP request to the same URL on the
+// HTTPS server, whose address is httpsAddr.
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, httpsPort, _ := net.SplitHostPort(httpsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+
+		if host == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		// 443 is the default, so it is left out of the URL.
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		url := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, url, http.StatusMovedPermanently)
+	})
+}
+
+// serveRedirect() starts the HTTP to HTTPS redirect listener in the background.
+func (app *application) serveRedirect(addr, httpsAddr string) *http.Server {
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      redirectToHTTPS(httpsAddr),
+		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		app.logger.Info("starting HTTP to HTTPS redirect server", "addr", addr)
+
+		err := srv.ListenAndServe()
+		if !errors.Is(err, http.ErrServerClosed) {
+			app.logger.Error("redirect server stopped", "error", err)
+		}
+	}()
+
+	return srv
+}
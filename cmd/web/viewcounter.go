@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+	"github.com/corbinlazarone/snippetbox/internal/worker"
+)
+
+// viewCounter buffers snippet views in memory and writes them to the database
+// in batches, so viewing a snippet doesn't cost a database write per request.
+//
+// NOTE: anything still buffered is lost if the process is killed, which is a
+// fair trade for view counts. A normal shutdown calls Stop() which flushes
+// whatever is left.
+type viewCounter struct {
+	mu      sync.Mutex
+	pending map[models.ViewKey]int64
+
+	views    models.ViewModelInterface
+	logger   *slog.Logger
+	interval time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newViewCounter(views models.ViewModelInterface, logger *slog.Logger, interval time.Duration) *viewCounter {
+	return &viewCounter{
+		pending:  make(map[models.ViewKey]int64),
+		views:    views,
+		logger:   logger,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Record() counts a single view of a snippet. referrer is the raw Referer header,
+// only its host is kept.
+func (c *viewCounter) Record(snippetID int, referrer string) {
+	key := models.ViewKey{
+		SnippetID: snippetID,
+		Day:       time.Now().UTC().Truncate(24 * time.Hour),
+		Referrer:  referrerHost(referrer),
+	}
+
+	c.mu.Lock()
+	c.pending[key]++
+	c.mu.Unlock()
+}
+
+// Pending() returns the views of a snippet that haven't been flushed yet, so the
+// count we show doesn't lag behind by up to one flush interval.
+func (c *viewCounter) Pending(snippetID int) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var n int64
+	for key, count := range c.pending {
+		if key.SnippetID == snippetID {
+			n += count
+		}
+	}
+
+	return n
+}
+
+// Forget() drops the buffered views of a snippet that has been deleted.
+func (c *viewCounter) Forget(snippetID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.pending {
+		if key.SnippetID == snippetID {
+			delete(c.pending, key)
+		}
+	}
+}
+
+// Run() flushes the buffer every interval until Stop() is called. It is meant to
+// be started in its own goroutine.
+func (c *viewCounter) Run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.flush()
+		case <-c.stop:
+			// drain whatever was recorded since the last tick before exiting.
+			c.flush()
+			return
+		}
+	}
+}
+
+// Stop() stops the flush loop and waits for the final flush to finish.
+func (c *viewCounter) Stop() {
+	close(c.stop)
+	<-c.done
+}
+
+// flush() swaps out the buffer and writes it to the database. If the write fails
+// the counts are merged back in so the next flush can retry them.
+func (c *viewCounter) flush() {
+	c.mu.Lock()
+	batch := c.pending
+	c.pending = make(map[models.ViewKey]int64)
+	c.mu.Unlock()
+
+	defer worker.Recover(c.logger, "view counter flush")
+
+	err := c.views.RecordBatch(context.Background(), batch)
+	if err != nil {
+		c.logger.Error("flushing view counts", "count", len(batch), "error", err)
+
+		c.mu.Lock()
+		for key, n := range batch {
+			c.pending[key] += n
+		}
+		c.mu.Unlock()
+	}
+}
+
+// referrerHost() reduces a Referer header to just its host, truncated to fit the
+// referrer column. Anything unparsable is treated as a direct visit.
+func referrerHost(referrer string) string {
+	u, err := url.Parse(referrer)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	host := u.Hostname()
+	if len(host) > 255 {
+		host = host[:255]
+	}
+
+	return host
+}
@@ -0,0 +1,130 @@
+// Package cache keeps recently read snippets in memory, so popular ones don't
+// cost a database query on every view.
+//
+// SnippetModel sits in front of any models.SnippetModelInterface and caches
+// single snippets and listing pages. Where they are kept is up to the Cache it
+// is given, LRU is an in-process one.
+//
+// NOTE: an in-process cache only sees the writes made through this process.
+// With several instances running, an edit made on one is only seen by the
+// others once their copy expires, so keep the TTL short.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache stores values until they expire or are evicted. Implementations must
+// be safe to use from several goroutines.
+type Cache[V any] interface {
+	// Get returns the value for key, unless it is missing or has expired.
+	Get(key string) (V, bool)
+	// Set stores value under key until expires.
+	Set(key string, value V, expires time.Time)
+	// Delete removes key, if it is there.
+	Delete(key string)
+	// Clear removes everything.
+	Clear()
+	// Len returns how many values are stored, including expired ones that
+	// haven't been cleaned up yet.
+	Len() int
+}
+
+// LRU is an in-process Cache holding at most a fixed number of values. When it
+// is full, adding a value evicts the one that was used least recently.
+type LRU[V any] struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is the most recently used
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+type lruEntry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+var _ Cache[int] = (*LRU[int])(nil)
+
+// NewLRU returns an LRU holding up to size values, size must be at least 1.
+func NewLRU[V any](size int) *LRU[V] {
+	return &LRU[V]{
+		size:    max(size, 1),
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+		now:     time.Now,
+	}
+}
+
+func (c *LRU[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+
+	el, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+
+	entry := el.Value.(*lruEntry[V])
+	if !c.now().Before(entry.expires) {
+		c.remove(el)
+		return zero, false
+	}
+
+	c.order.MoveToFront(el)
+	return entry.value, true
+}
+
+func (c *LRU[V]) Set(key string, value V, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*lruEntry[V])
+		entry.value, entry.expires = value, expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry[V]{key: key, value: value, expires: expires})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRU[V]) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+func (c *LRU[V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	clear(c.entries)
+}
+
+func (c *LRU[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// remove() drops an entry. The caller must hold mu.
+func (c *LRU[V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry[V]).key)
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEviction(t *testing.T) {
+	c := NewLRU[int](2)
+	expires := time.Now().Add(time.Hour)
+
+	c.Set("a", 1, expires)
+	c.Set("b", 2, expires)
+
+	// reading a makes b the least recently used.
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a missing before the cache was full")
+	}
+	c.Set("c", 3, expires)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b was kept, want it evicted")
+	}
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		if got, ok := c.Get(key); !ok || got != want {
+			t.Errorf("Get(%q) = %d, %t, want %d, true", key, got, ok, want)
+		}
+	}
+	if got := c.Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2", got)
+	}
+
+	// setting a key that is already there replaces it without evicting.
+	c.Set("a", 10, expires)
+	if got, _ := c.Get("a"); got != 10 {
+		t.Errorf("Get(a) = %d after replacing it, want 10", got)
+	}
+	if _, ok := c.Get("c"); !ok {
+		t.Error("c was evicted by replacing a")
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	c := NewLRU[int](10)
+	c.now = func() time.Time { return now }
+
+	c.Set("short", 1, now.Add(time.Minute))
+	c.Set("long", 2, now.Add(time.Hour))
+
+	now = now.Add(time.Minute)
+
+	if _, ok := c.Get("short"); ok {
+		t.Error("short was served at its expiry time")
+	}
+	if _, ok := c.Get("long"); !ok {
+		t.Error("long expired early")
+	}
+
+	// an expired entry is dropped when it is read.
+	if got := c.Len(); got != 1 {
+		t.Errorf("Len() = %d, want 1", got)
+	}
+}
+
+func TestLRUDeleteAndClear(t *testing.T) {
+	c := NewLRU[int](10)
+	expires := time.Now().Add(time.Hour)
+
+	c.Set("a", 1, expires)
+	c.Set("b", 2, expires)
+
+	c.Delete("a")
+	c.Delete("missing")
+	if _, ok := c.Get("a"); ok {
+		t.Error("a was served after Delete()")
+	}
+
+	c.Clear()
+	if got := c.Len(); got != 0 {
+		t.Errorf("Len() = %d after Clear(), want 0", got)
+	}
+}
@@ -0,0 +1,254 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+	"golang.org/x/sync/singleflight"
+)
+
+// SnippetModel is a read-through cache in front of a snippet store. Get() and
+// List() are answered from the cache when they can be, everything else goes
+// straight to the store. Writes made through it drop whatever they change.
+//
+// A cached snippet is kept for the TTL, or until it expires if that is sooner,
+// so an expired snippet is never served. View counts in cached snippets (and
+// the most viewed listing) can be up to a TTL behind.
+type SnippetModel struct {
+	store    models.SnippetModelInterface
+	snippets Cache[models.Snippet]
+	pages    Cache[models.SnippetPage]
+	ttl      time.Duration
+	now      func() time.Time
+
+	// concurrent misses for the same key share one query.
+	flight singleflight.Group
+
+	// generation is bumped after every write. A query that started before a
+	// write may have read what the write replaced, so its result isn't cached.
+	// fillMu stops a write landing between that check and the fill.
+	generation atomic.Uint64
+	fillMu     sync.Mutex
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	coalesced atomic.Uint64
+}
+
+var _ models.SnippetModelInterface = (*SnippetModel)(nil)
+
+// Stats are the cache's counts since it was created.
+type Stats struct {
+	Hits      uint64 // reads answered from the cache
+	Misses    uint64 // reads that had to go to the store
+	Coalesced uint64 // misses that shared their query with another miss
+	Snippets  int    // snippets cached right now
+	Pages     int    // listing pages cached right now
+}
+
+// NewSnippetModel puts a cache in front of store. Single snippets are kept in
+// snippets and listing pages in pages, for at most ttl.
+func NewSnippetModel(store models.SnippetModelInterface, snippets Cache[models.Snippet], pages Cache[models.SnippetPage], ttl time.Duration) *SnippetModel {
+	return &SnippetModel{
+		store:    store,
+		snippets: snippets,
+		pages:    pages,
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+// Stats returns the cache's counts.
+func (m *SnippetModel) Stats() Stats {
+	return Stats{
+		Hits:      m.hits.Load(),
+		Misses:    m.misses.Load(),
+		Coalesced: m.coalesced.Load(),
+		Snippets:  m.snippets.Len(),
+		Pages:     m.pages.Len(),
+	}
+}
+
+func (m *SnippetModel) Get(ctx context.Context, id int) (*models.Snippet, error) {
+	key := strconv.Itoa(id)
+
+	if snippet, ok := m.snippets.Get(key); ok {
+		m.hits.Add(1)
+		return &snippet, nil
+	}
+
+	snippet, err := load(ctx, m, "snippet/"+key,
+		func(ctx context.Context) (models.Snippet, error) {
+			snippet, err := m.store.Get(ctx, id)
+			if err != nil {
+				return models.Snippet{}, err
+			}
+			return *snippet, nil
+		},
+		func(snippet models.Snippet) {
+			m.snippets.Set(key, snippet, m.expires(snippet.Expires))
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snippet, nil
+}
+
+func (m *SnippetModel) List(ctx context.Context, sort string, limit int, cursor string) (*models.SnippetPage, error) {
+	key := fmt.Sprintf("%s/%d/%s", sort, limit, cursor)
+
+	if page, ok := m.pages.Get(key); ok {
+		m.hits.Add(1)
+		return clonePage(page), nil
+	}
+
+	page, err := load(ctx, m, "page/"+key,
+		func(ctx context.Context) (models.SnippetPage, error) {
+			page, err := m.store.List(ctx, sort, limit, cursor)
+			if err != nil {
+				return models.SnippetPage{}, err
+			}
+			return *clonePage(*page), nil
+		},
+		func(page models.SnippetPage) {
+			// the page is stale as soon as any snippet on it expires.
+			expires := m.expires(time.Time{})
+			for _, snippet := range page.Snippets {
+				if snippet.Expires.Before(expires) {
+					expires = snippet.Expires
+				}
+			}
+			m.pages.Set(key, *clonePage(page), expires)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return clonePage(page), nil
+}
+
+func (m *SnippetModel) Insert(ctx context.Context, userID int, title string, content string, contentType string, expires int) (int, error) {
+	id, err := m.store.Insert(ctx, userID, title, content, contentType, expires)
+
+	// a new snippet shows up in the listings.
+	m.invalidate()
+
+	return id, err
+}
+
+func (m *SnippetModel) Update(ctx context.Context, id int, title, content, contentType string) (int, error) {
+	revision, err := m.store.Update(ctx, id, title, content, contentType)
+
+	// NOTE: this runs even if the update failed, a timeout doesn't tell us
+	// whether the database made the change or not.
+	m.invalidate(id)
+
+	return revision, err
+}
+
+func (m *SnippetModel) Delete(ctx context.Context, id int) (*models.Snippet, error) {
+	snippet, err := m.store.Delete(ctx, id)
+	m.invalidate(id)
+
+	return snippet, err
+}
+
+func (m *SnippetModel) MarkExpired(ctx context.Context) ([]models.Snippet, error) {
+	// expired snippets have already left the cache, see expires().
+	return m.store.MarkExpired(ctx)
+}
+
+func (m *SnippetModel) GetRevision(ctx context.Context, id, revision int) (*models.Snippet, error) {
+	return m.store.GetRevision(ctx, id, revision)
+}
+
+func (m *SnippetModel) GetMany(ctx context.Context, ids []int) ([]models.Snippet, error) {
+	return m.store.GetMany(ctx, ids)
+}
+
+// expires() is when something read now should leave the cache: after the TTL,
+// or at limit if that is sooner and not zero.
+func (m *SnippetModel) expires(limit time.Time) time.Time {
+	expires := m.now().Add(m.ttl)
+	if !limit.IsZero() && limit.Before(expires) {
+		return limit
+	}
+	return expires
+}
+
+// invalidate() drops the given snippets and every listing page.
+func (m *SnippetModel) invalidate(ids ...int) {
+	m.fillMu.Lock()
+	defer m.fillMu.Unlock()
+
+	m.generation.Add(1)
+
+	for _, id := range ids {
+		m.snippets.Delete(strconv.Itoa(id))
+	}
+	m.pages.Clear()
+}
+
+// load() runs query for a cache miss and caches the result with fill.
+// Concurrent misses for the same key wait for a single query. A caller can give
+// up waiting when its ctx is done, without cancelling the query for the rest.
+func load[V any](ctx context.Context, m *SnippetModel, key string, query func(context.Context) (V, error), fill func(V)) (V, error) {
+	m.misses.Add(1)
+
+	// the generation is part of the key, so a miss after a write doesn't join
+	// a query that started before it.
+	generation := m.generation.Load()
+	key = fmt.Sprintf("%d/%s", generation, key)
+
+	// ran is only set when this caller's query is the one that runs, the
+	// others waited on it.
+	var ran bool
+
+	results := m.flight.DoChan(key, func() (any, error) {
+		ran = true
+
+		// NOTE: the store still applies its own query timeout.
+		value, err := query(context.WithoutCancel(ctx))
+		if err != nil {
+			return value, err
+		}
+
+		m.fillMu.Lock()
+		if m.generation.Load() == generation {
+			fill(value)
+		}
+		m.fillMu.Unlock()
+
+		return value, nil
+	})
+
+	var zero V
+
+	select {
+	case result := <-results:
+		if !ran {
+			m.coalesced.Add(1)
+		}
+		if result.Err != nil {
+			return zero, result.Err
+		}
+		return result.Val.(V), nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// clonePage() copies a page, so callers can't change what is cached.
+func clonePage(page models.SnippetPage) *models.SnippetPage {
+	page.Snippets = slices.Clone(page.Snippets)
+	return &page
+}
@@ -0,0 +1,302 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+	"github.com/corbinlazarone/snippetbox/internal/models/mocks"
+)
+
+// store is an in-memory snippet store that counts the reads the cache makes.
+// While hold is set, reads wait on it after they have read the snippet, so a
+// test can change the store under a read that is in flight.
+type store struct {
+	*mocks.SnippetModel
+
+	gets  atomic.Int64
+	lists atomic.Int64
+
+	mu      sync.Mutex
+	hold    chan struct{}
+	started chan struct{}
+}
+
+func newStore() *store {
+	return &store{
+		SnippetModel: mocks.NewSnippetModel(),
+		started:      make(chan struct{}, 100),
+	}
+}
+
+func (s *store) Get(ctx context.Context, id int) (*models.Snippet, error) {
+	s.gets.Add(1)
+	snippet, err := s.SnippetModel.Get(ctx, id)
+	s.wait()
+	return snippet, err
+}
+
+func (s *store) List(ctx context.Context, sort string, limit int, cursor string) (*models.SnippetPage, error) {
+	s.lists.Add(1)
+	page, err := s.SnippetModel.List(ctx, sort, limit, cursor)
+	s.wait()
+	return page, err
+}
+
+// block() makes reads wait until release() is called.
+func (s *store) block() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hold = make(chan struct{})
+}
+
+func (s *store) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	close(s.hold)
+	s.hold = nil
+}
+
+func (s *store) wait() {
+	s.mu.Lock()
+	hold := s.hold
+	s.mu.Unlock()
+
+	if hold != nil {
+		s.started <- struct{}{}
+		<-hold
+	}
+}
+
+func newTestCache(t *testing.T) (*SnippetModel, *store, int) {
+	t.Helper()
+
+	s := newStore()
+	id, err := s.Insert(t.Context(), 1, "An old silent pond", "A frog jumps into the pond", "text/plain", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewSnippetModel(s, NewLRU[models.Snippet](10), NewLRU[models.SnippetPage](10), time.Minute), s, id
+}
+
+func TestReadThrough(t *testing.T) {
+	m, s, id := newTestCache(t)
+
+	for range 3 {
+		snippet, err := m.Get(t.Context(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snippet.ID != id {
+			t.Fatalf("got snippet %d, want %d", snippet.ID, id)
+		}
+	}
+
+	for range 3 {
+		if _, err := m.List(t.Context(), models.SortNewest, 10, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := s.gets.Load(); got != 1 {
+		t.Errorf("store.Get() called %d times, want 1", got)
+	}
+	if got := s.lists.Load(); got != 1 {
+		t.Errorf("store.List() called %d times, want 1", got)
+	}
+
+	want := Stats{Hits: 4, Misses: 2, Coalesced: 0, Snippets: 1, Pages: 1}
+	if got := m.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteInvalidates(t *testing.T) {
+	m, s, id := newTestCache(t)
+
+	if _, err := m.Get(t.Context(), id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.List(t.Context(), models.SortNewest, 10, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Update(t.Context(), id, "Over the wintry forest", "winds howl in rage", "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	snippet, err := m.Get(t.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snippet.Title != "Over the wintry forest" {
+		t.Errorf("got title %q after the update, want the new one", snippet.Title)
+	}
+
+	page, err := m.List(t.Context(), models.SortNewest, 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Snippets) != 1 || page.Snippets[0].Title != "Over the wintry forest" {
+		t.Errorf("got listing %+v after the update, want the new title", page.Snippets)
+	}
+
+	if got := s.gets.Load(); got != 2 {
+		t.Errorf("store.Get() called %d times, want 2", got)
+	}
+	if got := s.lists.Load(); got != 2 {
+		t.Errorf("store.List() called %d times, want 2", got)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	s := newStore()
+	s.Now = clock
+	id, err := s.Insert(t.Context(), 1, "An old silent pond", "A frog jumps into the pond", "text/plain", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snippets := NewLRU[models.Snippet](10)
+	snippets.now = clock
+	m := NewSnippetModel(s, snippets, NewLRU[models.SnippetPage](10), time.Minute)
+	m.now = clock
+
+	if _, err := m.Get(t.Context(), id); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(59 * time.Second)
+	if _, err := m.Get(t.Context(), id); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.gets.Load(); got != 1 {
+		t.Fatalf("store.Get() called %d times within the TTL, want 1", got)
+	}
+
+	now = now.Add(time.Second)
+	if _, err := m.Get(t.Context(), id); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.gets.Load(); got != 2 {
+		t.Errorf("store.Get() called %d times after the TTL, want 2", got)
+	}
+}
+
+func TestInvalidateDuringFill(t *testing.T) {
+	m, s, id := newTestCache(t)
+
+	// the read has the old title by the time the update lands.
+	s.block()
+
+	done := make(chan *models.Snippet)
+	go func() {
+		snippet, err := m.Get(context.Background(), id)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- snippet
+	}()
+
+	<-s.started
+	if _, err := m.Update(t.Context(), id, "Over the wintry forest", "winds howl in rage", "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	s.release()
+
+	if snippet := <-done; snippet == nil || snippet.Title != "An old silent pond" {
+		t.Fatalf("in flight read got %+v, want the old title", snippet)
+	}
+
+	// what it read is stale, so it mustn't have been cached.
+	snippet, err := m.Get(t.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snippet.Title != "Over the wintry forest" {
+		t.Errorf("got title %q after the update, want the new one", snippet.Title)
+	}
+	if got := s.gets.Load(); got != 2 {
+		t.Errorf("store.Get() called %d times, want 2", got)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	const callers = 10
+
+	m, s, id := newTestCache(t)
+	s.block()
+
+	var wg sync.WaitGroup
+	for range callers {
+		wg.Go(func() {
+			snippet, err := m.Get(context.Background(), id)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if snippet.ID != id {
+				t.Errorf("got snippet %d, want %d", snippet.ID, id)
+			}
+		})
+	}
+
+	<-s.started
+
+	// give every caller time to join the query before it finishes.
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Stats().Misses < callers && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	s.release()
+	wg.Wait()
+
+	if got := s.gets.Load(); got != 1 {
+		t.Errorf("store.Get() called %d times, want 1", got)
+	}
+
+	// the caller that ran the query isn't counted, only the ones that waited.
+	stats := m.Stats()
+	if stats.Misses != callers || stats.Coalesced != callers-1 {
+		t.Errorf("got %d misses and %d coalesced, want %d and %d", stats.Misses, stats.Coalesced, callers, callers-1)
+	}
+}
+
+func TestCoalesceWaiterGivesUp(t *testing.T) {
+	m, s, id := newTestCache(t)
+	s.block()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := m.Get(context.Background(), id); err != nil {
+			t.Error(err)
+		}
+	}()
+	<-s.started
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	if _, err := m.Get(ctx, id); err != context.Canceled {
+		t.Errorf("got error %v for a cancelled waiter, want context.Canceled", err)
+	}
+
+	// the query carries on for the caller that started it.
+	s.release()
+	<-done
+
+	if _, ok := m.snippets.Get(strconv.Itoa(id)); !ok {
+		t.Error("the query's result wasn't cached after a waiter gave up")
+	}
+}
@@ -0,0 +1,122 @@
+// Package live is an in-process publish/subscribe hub used to push updates to
+// browsers as they happen. Every subscriber gets every message, and a
+// subscriber that can't keep up misses messages rather than holding up the
+// publisher.
+//
+// NOTE: the hub only knows about subscribers in this process, so with several
+// instances running each browser only sees the changes made through the
+// instance it is connected to.
+package live
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+)
+
+// subscriberBuffer is how many messages can wait for a slow subscriber before
+// messages to it start being dropped.
+const subscriberBuffer = 16
+
+// Message is a single update, Data is already JSON encoded.
+type Message struct {
+	Event string
+	Data  []byte
+}
+
+// Subscription receives the messages published after it was created.
+type Subscription struct {
+	messages chan Message
+}
+
+// Messages() returns the channel messages are delivered on. It is closed when
+// the hub is closed.
+func (s *Subscription) Messages() <-chan Message {
+	return s.messages
+}
+
+// Hub fans messages out to its subscribers.
+type Hub struct {
+	logger *slog.Logger
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+func NewHub(logger *slog.Logger) *Hub {
+	return &Hub{
+		logger:      logger,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe() adds a subscriber. Call Unsubscribe() when done with it. On a
+// closed hub the subscription's channel is already closed.
+func (h *Hub) Subscribe() *Subscription {
+	sub := &Subscription{messages: make(chan Message, subscriberBuffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(sub.messages)
+		return sub
+	}
+
+	h.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe() removes a subscriber. It is safe to call more than once, and
+// after the hub has been closed.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.messages)
+	}
+}
+
+// Publish() sends event to every subscriber, with data encoded as JSON. It never
+// blocks: subscribers whose buffer is full don't get the message.
+func (h *Hub) Publish(event string, data any) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		h.logger.Error("encoding live update", "event", event, "error", err)
+		return
+	}
+
+	msg := Message{Event: event, Data: js}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		select {
+		case sub.messages <- msg:
+		default:
+		}
+	}
+}
+
+// Close() closes every subscription and stops new ones from receiving
+// anything, which ends the streams reading from them. It is meant to be called
+// when the server shuts down, since the streams would otherwise keep
+// Shutdown() waiting until its timeout.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+
+	for sub := range h.subscribers {
+		delete(h.subscribers, sub)
+		close(sub.messages)
+	}
+}
@@ -0,0 +1,66 @@
+// Package markdown renders user supplied Markdown into HTML that is safe to
+// embed in our templates.
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+)
+
+// HighlightStyle is the chroma style used for fenced code blocks. The matching
+// CSS lives in ui/static/css/highlight.css.
+const HighlightStyle = "github"
+
+// NOTE: goldmark doesn't render raw HTML unless html.WithUnsafe() is set, but we
+// still run everything through the sanitizer afterwards so a bug or a new
+// extension can't sneak markup past us.
+var renderer = goldmark.New(
+	// GFM gives us tables, task lists, strikethrough and autolinks.
+	goldmark.WithExtensions(
+		extension.GFM,
+		highlighting.NewHighlighting(
+			highlighting.WithStyle(HighlightStyle),
+			// Use CSS classes rather than inline styles, because our
+			// Content-Security-Policy doesn't allow inline styles.
+			highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+		),
+	),
+)
+
+var policy = newPolicy()
+
+// newPolicy() builds the allow-list of elements and attributes that may appear in
+// the rendered output. It starts from bluemonday's policy for user generated
+// content and only adds what the extensions above need.
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+
+	// chroma marks up highlighted code with short class names like "k" or "nf".
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[a-zA-Z0-9 _-]+$`)).OnElements("pre", "code", "span")
+
+	// task list items are rendered as disabled checkboxes.
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+
+	return p
+}
+
+// Render() converts Markdown source into sanitised HTML. The result has been
+// through the allow-list sanitizer, so it is safe to mark as template.HTML.
+func Render(source string) (template.HTML, error) {
+	var buf bytes.Buffer
+
+	err := renderer.Convert([]byte(source), &buf)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(policy.SanitizeBytes(buf.Bytes())), nil
+}
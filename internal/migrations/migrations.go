@@ -0,0 +1,414 @@
+// Package migrations keeps the database schema up to date. The migrations are
+// SQL files embedded in the binary, applied in order and recorded in the
+// schema_migrations table, so every instance knows which ones have run.
+//
+// Each database has its own directory of migrations, with the same versions
+// in both. A migration is a pair of files named after its version and a short
+// description:
+//
+//	postgres/0002_add_tags.up.sql
+//	postgres/0002_add_tags.down.sql
+//	sqlite/0002_add_tags.up.sql
+//	sqlite/0002_add_tags.down.sql
+//
+// NOTE: every migration runs in its own transaction, so statements that can't
+// run inside one (e.g. CREATE INDEX CONCURRENTLY) aren't supported.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dir is where the migration directories live, relative to the repository
+// root. Create() writes new migrations here.
+const Dir = "internal/migrations"
+
+//go:embed postgres/*.sql sqlite/*.sql
+var embedded embed.FS
+
+// Dialect is the database the migrations are for, it names the directory
+// they are read from.
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+// Dialects lists every database we have migrations for.
+var Dialects = []Dialect{Postgres, SQLite}
+
+// lockID identifies our postgres advisory lock. Any number works as long as
+// nothing else using the database takes a lock with the same one.
+const lockID = 7318532001
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a single schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and whether it has been applied.
+type Status struct {
+	Version int
+	Name    string
+	Applied time.Time // zero if the migration is pending
+	Missing bool      // applied to the database but not in this binary, e.g. after a downgrade
+}
+
+// Migrator applies and rolls back migrations on a database.
+type Migrator struct {
+	DB         *sql.DB
+	Dialect    Dialect
+	Logger     *slog.Logger
+	Migrations []Migration
+}
+
+// New returns a migrator for the migrations embedded in the binary. A pgx
+// pool can be turned into a *sql.DB with stdlib.OpenDBFromPool().
+func New(db *sql.DB, dialect Dialect, logger *slog.Logger) (*Migrator, error) {
+	sub, err := fs.Sub(embedded, string(dialect))
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := Load(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{DB: db, Dialect: dialect, Logger: logger, Migrations: migrations}, nil
+}
+
+// Load reads the migrations in fsys, sorted by version. Every migration needs
+// both an up and a down file, and versions must be unique.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migrations: unexpected file %s, want <version>_<name>.up.sql or .down.sql", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		name, direction := match[2], match[3]
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+
+		if m.Name != name {
+			return nil, fmt.Errorf("migrations: version %d is used by both %s and %s", version, m.Name, name)
+		}
+
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrations: %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+
+	return migrations, nil
+}
+
+// Up applies every pending migration, oldest first, and returns the ones it
+// applied. It stops at the first one that fails, which is rolled back.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.Migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			m.Logger.Info("applying migration", "version", migration.Version, "name", migration.Name)
+
+			err := run(ctx, conn, migration.Up, `INSERT INTO schema_migrations (version, name, applied) VALUES ($1, $2, $3);`,
+				migration.Version, migration.Name, time.Now().UTC())
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations, newest first, and returns
+// the ones it rolled back.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var rolledBack []Migration
+
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.Migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			migration := m.Migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+
+			m.Logger.Info("rolling back migration", "version", migration.Version, "name", migration.Name)
+
+			err := run(ctx, conn, migration.Down, `DELETE FROM schema_migrations WHERE version = $1;`, migration.Version)
+			if err != nil {
+				return fmt.Errorf("rolling back %04d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			rolledBack = append(rolledBack, migration)
+		}
+
+		return nil
+	})
+
+	return rolledBack, err
+}
+
+// Status lists every migration, applied or not, oldest first.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.Migrations {
+			statuses = append(statuses, Status{
+				Version: migration.Version,
+				Name:    migration.Name,
+				Applied: done[migration.Version].applied,
+			})
+			delete(done, migration.Version)
+		}
+
+		// whatever is left was applied by a binary with migrations we don't have.
+		for version, row := range done {
+			statuses = append(statuses, Status{Version: version, Name: row.name, Applied: row.applied, Missing: true})
+		}
+
+		slices.SortFunc(statuses, func(a, b Status) int { return a.Version - b.Version })
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// Pending returns the number of migrations that haven't been applied.
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, s := range statuses {
+		if s.Applied.IsZero() {
+			pending++
+		}
+	}
+
+	return pending, nil
+}
+
+// locked() runs fn holding the migrations lock, so that instances started at
+// the same time don't apply the same migration twice. The others wait for the
+// lock, then find there is nothing left to do.
+//
+// NOTE: postgres advisory locks belong to a connection, so everything has to
+// happen on the one we took the lock on rather than on whichever the pool
+// hands out. SQLite has no equivalent, but a SQLite file is only ever used by
+// a single instance, and every migration still runs in its own transaction.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.Dialect == Postgres {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, lockID); err != nil {
+			return fmt.Errorf("taking the migrations lock: %w", err)
+		}
+
+		defer func() {
+			// use a fresh context, the lock has to be released even if ctx is
+			// done. If this fails the lock goes when the connection is closed,
+			// so throw the connection away rather than returning it to the pool.
+			_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, lockID)
+			if err != nil {
+				m.Logger.Error("releasing the migrations lock", "error", err)
+				conn.Raw(func(any) error { return driver.ErrBadConn })
+			}
+		}()
+	}
+
+	statement := `CREATE TABLE IF NOT EXISTS schema_migrations (
+									version INTEGER NOT NULL PRIMARY KEY,
+									name VARCHAR(255) NOT NULL,
+									applied TIMESTAMP NOT NULL
+								);`
+
+	if _, err := conn.ExecContext(ctx, statement); err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+type appliedRow struct {
+	name    string
+	applied time.Time
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]appliedRow, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, applied FROM schema_migrations;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := map[int]appliedRow{}
+	for rows.Next() {
+		var version int
+		var row appliedRow
+		if err := rows.Scan(&version, &row.name, &row.applied); err != nil {
+			return nil, err
+		}
+		done[version] = row
+	}
+
+	return done, rows.Err()
+}
+
+// run() executes a migration's SQL and the statement that records it in one
+// transaction, so a migration is either applied and recorded or neither.
+func run(ctx context.Context, conn *sql.Conn, migration, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// NOTE: a file can hold more than one statement. With no arguments pgx
+	// uses the simple protocol, which allows that, and the SQLite driver runs
+	// every statement it is given.
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Create writes empty up and down files for a new migration, for every
+// dialect, to the directories under dir. It is numbered one after the newest
+// migration in any of them. It returns the paths of the files.
+func Create(dir, name string) ([]string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = regexp.MustCompile(`\W+`).ReplaceAllString(name, "_")
+	name = strings.Trim(name, "_")
+	if name == "" {
+		return nil, errors.New("migrations: a name is required, e.g. add_tags")
+	}
+
+	version := 1
+	for _, dialect := range Dialects {
+		existing, err := Load(os.DirFS(filepath.Join(dir, string(dialect))))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(existing) > 0 {
+			version = max(version, existing[len(existing)-1].Version+1)
+		}
+	}
+
+	var paths []string
+	for _, dialect := range Dialects {
+		base := filepath.Join(dir, string(dialect), fmt.Sprintf("%04d_%s", version, name))
+
+		for _, path := range []string{base + ".up.sql", base + ".down.sql"} {
+			if err := createFile(path); err != nil {
+				return paths, err
+			}
+			paths = append(paths, path)
+		}
+	}
+
+	return paths, nil
+}
+
+func createFile(path string) error {
+	// O_EXCL so we never overwrite a migration someone else just created.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(f, "-- %s\n", filepath.Base(path))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
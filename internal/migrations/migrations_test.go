@@ -0,0 +1,266 @@
+package migrations_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/migrations"
+	"github.com/corbinlazarone/snippetbox/internal/models/sqlite"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+var ctx = context.Background()
+
+func newMigrator(t *testing.T, db *sql.DB, dialect migrations.Dialect) *migrations.Migrator {
+	t.Helper()
+
+	migrator, err := migrations.New(db, dialect, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return migrator
+}
+
+// every migration has to roll back cleanly, and apply again after that.
+func TestUpDownSQLite(t *testing.T) {
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	migrator := newMigrator(t, db, migrations.SQLite)
+	all := len(migrator.Migrations)
+
+	for _, step := range []struct {
+		name string
+		run  func() ([]migrations.Migration, error)
+	}{
+		{"up", func() ([]migrations.Migration, error) { return migrator.Up(ctx) }},
+		{"down", func() ([]migrations.Migration, error) { return migrator.Down(ctx, all) }},
+		{"up again", func() ([]migrations.Migration, error) { return migrator.Up(ctx) }},
+	} {
+		done, err := step.run()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if len(done) != all {
+			t.Fatalf("%s: got %d migrations, want %d", step.name, len(done), all)
+		}
+	}
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil || pending != 0 {
+		t.Errorf("Pending() got %d, %v, want 0", pending, err)
+	}
+}
+
+// the sample snippets get real new lines, and snippets that only happen to
+// have a \n in them are left alone.
+func TestSeedNewlinesSQLite(t *testing.T) {
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	migrator := newMigrator(t, db, migrations.SQLite)
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Down(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, snippet := range []struct{ title, content string }{
+		{"An old silent pond", `An old silent pond...\nA frog jumps into the pond`},
+		{"printf", `printf "a\nb\n"`},
+	} {
+		_, err := db.ExecContext(ctx, `INSERT INTO snippets (title, content, created, updated, expires)
+			VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
+			INSERT INTO snippet_revisions (snippet_id, revision, title, content, content_type, created)
+			SELECT id, revision, title, content, content_type, created FROM snippets WHERE id = last_insert_rowid();`,
+			snippet.title, snippet.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"An old silent pond": "An old silent pond...\nA frog jumps into the pond",
+		"printf":             `printf "a\nb\n"`,
+	}
+
+	for _, table := range []string{"snippets", "snippet_revisions"} {
+		for title, content := range want {
+			var got string
+			if err := db.QueryRowContext(ctx, `SELECT content FROM `+table+` WHERE title = ?;`, title).Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got != content {
+				t.Errorf("%s %q: got content %q, want %q", table, title, got, content)
+			}
+		}
+	}
+}
+
+// TestAdoptInitSQL checks that a postgres database created by one of the
+// init.sql files we shipped before migrations ends up with the same schema as
+// a new one once the migrations have run, and keeps its snippets. The files in
+// testdata are init.sql as it was at the first commit, once comments were
+// added, and just before it was replaced by migrations.
+//
+// It needs TEST_DATABASE_URL, and creates and drops its own databases next to
+// that one, so the user has to be allowed to create databases.
+func TestAdoptInitSQL(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL isn't set")
+	}
+
+	fresh := newPostgresDB(t, dsn, "fresh")
+	if _, err := newMigrator(t, fresh, migrations.Postgres).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := schema(t, fresh)
+
+	for _, file := range []string{"init-baseline.sql", "init-comments.sql", "init-before-migrations.sql"} {
+		t.Run(file, func(t *testing.T) {
+			initSQL, err := os.ReadFile(filepath.Join("testdata", file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db := newPostgresDB(t, dsn, "adopt")
+			if _, err := db.ExecContext(ctx, string(initSQL)); err != nil {
+				t.Fatalf("running %s: %v", file, err)
+			}
+
+			var snippets int
+			if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM snippets;`).Scan(&snippets); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := newMigrator(t, db, migrations.Postgres).Up(ctx); err != nil {
+				t.Fatalf("migrating: %v", err)
+			}
+
+			got := schema(t, db)
+			for _, line := range want {
+				if !slices.Contains(got, line) {
+					t.Errorf("missing after migrating: %s", line)
+				}
+			}
+			for _, line := range got {
+				if !slices.Contains(want, line) {
+					t.Errorf("not in a new database: %s", line)
+				}
+			}
+
+			// every snippet kept, with its current revision saved.
+			var revisions int
+			err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM snippets
+				JOIN snippet_revisions r ON r.snippet_id = snippets.id AND r.revision = snippets.revision;`).Scan(&revisions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if snippets == 0 || revisions != snippets {
+				t.Errorf("got %d snippets with a revision, want %d", revisions, snippets)
+			}
+
+			// and the samples lost their escaped new lines.
+			var escaped int
+			err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM snippets WHERE strpos(content, '\n') > 0;`).Scan(&escaped)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if escaped != 0 {
+				t.Errorf("got %d snippets with escaped new lines, want none", escaped)
+			}
+		})
+	}
+}
+
+// newPostgresDB() creates an empty database on the server in dsn, and drops it
+// when the test is done.
+func newPostgresDB(t *testing.T, dsn, name string) *sql.DB {
+	t.Helper()
+
+	admin, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close(ctx) })
+
+	name = fmt.Sprintf("snippetbox_test_%s_%d", name, time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, `CREATE DATABASE `+name+`;`); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Database = name
+
+	db := stdlib.OpenDB(*config)
+
+	// cleanups run last in first out, so this runs before admin is closed.
+	t.Cleanup(func() {
+		db.Close()
+		if _, err := admin.Exec(ctx, `DROP DATABASE `+name+` WITH (FORCE);`); err != nil {
+			t.Errorf("dropping %s: %v", name, err)
+		}
+	})
+
+	return db
+}
+
+// schema() describes every column, index and constraint in the public schema,
+// one per line.
+func schema(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+
+	statement := `SELECT format('column %s.%s %s null=%s default=%s', table_name, column_name, data_type, is_nullable, column_default)
+									FROM information_schema.columns WHERE table_schema = 'public'
+								UNION ALL
+								SELECT format('index %s', indexdef) FROM pg_indexes WHERE schemaname = 'public'
+								UNION ALL
+								SELECT format('constraint %s %s', conname, pg_get_constraintdef(oid))
+									FROM pg_constraint WHERE connamespace = 'public'::regnamespace
+								ORDER BY 1;`
+
+	rows, err := db.QueryContext(ctx, statement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return lines
+}
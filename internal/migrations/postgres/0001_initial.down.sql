@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS notification_preferences;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS stars;
+DROP TABLE IF EXISTS snippet_referrers;
+DROP TABLE IF EXISTS snippet_daily_views;
+DROP TABLE IF EXISTS snippet_revisions;
+DROP TABLE IF EXISTS snippets;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,182 @@
+-- The schema as it was before migrations were added.
+--
+-- Databases created from an older init.sql adopt migrations by running this
+-- too, without being rebuilt: tables are only created IF NOT EXISTS, and the
+-- columns and indexes init.sql gained over time are added to the tables they
+-- already have.
+
+-- create a `users` table.
+CREATE TABLE IF NOT EXISTS public.users (
+    id INTEGER NOT NULL GENERATED BY DEFAULT AS IDENTITY,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    hashed_password CHAR(60) NOT NULL,
+    created TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    PRIMARY KEY (id),
+
+  -- Add a unique constraint on the email column.
+    CONSTRAINT users_uc_email UNIQUE (email)
+);
+
+-- Create a `snippets` table.
+CREATE TABLE IF NOT EXISTS snippets (
+    id SERIAL NOT NULL PRIMARY KEY,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    content_type VARCHAR(20) NOT NULL DEFAULT 'text',
+    -- snippets are owned by the user who created them, the sample snippets
+    -- in seed.sql have no owner.
+    user_id INTEGER CONSTRAINT snippets_fk_user REFERENCES users(id) ON DELETE SET NULL,
+    views BIGINT NOT NULL DEFAULT 0,
+    revision INTEGER NOT NULL DEFAULT 1,
+    expiry_notified BOOLEAN NOT NULL DEFAULT false,
+    created TIMESTAMP NOT NULL,
+    expires TIMESTAMP NOT NULL
+);
+
+-- an older snippets table has none of the columns added since the first
+-- init.sql, or only some of them. Existing snippets are owned by nobody.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS content_type VARCHAR(20) NOT NULL DEFAULT 'text';
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS user_id INTEGER CONSTRAINT snippets_fk_user REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS views BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS expiry_notified BOOLEAN NOT NULL DEFAULT false;
+
+-- the first init.sql indexed created on its own, under the same name.
+DROP INDEX IF EXISTS idx_snippets_created;
+
+-- Add an index for each sort order of the home listing. The id column breaks
+-- ties so that keyset pagination has a total order to walk.
+CREATE INDEX IF NOT EXISTS idx_snippets_created ON snippets(created, id);
+CREATE INDEX IF NOT EXISTS idx_snippets_expires ON snippets(expires, id);
+CREATE INDEX IF NOT EXISTS idx_snippets_views ON snippets(views, id);
+
+-- Used to find snippets that have expired but haven't had their webhooks sent.
+CREATE INDEX IF NOT EXISTS idx_snippets_expiry_pending ON snippets(expires) WHERE NOT expiry_notified;
+
+-- Every version of a snippet's content. The current version is also kept on
+-- the snippets table, this is what line comments on older versions point at.
+CREATE TABLE IF NOT EXISTS snippet_revisions (
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    content_type VARCHAR(20) NOT NULL,
+    created TIMESTAMP NOT NULL,
+    PRIMARY KEY (snippet_id, revision)
+);
+
+-- snippets from before revisions were kept need their current revision saved.
+INSERT INTO snippet_revisions (snippet_id, revision, title, content, content_type, created)
+SELECT id, revision, title, content, content_type, created FROM snippets
+ON CONFLICT (snippet_id, revision) DO NOTHING;
+
+-- Per day and per referrer view counts, flushed in batches by the web app.
+CREATE TABLE IF NOT EXISTS snippet_daily_views (
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    views BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (snippet_id, day)
+);
+
+CREATE TABLE IF NOT EXISTS snippet_referrers (
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    referrer VARCHAR(255) NOT NULL,
+    views BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (snippet_id, referrer)
+);
+
+-- Stars a user has given to snippets. The primary key makes sure a user can
+-- only star a snippet once.
+CREATE TABLE IF NOT EXISTS stars (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    created TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, snippet_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stars_snippet_created ON stars(snippet_id, created);
+CREATE INDEX IF NOT EXISTS idx_stars_created ON stars(created);
+
+-- Comments on snippets. A reply points at the top level comment it belongs
+-- to through parent_id, we only allow one level of replies.
+CREATE TABLE IF NOT EXISTS comments (
+    id SERIAL NOT NULL PRIMARY KEY,
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    parent_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    -- line comments point at a line of a specific revision of the snippet,
+    -- both are NULL for comments on the snippet as a whole.
+    line INTEGER,
+    revision INTEGER,
+    body TEXT NOT NULL,
+    created TIMESTAMP NOT NULL,
+    updated TIMESTAMP
+);
+
+-- comments from before line comments are on the snippet as a whole.
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS line INTEGER;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS revision INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_comments_snippet ON comments(snippet_id, created);
+
+-- Endpoints that get a signed POST whenever one of the listed snippet events
+-- happens, and the log of every delivery attempt.
+CREATE TABLE IF NOT EXISTS webhooks (
+    id SERIAL NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    events TEXT[] NOT NULL,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event VARCHAR(50) NOT NULL,
+    payload TEXT NOT NULL,
+    attempt INTEGER NOT NULL,
+    status_code INTEGER,
+    response TEXT NOT NULL,
+    error TEXT NOT NULL,
+    duration_ms BIGINT NOT NULL,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
+
+-- In-app notifications, e.g. someone starred or commented on one of your
+-- snippets. actor_id is the user whose action caused the notification.
+CREATE TABLE IF NOT EXISTS notifications (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    read BOOLEAN NOT NULL DEFAULT false,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, id);
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(user_id) WHERE NOT read;
+
+-- Which kinds of notification a user has switched off. A kind with no row is
+-- switched on.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, kind)
+);
+
+-- Create a `sessions` table.
+CREATE TABLE IF NOT EXISTS sessions (
+    token CHAR(43) PRIMARY KEY,
+    data BYTEA NOT NULL,
+    expiry TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Add an index on the expiry column.
+CREATE INDEX IF NOT EXISTS sessions_expiry_idx ON sessions (expiry);
@@ -0,0 +1,10 @@
+-- When a snippet's content last changed, for the Last-Modified header. Existing
+-- snippets get the time their current revision was saved.
+ALTER TABLE snippets ADD COLUMN updated TIMESTAMP;
+
+UPDATE snippets SET updated = COALESCE(
+    (SELECT r.created FROM snippet_revisions r WHERE r.snippet_id = snippets.id AND r.revision = snippets.revision),
+    snippets.created
+);
+
+ALTER TABLE snippets ALTER COLUMN updated SET NOT NULL;
@@ -0,0 +1,12 @@
+-- The sample snippets from init.sql and seed.sql were stored with escaped new
+-- lines, a literal backslash followed by an n, which the app used to turn into
+-- real ones on every page. It now shows content exactly as it was written, so
+-- fix the samples here instead. Only the samples are touched, a user's
+-- snippet can have a real \n in it.
+UPDATE snippets SET content = replace(content, '\n', chr(10))
+WHERE title IN ('An old silent pond', 'Over the wintry forest', 'First autumn morning')
+    AND strpos(content, '\n') > 0 AND strpos(content, chr(10)) = 0;
+
+UPDATE snippet_revisions SET content = replace(content, '\n', chr(10))
+WHERE title IN ('An old silent pond', 'Over the wintry forest', 'First autumn morning')
+    AND strpos(content, '\n') > 0 AND strpos(content, chr(10)) = 0;
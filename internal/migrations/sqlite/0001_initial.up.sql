@@ -0,0 +1,135 @@
+-- The same schema as postgres/0001_initial.up.sql, in SQLite's types.
+--
+-- NOTE: times are stored as text in the driver's _time_format=sqlite layout,
+-- always in UTC, so comparing them as strings orders them correctly. Webhook
+-- events are a JSON array, SQLite has no array type.
+
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    hashed_password CHAR(60) NOT NULL,
+    created TIMESTAMP NOT NULL,
+    CONSTRAINT users_uc_email UNIQUE (email)
+);
+
+CREATE TABLE IF NOT EXISTS snippets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    content_type VARCHAR(20) NOT NULL DEFAULT 'text',
+    user_id INTEGER CONSTRAINT snippets_fk_user REFERENCES users(id) ON DELETE SET NULL,
+    views BIGINT NOT NULL DEFAULT 0,
+    revision INTEGER NOT NULL DEFAULT 1,
+    expiry_notified BOOLEAN NOT NULL DEFAULT false,
+    created TIMESTAMP NOT NULL,
+    expires TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_snippets_created ON snippets(created, id);
+CREATE INDEX IF NOT EXISTS idx_snippets_expires ON snippets(expires, id);
+CREATE INDEX IF NOT EXISTS idx_snippets_views ON snippets(views, id);
+CREATE INDEX IF NOT EXISTS idx_snippets_expiry_pending ON snippets(expires) WHERE NOT expiry_notified;
+
+CREATE TABLE IF NOT EXISTS snippet_revisions (
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    content_type VARCHAR(20) NOT NULL,
+    created TIMESTAMP NOT NULL,
+    PRIMARY KEY (snippet_id, revision)
+);
+
+CREATE TABLE IF NOT EXISTS snippet_daily_views (
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    views BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (snippet_id, day)
+);
+
+CREATE TABLE IF NOT EXISTS snippet_referrers (
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    referrer VARCHAR(255) NOT NULL,
+    views BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (snippet_id, referrer)
+);
+
+CREATE TABLE IF NOT EXISTS stars (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    created TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, snippet_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stars_snippet_created ON stars(snippet_id, created);
+CREATE INDEX IF NOT EXISTS idx_stars_created ON stars(created);
+
+CREATE TABLE IF NOT EXISTS comments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    parent_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    line INTEGER,
+    revision INTEGER,
+    body TEXT NOT NULL,
+    created TIMESTAMP NOT NULL,
+    updated TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_snippet ON comments(snippet_id, created);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    events TEXT NOT NULL,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event VARCHAR(50) NOT NULL,
+    payload TEXT NOT NULL,
+    attempt INTEGER NOT NULL,
+    status_code INTEGER,
+    response TEXT NOT NULL,
+    error TEXT NOT NULL,
+    duration_ms BIGINT NOT NULL,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    read BOOLEAN NOT NULL DEFAULT false,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, id);
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(user_id) WHERE NOT read;
+
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, kind)
+);
+
+-- the layout github.com/alexedwards/scs/sqlite3store expects, expiry is a
+-- julian day number.
+CREATE TABLE IF NOT EXISTS sessions (
+    token TEXT PRIMARY KEY,
+    data BLOB NOT NULL,
+    expiry REAL NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_expiry_idx ON sessions(expiry);
@@ -0,0 +1,10 @@
+-- The same as postgres/0002_snippet_updated.up.sql.
+--
+-- NOTE: SQLite can't add a NOT NULL column without a default, so the column
+-- is nullable here. The models always set it.
+ALTER TABLE snippets ADD COLUMN updated TIMESTAMP;
+
+UPDATE snippets SET updated = COALESCE(
+    (SELECT r.created FROM snippet_revisions r WHERE r.snippet_id = snippets.id AND r.revision = snippets.revision),
+    snippets.created
+);
@@ -0,0 +1,7 @@
+UPDATE snippets SET content = replace(content, char(10), '\n')
+WHERE title IN ('An old silent pond', 'Over the wintry forest', 'First autumn morning')
+    AND instr(content, '\n') = 0;
+
+UPDATE snippet_revisions SET content = replace(content, char(10), '\n')
+WHERE title IN ('An old silent pond', 'Over the wintry forest', 'First autumn morning')
+    AND instr(content, '\n') = 0;
@@ -0,0 +1,8 @@
+-- The same as postgres/0003_seed_newlines.up.sql.
+UPDATE snippets SET content = replace(content, '\n', char(10))
+WHERE title IN ('An old silent pond', 'Over the wintry forest', 'First autumn morning')
+    AND instr(content, '\n') > 0 AND instr(content, char(10)) = 0;
+
+UPDATE snippet_revisions SET content = replace(content, '\n', char(10))
+WHERE title IN ('An old silent pond', 'Over the wintry forest', 'First autumn morning')
+    AND instr(content, '\n') > 0 AND instr(content, char(10)) = 0;
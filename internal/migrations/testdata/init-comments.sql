@@ -0,0 +1,108 @@
+-- Create a `snippets` table.
+CREATE TABLE snippets (
+    id SERIAL NOT NULL PRIMARY KEY,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    content_type VARCHAR(20) NOT NULL DEFAULT 'text',
+    user_id INTEGER,
+    views BIGINT NOT NULL DEFAULT 0,
+    created TIMESTAMP NOT NULL,
+    expires TIMESTAMP NOT NULL
+);
+
+-- Add an index for each sort order of the home listing. The id column breaks
+-- ties so that keyset pagination has a total order to walk.
+CREATE INDEX idx_snippets_created ON snippets(created, id);
+CREATE INDEX idx_snippets_expires ON snippets(expires, id);
+CREATE INDEX idx_snippets_views ON snippets(views, id);
+
+-- create a `users` table.
+CREATE TABLE public.users (
+    id INTEGER NOT NULL GENERATED BY DEFAULT AS IDENTITY,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    hashed_password CHAR(60) NOT NULL,
+    created TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    PRIMARY KEY (id),
+
+  -- Add a unique constraint on the email column.
+    CONSTRAINT users_uc_email UNIQUE (email)
+);
+
+-- Snippets are owned by the user who created them. The dummy records below
+-- have no owner.
+ALTER TABLE snippets ADD CONSTRAINT snippets_fk_user
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+-- Per day and per referrer view counts, flushed in batches by the web app.
+CREATE TABLE snippet_daily_views (
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    views BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (snippet_id, day)
+);
+
+CREATE TABLE snippet_referrers (
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    referrer VARCHAR(255) NOT NULL,
+    views BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (snippet_id, referrer)
+);
+
+-- Stars a user has given to snippets. The primary key makes sure a user can
+-- only star a snippet once.
+CREATE TABLE stars (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    created TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, snippet_id)
+);
+
+CREATE INDEX idx_stars_snippet_created ON stars(snippet_id, created);
+CREATE INDEX idx_stars_created ON stars(created);
+
+-- Comments on snippets. A reply points at the top level comment it belongs
+-- to through parent_id, we only allow one level of replies.
+CREATE TABLE comments (
+    id SERIAL NOT NULL PRIMARY KEY,
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    parent_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created TIMESTAMP NOT NULL,
+    updated TIMESTAMP
+);
+
+CREATE INDEX idx_comments_snippet ON comments(snippet_id, created);
+
+-- Create a `sessions` table.
+CREATE TABLE sessions (
+    token CHAR(43) PRIMARY KEY,
+    data BYTEA NOT NULL,
+    expiry TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Add an index on the expiry column.
+CREATE INDEX sessions_expiry_idx ON sessions (expiry);
+
+-- Add some dummy records.
+INSERT INTO snippets (title, content, created, expires) VALUES (
+    'An old silent pond',
+    'An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.\n\n– Matsuo Bashō',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC' + INTERVAL '365 days'
+);
+
+INSERT INTO snippets (title, content, created, expires) VALUES (
+    'Over the wintry forest',
+    'Over the wintry\nforest, winds howl in rage\nwith no leaves to blow.\n\n– Natsume Soseki',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC' + INTERVAL '365 days'
+);
+
+INSERT INTO snippets (title, content, created, expires) VALUES (
+    'First autumn morning',
+    'First autumn morning\nthe mirror I stare into\nshows my father''s face.\n\n– Murakami Kijo',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC' + INTERVAL '7 days'
+);
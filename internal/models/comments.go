@@ -0,0 +1,207 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// comment struct to represent a single comment on a snippet
+type Comment struct {
+	ID        int
+	SnippetID int
+	UserID    int
+	UserName  string
+	ParentID  int // 0 for a top level comment
+	Line      int // line of the snippet the comment is on, 0 for the snippet as a whole
+	Revision  int // revision of the snippet Line refers to, 0 if Line is 0
+	Body      string
+	Created   time.Time
+	Edited    bool
+	Replies   []Comment `db:"-"` // only filled in on top level comments
+}
+
+// commentColumns lists the columns selected for a Comment, the author's name is
+// joined in from the users table.
+const commentColumns = `comments.id, comments.snippet_id, comments.user_id, users.name AS user_name,
+	COALESCE(comments.parent_id, 0) AS parent_id, COALESCE(comments.line, 0) AS line,
+	COALESCE(comments.revision, 0) AS revision, comments.body, comments.created,
+	comments.updated IS NOT NULL AS edited`
+
+// CommentModelInterface is what the web app needs from a comment store.
+type CommentModelInterface interface {
+	Insert(ctx context.Context, snippetID, userID, parentID, line, revision int, body string) (int, error)
+	Get(ctx context.Context, id int) (*Comment, error)
+	Update(ctx context.Context, id int, body string) error
+	Delete(ctx context.Context, id int) error
+	ForSnippet(ctx context.Context, snippetID int) ([]Comment, error)
+}
+
+// comment model that wraps a postgres db connection
+type CommentModel struct {
+	DB      *pgxpool.Pool
+	Timeout time.Duration // how long a single query may run, 0 for no limit
+}
+
+// Insert adds a comment to a snippet and returns its id. parentID is the comment
+// being replied to, or 0 for a top level comment. line and revision anchor a
+// top level comment to a line of a specific revision of the snippet, pass 0 for
+// both to comment on the snippet as a whole.
+//
+// NOTE: we only support one level of replies, so a reply to a reply is attached
+// to the top level comment of that thread instead. Replies always sit on the
+// same line and revision as the comment they belong to.
+func (c *CommentModel) Insert(ctx context.Context, snippetID, userID, parentID, line, revision int, body string) (int, error) {
+	ctx, cancel := withTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	// these stay NULL unless they are set below.
+	var parent, lineArg, revisionArg any
+	if line != 0 {
+		lineArg, revisionArg = line, revision
+	}
+
+	if parentID != 0 {
+		var grandparentID, parentLine, parentRevision *int
+		statement := `SELECT parent_id, line, revision FROM comments WHERE id = $1 AND snippet_id = $2;`
+
+		err := c.DB.QueryRow(ctx, statement, parentID, snippetID).Scan(&grandparentID, &parentLine, &parentRevision)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return 0, ErrNoRecord
+			}
+			return 0, classify(err)
+		}
+
+		parent = parentID
+		if grandparentID != nil {
+			parent = *grandparentID
+		}
+
+		lineArg, revisionArg = parentLine, parentRevision
+	}
+
+	var id int
+	statement := `INSERT INTO comments (snippet_id, user_id, parent_id, line, revision, body, created)
+								VALUES ($1, $2, $3, $4, $5, $6, NOW() AT TIME ZONE 'UTC') RETURNING id;`
+
+	err := c.DB.QueryRow(ctx, statement, snippetID, userID, parent, lineArg, revisionArg, body).Scan(&id)
+	if err != nil {
+		return 0, classify(err)
+	}
+
+	return id, nil
+}
+
+// Get comment by ID
+func (c *CommentModel) Get(ctx context.Context, id int) (*Comment, error) {
+	ctx, cancel := withTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	statement := `SELECT ` + commentColumns + ` FROM comments
+								JOIN users ON users.id = comments.user_id
+								WHERE comments.id = $1;`
+
+	rows, err := c.DB.Query(ctx, statement, id)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	comment, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[Comment])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, classify(err)
+	}
+
+	return comment, nil
+}
+
+// Update replaces the body of a comment and marks it as edited.
+func (c *CommentModel) Update(ctx context.Context, id int, body string) error {
+	ctx, cancel := withTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	statement := `UPDATE comments SET body = $2, updated = NOW() AT TIME ZONE 'UTC' WHERE id = $1;`
+
+	tag, err := c.DB.Exec(ctx, statement, id, body)
+	if err != nil {
+		return classify(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Delete removes a comment. Deleting a top level comment removes its replies
+// too (the parent_id foreign key cascades).
+func (c *CommentModel) Delete(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	statement := `DELETE FROM comments WHERE id = $1;`
+
+	tag, err := c.DB.Exec(ctx, statement, id)
+	if err != nil {
+		return classify(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// ForSnippet returns the comments on a snippet as threads: the top level
+// comments oldest first, each with its replies (also oldest first).
+func (c *CommentModel) ForSnippet(ctx context.Context, snippetID int) ([]Comment, error) {
+	ctx, cancel := withTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	statement := `SELECT ` + commentColumns + ` FROM comments
+								JOIN users ON users.id = comments.user_id
+								WHERE comments.snippet_id = $1
+								ORDER BY comments.created, comments.id;`
+
+	rows, err := c.DB.Query(ctx, statement, snippetID)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	comments, err := pgx.CollectRows(rows, pgx.RowToStructByName[Comment])
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	return ThreadComments(comments), nil
+}
+
+// ThreadComments() groups a flat, oldest first, list of comments into top level
+// comments with their replies nested underneath.
+func ThreadComments(comments []Comment) []Comment {
+	threads := []Comment{}
+	position := make(map[int]int) // top level comment id -> index in threads
+
+	for _, comment := range comments {
+		if comment.ParentID == 0 {
+			position[comment.ID] = len(threads)
+			threads = append(threads, comment)
+		}
+	}
+
+	for _, comment := range comments {
+		if i, ok := position[comment.ParentID]; ok {
+			threads[i].Replies = append(threads[i].Replies, comment)
+		}
+	}
+
+	return threads
+}
@@ -1,6 +1,16 @@
 package models
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
 
 var (
 	ErrNoRecord = errors.New("models: no matching record found")
@@ -8,4 +18,76 @@ var (
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 
 	ErrDuplicateEmail = errors.New("models: duplicate email")
+
+	ErrInvalidSort = errors.New("models: invalid sort order")
+
+	ErrInvalidCursor = errors.New("models: invalid page cursor")
+
+	// ErrConstraint means the database refused a write because it would break
+	// a constraint, e.g. a snippet owned by a user that no longer exists.
+	ErrConstraint = errors.New("models: constraint violation")
+
+	// ErrUnavailable means the database couldn't be reached or isn't taking
+	// queries right now. Trying again later may work.
+	ErrUnavailable = errors.New("models: database unavailable")
+
+	// ErrTimeout means a query ran out of time, either the per-query timeout
+	// or the caller's deadline.
+	ErrTimeout = errors.New("models: query timed out")
 )
+
+// classify() wraps a database error in ErrConstraint, ErrUnavailable or
+// ErrTimeout when it is one of those, so callers can tell them apart without
+// knowing about pgx. The original error stays in the chain for the logs.
+// Anything else, including nil, is returned as it is.
+func classify(err error) error {
+	var postgresqlError *pgconn.PgError
+	var connectError *pgconn.ConnectError
+	var netError net.Error
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err):
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	case errors.As(err, &postgresqlError):
+		// the first two characters of the code are its class: 23 is an
+		// integrity constraint violation, 08 a connection exception, 53 the
+		// server running out of resources and 57P the server shutting down.
+		switch code := postgresqlError.Code; {
+		case strings.HasPrefix(code, "23"):
+			return fmt.Errorf("%w: %w", ErrConstraint, err)
+		case strings.HasPrefix(code, "08"), strings.HasPrefix(code, "53"), strings.HasPrefix(code, "57P"):
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+	case errors.As(err, &connectError), errors.As(err, &netError), errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	return err
+}
+
+// isForeignKeyViolation() reports whether err is postgres complaining that a row
+// refers to another row that doesn't exist (error code 23503).
+func isForeignKeyViolation(err error) bool {
+	var postgresqlError *pgconn.PgError
+	return errors.As(err, &postgresqlError) && postgresqlError.Code == "23503"
+}
+
+// utcNow() is the current time in UTC. Timestamps are stored without a time
+// zone, so passing the time in (rather than using the database's NOW()) keeps
+// the queries the same across databases and the stored times in UTC.
+func utcNow() time.Time {
+	return time.Now().UTC()
+}
+
+// withTimeout() bounds a single query, so a slow one gives up rather than
+// holding a connection until the database is done with it. A timeout of 0
+// leaves ctx as it is.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,125 @@
+package mocks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+// CommentModel is an in-memory models.CommentModelInterface. Author names come
+// from users.
+type CommentModel struct {
+	mu       sync.Mutex
+	nextID   int
+	users    *UserModel
+	comments map[int]*models.Comment
+}
+
+var _ models.CommentModelInterface = (*CommentModel)(nil)
+
+func NewCommentModel(users *UserModel) *CommentModel {
+	return &CommentModel{nextID: 1, users: users, comments: map[int]*models.Comment{}}
+}
+
+// Insert threads replies like the postgres model: a reply to a reply goes on
+// the top level comment, and replies take their line and revision from it.
+func (m *CommentModel) Insert(_ context.Context, snippetID, userID, parentID, line, revision int, body string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comment := &models.Comment{
+		ID:        m.nextID,
+		SnippetID: snippetID,
+		UserID:    userID,
+		Body:      body,
+		Created:   time.Now().UTC(),
+	}
+	if line != 0 {
+		comment.Line, comment.Revision = line, revision
+	}
+
+	if parentID != 0 {
+		parent, ok := m.comments[parentID]
+		if !ok || parent.SnippetID != snippetID {
+			return 0, models.ErrNoRecord
+		}
+
+		comment.ParentID = parentID
+		if parent.ParentID != 0 {
+			comment.ParentID = parent.ParentID
+		}
+		comment.Line, comment.Revision = parent.Line, parent.Revision
+	}
+
+	m.nextID++
+	m.comments[comment.ID] = comment
+
+	return comment.ID, nil
+}
+
+func (m *CommentModel) Get(_ context.Context, id int) (*models.Comment, error) {
+	m.mu.Lock()
+	comment, ok := m.comments[id]
+	m.mu.Unlock()
+
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+
+	c := *comment
+	c.UserName = m.users.name(c.UserID)
+	return &c, nil
+}
+
+func (m *CommentModel) Update(_ context.Context, id int, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comment, ok := m.comments[id]
+	if !ok {
+		return models.ErrNoRecord
+	}
+
+	comment.Body = body
+	comment.Edited = true
+	return nil
+}
+
+// Delete removes a comment and its replies.
+func (m *CommentModel) Delete(_ context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.comments[id]; !ok {
+		return models.ErrNoRecord
+	}
+
+	delete(m.comments, id)
+	for replyID, comment := range m.comments {
+		if comment.ParentID == id {
+			delete(m.comments, replyID)
+		}
+	}
+
+	return nil
+}
+
+func (m *CommentModel) ForSnippet(_ context.Context, snippetID int) ([]models.Comment, error) {
+	m.mu.Lock()
+	var comments []models.Comment
+	for id := 1; id < m.nextID; id++ {
+		if comment, ok := m.comments[id]; ok && comment.SnippetID == snippetID {
+			comments = append(comments, *comment)
+		}
+	}
+	m.mu.Unlock()
+
+	for i := range comments {
+		comments[i].UserName = m.users.name(comments[i].UserID)
+	}
+
+	// ids go up with time, so this is oldest first.
+	return models.ThreadComments(comments), nil
+}
@@ -0,0 +1,146 @@
+package mocks
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+// NotificationModel is an in-memory models.NotificationModelInterface. Actor
+// names and snippet titles come from users and snippets.
+type NotificationModel struct {
+	mu            sync.Mutex
+	users         *UserModel
+	snippets      *SnippetModel
+	notifications []models.Notification // oldest first
+	disabled      map[int][]string      // kinds each user has switched off
+}
+
+var _ models.NotificationModelInterface = (*NotificationModel)(nil)
+
+func NewNotificationModel(users *UserModel, snippets *SnippetModel) *NotificationModel {
+	return &NotificationModel{users: users, snippets: snippets, disabled: map[int][]string{}}
+}
+
+func (m *NotificationModel) Insert(_ context.Context, userID, actorID int, kind string, snippetID, commentID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if userID == actorID || slices.Contains(m.disabled[userID], kind) {
+		return false, nil
+	}
+
+	m.notifications = append(m.notifications, models.Notification{
+		ID:        len(m.notifications) + 1,
+		UserID:    userID,
+		ActorID:   actorID,
+		Kind:      kind,
+		SnippetID: snippetID,
+		CommentID: commentID,
+		Created:   time.Now().UTC(),
+	})
+
+	return true, nil
+}
+
+// ForUser returns a user's most recent notifications, newest first. Like the
+// postgres model's join, notifications about deleted snippets are left out.
+func (m *NotificationModel) ForUser(_ context.Context, userID, limit int) ([]models.Notification, error) {
+	m.mu.Lock()
+	var mine []models.Notification
+	for i := len(m.notifications) - 1; i >= 0; i-- {
+		if m.notifications[i].UserID == userID {
+			mine = append(mine, m.notifications[i])
+		}
+	}
+	m.mu.Unlock()
+
+	notifications := []models.Notification{}
+	for _, n := range mine {
+		snippet, ok := m.snippets.stored(n.SnippetID)
+		if !ok {
+			continue
+		}
+
+		n.SnippetTitle = snippet.Title
+		n.ActorName = m.users.name(n.ActorID)
+		notifications = append(notifications, n)
+
+		if len(notifications) == limit {
+			break
+		}
+	}
+
+	return notifications, nil
+}
+
+func (m *NotificationModel) UnreadCount(_ context.Context, userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, n := range m.notifications {
+		if n.UserID == userID && !n.Read {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (m *NotificationModel) MarkRead(_ context.Context, id, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.notifications {
+		if m.notifications[i].ID == id && m.notifications[i].UserID == userID {
+			m.notifications[i].Read = true
+			return nil
+		}
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *NotificationModel) MarkAllRead(_ context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.notifications {
+		if m.notifications[i].UserID == userID {
+			m.notifications[i].Read = true
+		}
+	}
+
+	return nil
+}
+
+func (m *NotificationModel) Preferences(_ context.Context, userID int) (map[string]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prefs := make(map[string]bool, len(models.NotificationKinds))
+	for _, kind := range models.NotificationKinds {
+		prefs[kind] = !slices.Contains(m.disabled[userID], kind)
+	}
+
+	return prefs, nil
+}
+
+func (m *NotificationModel) SetPreferences(_ context.Context, userID int, enabled []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var disabled []string
+	for _, kind := range models.NotificationKinds {
+		if !slices.Contains(enabled, kind) {
+			disabled = append(disabled, kind)
+		}
+	}
+	m.disabled[userID] = disabled
+
+	return nil
+}
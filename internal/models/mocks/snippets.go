@@ -0,0 +1,261 @@
+// Package mocks has in-memory versions of the model stores, for testing the
+// web app without a database. They behave like the postgres models as far as
+// the handlers can tell: the same errors for missing records, expired snippets
+// are hidden, and every edit is kept as a revision. Nothing in memory is slow
+// enough to need a timeout, so the contexts are ignored.
+//
+// Sessions don't need anything here, scs.Store is already an interface and
+// scs ships an in-memory one in github.com/alexedwards/scs/v2/memstore.
+package mocks
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+// SnippetModel is an in-memory models.SnippetModelInterface.
+type SnippetModel struct {
+	mu        sync.Mutex
+	nextID    int
+	snippets  map[int]*models.Snippet
+	revisions map[int][]models.Snippet // every revision of a snippet, oldest first
+	notified  map[int]bool             // snippets MarkExpired() has already returned
+
+	// Now returns the current time, tests can replace it to expire snippets.
+	Now func() time.Time
+}
+
+var _ models.SnippetModelInterface = (*SnippetModel)(nil)
+
+func NewSnippetModel() *SnippetModel {
+	return &SnippetModel{
+		nextID:    1,
+		snippets:  map[int]*models.Snippet{},
+		revisions: map[int][]models.Snippet{},
+		notified:  map[int]bool{},
+		Now:       func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (m *SnippetModel) Insert(_ context.Context, userID int, title string, content string, contentType string, expires int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.Now()
+	snippet := &models.Snippet{
+		ID:          m.nextID,
+		Title:       title,
+		Content:     content,
+		ContentType: contentType,
+		UserID:      userID,
+		Revision:    1,
+		Created:     now,
+		Updated:     now,
+		Expires:     now.AddDate(0, 0, expires),
+	}
+	m.nextID++
+
+	m.snippets[snippet.ID] = snippet
+	m.revisions[snippet.ID] = []models.Snippet{*snippet}
+
+	return snippet.ID, nil
+}
+
+// live() returns an unexpired snippet. The caller must hold mu.
+func (m *SnippetModel) live(id int) (*models.Snippet, bool) {
+	snippet, ok := m.snippets[id]
+	if !ok || !snippet.Expires.After(m.Now()) {
+		return nil, false
+	}
+	return snippet, true
+}
+
+func (m *SnippetModel) Get(_ context.Context, id int) (*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snippet, ok := m.live(id)
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+
+	s := *snippet
+	return &s, nil
+}
+
+func (m *SnippetModel) Update(_ context.Context, id int, title, content, contentType string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snippet, ok := m.live(id)
+	if !ok {
+		return 0, models.ErrNoRecord
+	}
+
+	snippet.Title, snippet.Content, snippet.ContentType = title, content, contentType
+	snippet.Revision++
+	snippet.Updated = m.Now()
+	m.revisions[id] = append(m.revisions[id], *snippet)
+
+	return snippet.Revision, nil
+}
+
+func (m *SnippetModel) Delete(_ context.Context, id int) (*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snippet, ok := m.snippets[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+
+	delete(m.snippets, id)
+	delete(m.revisions, id)
+	delete(m.notified, id)
+
+	return snippet, nil
+}
+
+func (m *SnippetModel) MarkExpired(_ context.Context) ([]models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expired := []models.Snippet{}
+	for id, snippet := range m.snippets {
+		if !snippet.Expires.After(m.Now()) && !m.notified[id] {
+			m.notified[id] = true
+			expired = append(expired, *snippet)
+		}
+	}
+
+	return expired, nil
+}
+
+func (m *SnippetModel) GetRevision(_ context.Context, id, revision int) (*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snippet, ok := m.live(id)
+	if !ok || revision < 1 || revision > len(m.revisions[id]) {
+		return nil, models.ErrNoRecord
+	}
+
+	// like the postgres model, only the content comes from the revision.
+	old := m.revisions[id][revision-1]
+	s := *snippet
+	s.Title, s.Content, s.ContentType, s.Revision, s.Updated = old.Title, old.Content, old.ContentType, old.Revision, old.Updated
+
+	return &s, nil
+}
+
+func (m *SnippetModel) GetMany(_ context.Context, ids []int) ([]models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snippets := []models.Snippet{}
+	for _, id := range ids {
+		if snippet, ok := m.live(id); ok {
+			snippets = append(snippets, *snippet)
+		}
+	}
+
+	slices.SortFunc(snippets, func(a, b models.Snippet) int { return a.ID - b.ID })
+	return slices.CompactFunc(snippets, func(a, b models.Snippet) bool { return a.ID == b.ID }), nil
+}
+
+// List pages through the snippets in the same orders as the postgres model.
+//
+// NOTE: the cursors here are plain offsets rather than keyset positions, so
+// they mean nothing to the postgres model and vice versa. Handlers treat them
+// as opaque, so that doesn't matter.
+func (m *SnippetModel) List(_ context.Context, sort string, limit int, cursor string) (*models.SnippetPage, error) {
+	if !models.IsValidSort(sort) {
+		return nil, models.ErrInvalidSort
+	}
+
+	offset := 0
+	if cursor != "" {
+		var err error
+		offset, err = strconv.Atoi(cursor)
+		if err != nil || offset < 0 {
+			return nil, models.ErrInvalidCursor
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snippets := []models.Snippet{}
+	for id := range m.snippets {
+		if snippet, ok := m.live(id); ok {
+			snippets = append(snippets, *snippet)
+		}
+	}
+
+	slices.SortFunc(snippets, func(a, b models.Snippet) int {
+		var c int
+		switch sort {
+		case models.SortNewest:
+			c = b.Created.Compare(a.Created)
+		case models.SortOldest:
+			c = a.Created.Compare(b.Created)
+		case models.SortExpiring:
+			c = a.Expires.Compare(b.Expires)
+		case models.SortMostViewed:
+			c = cmp.Compare(b.Views, a.Views)
+		}
+		if c == 0 {
+			c = a.ID - b.ID
+		}
+		return c
+	})
+
+	page := &models.SnippetPage{}
+
+	if offset < len(snippets) {
+		end := min(offset+limit, len(snippets))
+		page.Snippets = snippets[offset:end]
+
+		if end < len(snippets) {
+			page.NextCursor = strconv.Itoa(end)
+		}
+	}
+
+	if offset > 0 {
+		page.PrevCursor = strconv.Itoa(max(offset-limit, 0))
+	}
+
+	return page, nil
+}
+
+// addViews() adds to a snippet's view count, for the view model. It returns
+// false if the snippet has been deleted.
+func (m *SnippetModel) addViews(id int, n int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snippet, ok := m.snippets[id]
+	if ok {
+		snippet.Views += n
+	}
+	return ok
+}
+
+// stored() returns a snippet whether or not it has expired, for the stores
+// that join snippets in without checking.
+func (m *SnippetModel) stored(id int) (models.Snippet, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snippet, ok := m.snippets[id]
+	if !ok {
+		return models.Snippet{}, false
+	}
+	return *snippet, true
+}
@@ -0,0 +1,139 @@
+package mocks
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+type star struct {
+	userID, snippetID int
+}
+
+// StarModel is an in-memory models.StarModelInterface, for the snippets in
+// snippets.
+type StarModel struct {
+	mu       sync.Mutex
+	snippets *SnippetModel
+	stars    map[star]time.Time // when each star was given
+}
+
+var _ models.StarModelInterface = (*StarModel)(nil)
+
+func NewStarModel(snippets *SnippetModel) *StarModel {
+	return &StarModel{snippets: snippets, stars: map[star]time.Time{}}
+}
+
+func (m *StarModel) Star(_ context.Context, userID, snippetID int) (bool, error) {
+	// only unexpired snippets can be starred.
+	if _, err := m.snippets.Get(context.Background(), snippetID); err != nil {
+		return false, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := star{userID, snippetID}
+	if _, ok := m.stars[key]; ok {
+		return false, nil
+	}
+
+	m.stars[key] = m.snippets.Now()
+	return true, nil
+}
+
+func (m *StarModel) Unstar(_ context.Context, userID, snippetID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := star{userID, snippetID}
+	_, ok := m.stars[key]
+	delete(m.stars, key)
+
+	return ok, nil
+}
+
+func (m *StarModel) Count(_ context.Context, snippetID int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	for key := range m.stars {
+		if key.snippetID == snippetID {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (m *StarModel) IsStarred(_ context.Context, userID, snippetID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.stars[star{userID, snippetID}]
+	return ok, nil
+}
+
+func (m *StarModel) Starred(_ context.Context, userID int) ([]models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	type starred struct {
+		snippet models.Snippet
+		created time.Time
+	}
+
+	var all []starred
+	for key, created := range m.stars {
+		if key.userID != userID {
+			continue
+		}
+		if snippet, err := m.snippets.Get(context.Background(), key.snippetID); err == nil {
+			all = append(all, starred{*snippet, created})
+		}
+	}
+
+	// most recently starred first.
+	slices.SortFunc(all, func(a, b starred) int {
+		return cmp.Or(b.created.Compare(a.created), b.snippet.ID-a.snippet.ID)
+	})
+
+	snippets := []models.Snippet{}
+	for _, s := range all {
+		snippets = append(snippets, s.snippet)
+	}
+
+	return snippets, nil
+}
+
+func (m *StarModel) MostStarredThisWeek(_ context.Context, limit int) ([]models.StarredSnippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	weekAgo := m.snippets.Now().AddDate(0, 0, -7)
+
+	counts := map[int]int64{}
+	for key, created := range m.stars {
+		if created.After(weekAgo) {
+			counts[key.snippetID]++
+		}
+	}
+
+	most := []models.StarredSnippet{}
+	for id, stars := range counts {
+		if snippet, err := m.snippets.Get(context.Background(), id); err == nil {
+			most = append(most, models.StarredSnippet{Snippet: *snippet, Stars: stars})
+		}
+	}
+
+	slices.SortFunc(most, func(a, b models.StarredSnippet) int {
+		return cmp.Or(cmp.Compare(b.Stars, a.Stars), b.ID-a.ID)
+	})
+
+	return most[:min(len(most), limit)], nil
+}
@@ -0,0 +1,88 @@
+package mocks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UserModel is an in-memory models.UserModelInterface.
+type UserModel struct {
+	mu     sync.Mutex
+	nextID int
+	users  map[string]*models.User // by email
+}
+
+var _ models.UserModelInterface = (*UserModel)(nil)
+
+func NewUserModel() *UserModel {
+	return &UserModel{nextID: 1, users: map[string]*models.User{}}
+}
+
+func (m *UserModel) Insert(_ context.Context, name, email, password string) error {
+	// the lowest cost keeps tests fast, the postgres model uses 12.
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[email]; ok {
+		return models.ErrDuplicateEmail
+	}
+
+	m.users[email] = &models.User{
+		ID:             m.nextID,
+		Name:           name,
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Created:        time.Now().UTC(),
+	}
+	m.nextID++
+
+	return nil
+}
+
+func (m *UserModel) Authenticate(_ context.Context, email, password string) (int, error) {
+	m.mu.Lock()
+	user, ok := m.users[email]
+	m.mu.Unlock()
+
+	if !ok || bcrypt.CompareHashAndPassword(user.HashedPassword, []byte(password)) != nil {
+		return 0, models.ErrInvalidCredentials
+	}
+
+	return user.ID, nil
+}
+
+func (m *UserModel) Exists(_ context.Context, id int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if user.ID == id {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// name() returns a user's name, for the stores that join it in.
+func (m *UserModel) name(id int) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if user.ID == id {
+			return user.Name
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,77 @@
+package mocks
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+// ViewModel is an in-memory models.ViewModelInterface. The totals go onto the
+// snippets in snippets, like the postgres model puts them on the snippets
+// table.
+type ViewModel struct {
+	mu        sync.Mutex
+	snippets  *SnippetModel
+	daily     map[models.ViewKey]int64 // Referrer is always ""
+	referrers map[models.ViewKey]int64 // Day is always zero
+}
+
+var _ models.ViewModelInterface = (*ViewModel)(nil)
+
+func NewViewModel(snippets *SnippetModel) *ViewModel {
+	return &ViewModel{
+		snippets:  snippets,
+		daily:     map[models.ViewKey]int64{},
+		referrers: map[models.ViewKey]int64{},
+	}
+}
+
+func (m *ViewModel) RecordBatch(_ context.Context, counts map[models.ViewKey]int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, n := range counts {
+		// views of deleted snippets are dropped.
+		if !m.snippets.addViews(key.SnippetID, n) {
+			continue
+		}
+
+		m.daily[models.ViewKey{SnippetID: key.SnippetID, Day: key.Day}] += n
+		if key.Referrer != "" {
+			m.referrers[models.ViewKey{SnippetID: key.SnippetID, Referrer: key.Referrer}] += n
+		}
+	}
+
+	return nil
+}
+
+func (m *ViewModel) Stats(_ context.Context, snippetID int, days int) (*models.SnippetStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := &models.SnippetStats{}
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -days)
+
+	for key, n := range m.daily {
+		if key.SnippetID == snippetID && key.Day.After(since) {
+			stats.Daily = append(stats.Daily, models.DailyViews{Day: key.Day, Views: n})
+		}
+	}
+	slices.SortFunc(stats.Daily, func(a, b models.DailyViews) int { return a.Day.Compare(b.Day) })
+
+	for key, n := range m.referrers {
+		if key.SnippetID == snippetID {
+			stats.TopReferrers = append(stats.TopReferrers, models.ReferrerViews{Referrer: key.Referrer, Views: n})
+		}
+	}
+	slices.SortFunc(stats.TopReferrers, func(a, b models.ReferrerViews) int {
+		return cmp.Or(cmp.Compare(b.Views, a.Views), cmp.Compare(a.Referrer, b.Referrer))
+	})
+	stats.TopReferrers = stats.TopReferrers[:min(len(stats.TopReferrers), 10)]
+
+	return stats, nil
+}
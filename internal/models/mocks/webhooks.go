@@ -0,0 +1,128 @@
+package mocks
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+// WebhookModel is an in-memory models.WebhookModelInterface.
+type WebhookModel struct {
+	mu         sync.Mutex
+	nextID     int
+	webhooks   map[int]*models.Webhook
+	deliveries []models.WebhookDelivery // oldest first
+	deliveryID int                      // the last delivery's id
+}
+
+var _ models.WebhookModelInterface = (*WebhookModel)(nil)
+
+func NewWebhookModel() *WebhookModel {
+	return &WebhookModel{nextID: 1, webhooks: map[int]*models.Webhook{}}
+}
+
+func (m *WebhookModel) Insert(_ context.Context, userID int, url, secret string, events []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhook := &models.Webhook{
+		ID:      m.nextID,
+		UserID:  userID,
+		URL:     url,
+		Secret:  secret,
+		Events:  slices.Clone(events),
+		Created: time.Now().UTC(),
+	}
+	m.nextID++
+	m.webhooks[webhook.ID] = webhook
+
+	return webhook.ID, nil
+}
+
+func (m *WebhookModel) Get(_ context.Context, id int) (*models.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhook, ok := m.webhooks[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+
+	w := *webhook
+	return &w, nil
+}
+
+// Delete removes a webhook along with its delivery log.
+func (m *WebhookModel) Delete(_ context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[id]; !ok {
+		return models.ErrNoRecord
+	}
+
+	delete(m.webhooks, id)
+	m.deliveries = slices.DeleteFunc(m.deliveries, func(d models.WebhookDelivery) bool { return d.WebhookID == id })
+
+	return nil
+}
+
+// ForUser returns a user's webhooks, newest first.
+func (m *WebhookModel) ForUser(_ context.Context, userID int) ([]models.Webhook, error) {
+	return m.filter(func(w *models.Webhook) bool { return w.UserID == userID }), nil
+}
+
+func (m *WebhookModel) Subscribed(_ context.Context, userID int, event string) ([]models.Webhook, error) {
+	return m.filter(func(w *models.Webhook) bool { return w.UserID == userID && slices.Contains(w.Events, event) }), nil
+}
+
+// filter() returns the webhooks keep is true for, newest first.
+func (m *WebhookModel) filter(keep func(w *models.Webhook) bool) []models.Webhook {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhooks := []models.Webhook{}
+	for _, webhook := range m.webhooks {
+		if keep(webhook) {
+			webhooks = append(webhooks, *webhook)
+		}
+	}
+
+	slices.SortFunc(webhooks, func(a, b models.Webhook) int { return b.ID - a.ID })
+	return webhooks
+}
+
+// LogDelivery drops deliveries for deleted webhooks, like the postgres model.
+func (m *WebhookModel) LogDelivery(_ context.Context, d *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[d.WebhookID]; !ok {
+		return nil
+	}
+
+	delivery := *d
+	m.deliveryID++
+	delivery.ID = m.deliveryID
+	delivery.Created = time.Now().UTC()
+	m.deliveries = append(m.deliveries, delivery)
+
+	return nil
+}
+
+func (m *WebhookModel) Deliveries(_ context.Context, webhookID int, limit int) ([]models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deliveries := []models.WebhookDelivery{}
+	for i := len(m.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if m.deliveries[i].WebhookID == webhookID {
+			deliveries = append(deliveries, m.deliveries[i])
+		}
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,78 @@
+package models_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/corbinlazarone/snippetbox/internal/migrations"
+	"github.com/corbinlazarone/snippetbox/internal/models"
+	"github.com/corbinlazarone/snippetbox/internal/models/modeltest"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// TestModels runs the model suite against the postgres database in
+// TEST_DATABASE_URL, and is skipped when that isn't set.
+//
+// NOTE: every table in the database is emptied before each test, so point it
+// at a database that only exists for the tests.
+func TestModels(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL isn't set")
+	}
+
+	ctx := context.Background()
+
+	db, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	migrator, err := migrations.New(stdlib.OpenDBFromPool(db), migrations.Postgres, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var tables []string
+	rows, err := db.Query(ctx, `SELECT quote_ident(tablename) FROM pg_tables
+		WHERE schemaname = current_schema() AND tablename <> 'schema_migrations';`)
+	if err == nil {
+		for rows.Next() {
+			var table string
+			rows.Scan(&table)
+			tables = append(tables, table)
+		}
+		err = rows.Err()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modeltest.Run(t, func(t *testing.T) modeltest.Models {
+		_, err := db.Exec(ctx, `TRUNCATE `+strings.Join(tables, ", ")+` RESTART IDENTITY CASCADE;`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return modeltest.Models{
+			Snippets: &models.SnippetModel{DB: db},
+			Users:    &models.UserModel{DB: db},
+			Views:    &models.ViewModel{DB: db},
+			Stars:    &models.StarModel{DB: db},
+			Comments: &models.CommentModel{DB: db},
+			Webhooks: &models.WebhookModel{DB: db},
+
+			Notifications: &models.NotificationModel{DB: db},
+		}
+	})
+}
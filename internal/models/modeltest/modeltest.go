@@ -0,0 +1,733 @@
+// Package modeltest is a test suite for the model stores. Every backend runs
+// the same tests against a real database, so a query that only works on one
+// of them fails here rather than in production.
+//
+// The postgres models run it in internal/models and the SQLite ones in
+// internal/models/sqlite, see Run().
+package modeltest
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+// Models is one backend's set of stores, all on the same database.
+type Models struct {
+	Snippets models.SnippetModelInterface
+	Users    models.UserModelInterface
+	Views    models.ViewModelInterface
+	Stars    models.StarModelInterface
+	Comments models.CommentModelInterface
+	Webhooks models.WebhookModelInterface
+
+	Notifications models.NotificationModelInterface
+}
+
+// tests are run in order, each against a new, empty database.
+var tests = []struct {
+	name string
+	run  func(t *testing.T, m Models)
+}{
+	{"snippets/insert and get", testSnippetInsertGet},
+	{"snippets/update and revisions", testSnippetUpdate},
+	{"snippets/delete", testSnippetDelete},
+	{"snippets/expiry", testSnippetExpiry},
+	{"snippets/list", testSnippetList},
+	{"users", testUsers},
+	{"views", testViews},
+	{"views/deleted snippet", testViewsDeletedSnippet},
+	{"stars", testStars},
+	{"comments", testComments},
+	{"webhooks", testWebhooks},
+	{"notifications", testNotifications},
+	{"timeouts", testTimeouts},
+}
+
+// Run runs the suite. open is called at the start of every test and must
+// return the stores for an empty database with the schema migrated.
+func Run(t *testing.T, open func(t *testing.T) Models) {
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, open(t))
+		})
+	}
+}
+
+var ctx = context.Background()
+
+// newUser() adds a user and returns their id.
+func newUser(t *testing.T, m Models, name string) int {
+	t.Helper()
+
+	email := name + "@example.com"
+	if err := m.Users.Insert(ctx, name, email, "pa55word123"); err != nil {
+		t.Fatalf("inserting user %s: %v", name, err)
+	}
+
+	id, err := m.Users.Authenticate(ctx, email, "pa55word123")
+	if err != nil {
+		t.Fatalf("authenticating user %s: %v", name, err)
+	}
+
+	return id
+}
+
+// newSnippet() adds a snippet that expires in a week and returns its id.
+func newSnippet(t *testing.T, m Models, userID int, title string) int {
+	t.Helper()
+
+	id, err := m.Snippets.Insert(ctx, userID, title, "some content", models.ContentTypeText, 7)
+	if err != nil {
+		t.Fatalf("inserting snippet %q: %v", title, err)
+	}
+
+	return id
+}
+
+func getSnippet(t *testing.T, m Models, id int) *models.Snippet {
+	t.Helper()
+
+	snippet, err := m.Snippets.Get(ctx, id)
+	if err != nil {
+		t.Fatalf("getting snippet %d: %v", id, err)
+	}
+
+	return snippet
+}
+
+func wantErr(t *testing.T, what string, err, want error) {
+	t.Helper()
+
+	if !errors.Is(err, want) {
+		t.Fatalf("%s: got error %v, want %v", what, err, want)
+	}
+}
+
+// near() reports whether two times are within a second, which allows for the
+// precision the databases store times with.
+func near(a, b time.Time) bool {
+	return a.Sub(b).Abs() < time.Second
+}
+
+func testSnippetInsertGet(t *testing.T, m Models) {
+	userID := newUser(t, m, "alice")
+
+	before := time.Now().UTC()
+	id, err := m.Snippets.Insert(ctx, userID, "An old silent pond", "line one\nline two", models.ContentTypeMarkdown, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snippet := getSnippet(t, m, id)
+
+	if snippet.ID != id || snippet.Title != "An old silent pond" || snippet.Content != "line one\nline two" ||
+		snippet.ContentType != models.ContentTypeMarkdown || snippet.UserID != userID {
+		t.Errorf("got %+v", snippet)
+	}
+	if snippet.Revision != 1 || snippet.Views != 0 {
+		t.Errorf("got revision %d and %d views, want 1 and 0", snippet.Revision, snippet.Views)
+	}
+	if !near(snippet.Created, before) || !snippet.Updated.Equal(snippet.Created) {
+		t.Errorf("got created %v and updated %v, want both around %v", snippet.Created, snippet.Updated, before)
+	}
+	if !near(snippet.Expires, snippet.Created.AddDate(0, 0, 7)) {
+		t.Errorf("got expires %v, want a week after %v", snippet.Expires, snippet.Created)
+	}
+
+	_, err = m.Snippets.Get(ctx, id+1)
+	wantErr(t, "getting a missing snippet", err, models.ErrNoRecord)
+}
+
+func testSnippetUpdate(t *testing.T, m Models) {
+	userID := newUser(t, m, "alice")
+	id := newSnippet(t, m, userID, "first")
+	created := getSnippet(t, m, id).Created
+
+	revision, err := m.Snippets.Update(ctx, id, "second", "new content", models.ContentTypeText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision != 2 {
+		t.Fatalf("got revision %d, want 2", revision)
+	}
+
+	snippet := getSnippet(t, m, id)
+	if snippet.Title != "second" || snippet.Content != "new content" || snippet.Revision != 2 {
+		t.Errorf("got %+v", snippet)
+	}
+	if !snippet.Created.Equal(created) || snippet.Updated.Before(created) {
+		t.Errorf("got created %v and updated %v, want created unchanged at %v", snippet.Created, snippet.Updated, created)
+	}
+
+	old, err := m.Snippets.GetRevision(ctx, id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Title != "first" || old.Content != "some content" || old.Revision != 1 || !old.Updated.Equal(created) {
+		t.Errorf("got revision 1 as %+v", old)
+	}
+
+	_, err = m.Snippets.GetRevision(ctx, id, 3)
+	wantErr(t, "getting a missing revision", err, models.ErrNoRecord)
+
+	_, err = m.Snippets.Update(ctx, id+1, "title", "content", models.ContentTypeText)
+	wantErr(t, "updating a missing snippet", err, models.ErrNoRecord)
+}
+
+func testSnippetDelete(t *testing.T, m Models) {
+	userID := newUser(t, m, "alice")
+	id := newSnippet(t, m, userID, "doomed")
+
+	deleted, err := m.Snippets.Delete(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted.ID != id || deleted.Title != "doomed" {
+		t.Errorf("got %+v", deleted)
+	}
+
+	_, err = m.Snippets.Get(ctx, id)
+	wantErr(t, "getting a deleted snippet", err, models.ErrNoRecord)
+
+	_, err = m.Snippets.Delete(ctx, id)
+	wantErr(t, "deleting a snippet twice", err, models.ErrNoRecord)
+}
+
+func testSnippetExpiry(t *testing.T, m Models) {
+	userID := newUser(t, m, "alice")
+	live := newSnippet(t, m, userID, "live")
+
+	// no days left, so it has expired as soon as it is written.
+	expired, err := m.Snippets.Insert(ctx, userID, "expired", "content", models.ContentTypeText, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Snippets.Get(ctx, expired)
+	wantErr(t, "getting an expired snippet", err, models.ErrNoRecord)
+
+	snippets, err := m.Snippets.GetMany(ctx, []int{expired, live, live + 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snippets) != 1 || snippets[0].ID != live {
+		t.Errorf("GetMany() got %v, want only snippet %d", ids(snippets), live)
+	}
+
+	marked, err := m.Snippets.MarkExpired(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(marked) != 1 || marked[0].ID != expired {
+		t.Errorf("MarkExpired() got %v, want only snippet %d", ids(marked), expired)
+	}
+
+	marked, err = m.Snippets.MarkExpired(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(marked) != 0 {
+		t.Errorf("MarkExpired() again got %v, want nothing", ids(marked))
+	}
+}
+
+func testSnippetList(t *testing.T, m Models) {
+	userID := newUser(t, m, "alice")
+
+	var all []int
+	for _, title := range []string{"one", "two", "three"} {
+		all = append(all, newSnippet(t, m, userID, title))
+	}
+
+	page, err := m.Snippets.List(ctx, models.SortNewest, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(page.Snippets); !slices.Equal(got, []int{all[2], all[1]}) || page.NextCursor == "" || page.PrevCursor != "" {
+		t.Fatalf("first page got %v (next %q, prev %q)", got, page.NextCursor, page.PrevCursor)
+	}
+
+	page, err = m.Snippets.List(ctx, models.SortNewest, 2, page.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(page.Snippets); !slices.Equal(got, []int{all[0]}) || page.NextCursor != "" || page.PrevCursor == "" {
+		t.Fatalf("second page got %v (next %q, prev %q)", got, page.NextCursor, page.PrevCursor)
+	}
+
+	page, err = m.Snippets.List(ctx, models.SortNewest, 2, page.PrevCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(page.Snippets); !slices.Equal(got, []int{all[2], all[1]}) {
+		t.Fatalf("back to the first page got %v", got)
+	}
+
+	// the most viewed listing sorts on the totals RecordBatch() keeps.
+	err = m.Views.RecordBatch(ctx, map[models.ViewKey]int64{
+		{SnippetID: all[0], Day: today()}: 5,
+		{SnippetID: all[1], Day: today()}: 9,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err = m.Snippets.List(ctx, models.SortMostViewed, 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(page.Snippets); !slices.Equal(got, []int{all[1], all[0], all[2]}) {
+		t.Errorf("most viewed got %v", got)
+	}
+
+	_, err = m.Snippets.List(ctx, "sideways", 10, "")
+	wantErr(t, "listing with an unknown sort", err, models.ErrInvalidSort)
+
+	_, err = m.Snippets.List(ctx, models.SortNewest, 10, "not-a-cursor")
+	wantErr(t, "listing with a bad cursor", err, models.ErrInvalidCursor)
+}
+
+func testUsers(t *testing.T, m Models) {
+	id := newUser(t, m, "alice")
+
+	err := m.Users.Insert(ctx, "Alice Again", "alice@example.com", "another password")
+	wantErr(t, "inserting a duplicate email", err, models.ErrDuplicateEmail)
+
+	_, err = m.Users.Authenticate(ctx, "alice@example.com", "wrong password")
+	wantErr(t, "authenticating with the wrong password", err, models.ErrInvalidCredentials)
+
+	_, err = m.Users.Authenticate(ctx, "nobody@example.com", "pa55word123")
+	wantErr(t, "authenticating an unknown email", err, models.ErrInvalidCredentials)
+
+	for _, tt := range []struct {
+		id   int
+		want bool
+	}{
+		{id, true},
+		{id + 1, false},
+	} {
+		exists, err := m.Users.Exists(ctx, tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != tt.want {
+			t.Errorf("Exists(%d) got %t, want %t", tt.id, exists, tt.want)
+		}
+	}
+}
+
+func testViews(t *testing.T, m Models) {
+	userID := newUser(t, m, "alice")
+	id := newSnippet(t, m, userID, "popular")
+
+	day := today()
+	err := m.Views.RecordBatch(ctx, map[models.ViewKey]int64{
+		{SnippetID: id, Day: day.AddDate(0, 0, -1)}:                        2,
+		{SnippetID: id, Day: day}:                                          3,
+		{SnippetID: id, Day: day, Referrer: "news.ycombinator.com"}:        4,
+		{SnippetID: id, Day: day.AddDate(0, 0, -1), Referrer: "lobste.rs"}: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a second batch adds to the first.
+	err = m.Views.RecordBatch(ctx, map[models.ViewKey]int64{
+		{SnippetID: id, Day: day, Referrer: "lobste.rs"}: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if views := getSnippet(t, m, id).Views; views != 15 {
+		t.Errorf("got %d views, want 15", views)
+	}
+
+	stats, err := m.Views.Stats(ctx, id, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []models.DailyViews{{Day: day.AddDate(0, 0, -1), Views: 3}, {Day: day, Views: 12}}
+	if !slices.EqualFunc(stats.Daily, want, func(a, b models.DailyViews) bool { return a.Day.Equal(b.Day) && a.Views == b.Views }) {
+		t.Errorf("got daily views %v, want %v", stats.Daily, want)
+	}
+
+	wantReferrers := []models.ReferrerViews{{Referrer: "lobste.rs", Views: 6}, {Referrer: "news.ycombinator.com", Views: 4}}
+	if !slices.Equal(stats.TopReferrers, wantReferrers) {
+		t.Errorf("got referrers %v, want %v", stats.TopReferrers, wantReferrers)
+	}
+}
+
+// a snippet can be deleted while its views are still buffered, the batch
+// must still save the views of every other snippet.
+func testViewsDeletedSnippet(t *testing.T, m Models) {
+	userID := newUser(t, m, "alice")
+	kept := newSnippet(t, m, userID, "kept")
+	deleted := newSnippet(t, m, userID, "deleted")
+
+	if _, err := m.Snippets.Delete(ctx, deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	day := today()
+	err := m.Views.RecordBatch(ctx, map[models.ViewKey]int64{
+		{SnippetID: kept, Day: day}:                       2,
+		{SnippetID: deleted, Day: day}:                    3,
+		{SnippetID: deleted, Day: day, Referrer: "a.com"}: 1,
+	})
+	if err != nil {
+		t.Fatalf("RecordBatch() with a deleted snippet: %v", err)
+	}
+
+	if views := getSnippet(t, m, kept).Views; views != 2 {
+		t.Errorf("got %d views, want 2", views)
+	}
+
+	stats, err := m.Views.Stats(ctx, deleted, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Daily) != 0 || len(stats.TopReferrers) != 0 {
+		t.Errorf("got stats %+v for a deleted snippet, want none", stats)
+	}
+}
+
+func testStars(t *testing.T, m Models) {
+	alice := newUser(t, m, "alice")
+	bob := newUser(t, m, "bob")
+	first := newSnippet(t, m, alice, "first")
+	second := newSnippet(t, m, alice, "second")
+
+	for _, tt := range []struct {
+		userID, snippetID int
+		want              bool
+	}{
+		{bob, first, true},
+		{bob, first, false}, // already starred
+		{alice, first, true},
+		{bob, second, true},
+		{bob, second + 100, false}, // no such snippet
+	} {
+		added, err := m.Stars.Star(ctx, tt.userID, tt.snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != tt.want {
+			t.Errorf("Star(%d, %d) got %t, want %t", tt.userID, tt.snippetID, added, tt.want)
+		}
+	}
+
+	if count, err := m.Stars.Count(ctx, first); err != nil || count != 2 {
+		t.Errorf("Count() got %d, %v, want 2", count, err)
+	}
+
+	if starred, err := m.Stars.IsStarred(ctx, alice, second); err != nil || starred {
+		t.Errorf("IsStarred() got %t, %v, want false", starred, err)
+	}
+
+	starred, err := m.Stars.Starred(ctx, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(starred); len(got) != 2 || !slices.Contains(got, first) || !slices.Contains(got, second) {
+		t.Errorf("Starred() got %v, want %d and %d", got, first, second)
+	}
+
+	most, err := m.Stars.MostStarredThisWeek(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(most) != 2 || most[0].ID != first || most[0].Stars != 2 || most[1].ID != second || most[1].Stars != 1 {
+		t.Errorf("MostStarredThisWeek() got %+v", most)
+	}
+
+	for _, want := range []bool{true, false} {
+		removed, err := m.Stars.Unstar(ctx, bob, first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if removed != want {
+			t.Errorf("Unstar() got %t, want %t", removed, want)
+		}
+	}
+}
+
+func testComments(t *testing.T, m Models) {
+	userID := newUser(t, m, "alice")
+	id := newSnippet(t, m, userID, "commented")
+	other := newSnippet(t, m, userID, "other")
+
+	top, err := m.Comments.Insert(ctx, id, userID, 0, 0, 0, "first!")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lineComment, err := m.Comments.Insert(ctx, id, userID, 0, 1, 1, "about line one")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := m.Comments.Insert(ctx, id, userID, top, 0, 0, "a reply")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a reply to a reply joins the thread it is in.
+	nested, err := m.Comments.Insert(ctx, id, userID, reply, 0, 0, "a reply to the reply")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// replies sit on the line their thread is on.
+	lineReply, err := m.Comments.Insert(ctx, id, userID, lineComment, 0, 0, "about the comment about line one")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Comments.Insert(ctx, other, userID, top, 0, 0, "wrong snippet")
+	wantErr(t, "replying to a comment on another snippet", err, models.ErrNoRecord)
+
+	threads, err := m.Comments.ForSnippet(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(threads) != 2 || threads[0].ID != top || threads[1].ID != lineComment {
+		t.Fatalf("got threads %+v", threads)
+	}
+	if got := commentIDs(threads[0].Replies); !slices.Equal(got, []int{reply, nested}) {
+		t.Errorf("got replies %v, want %v", got, []int{reply, nested})
+	}
+	if replies := threads[1].Replies; len(replies) != 1 || replies[0].ID != lineReply || replies[0].Line != 1 || replies[0].Revision != 1 {
+		t.Errorf("got line replies %+v", replies)
+	}
+	if threads[0].UserName != "alice" || threads[0].Edited {
+		t.Errorf("got %+v", threads[0])
+	}
+
+	if err := m.Comments.Update(ctx, top, "edited"); err != nil {
+		t.Fatal(err)
+	}
+
+	comment, err := m.Comments.Get(ctx, top)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comment.Body != "edited" || !comment.Edited {
+		t.Errorf("got %+v after editing", comment)
+	}
+
+	// deleting a top level comment takes its replies with it.
+	if err := m.Comments.Delete(ctx, top); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Comments.Get(ctx, nested)
+	wantErr(t, "getting a reply to a deleted comment", err, models.ErrNoRecord)
+
+	wantErr(t, "updating a missing comment", m.Comments.Update(ctx, top, "body"), models.ErrNoRecord)
+	wantErr(t, "deleting a missing comment", m.Comments.Delete(ctx, top), models.ErrNoRecord)
+}
+
+func testWebhooks(t *testing.T, m Models) {
+	userID := newUser(t, m, "alice")
+
+	id, err := m.Webhooks.Insert(ctx, userID, "https://example.com/hook", "s3cret", []string{models.EventSnippetCreated, models.EventSnippetDeleted})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webhook, err := m.Webhooks.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if webhook.UserID != userID || webhook.URL != "https://example.com/hook" || webhook.Secret != "s3cret" ||
+		!slices.Equal(webhook.Events, []string{models.EventSnippetCreated, models.EventSnippetDeleted}) {
+		t.Errorf("got %+v", webhook)
+	}
+
+	// a user only hears about their own snippets.
+	otherID := newUser(t, m, "bob")
+
+	for _, tt := range []struct {
+		userID int
+		event  string
+		want   int
+	}{
+		{userID, models.EventSnippetCreated, 1},
+		{userID, models.EventSnippetExpired, 0},
+		{otherID, models.EventSnippetCreated, 0},
+		{0, models.EventSnippetCreated, 0},
+	} {
+		subscribed, err := m.Webhooks.Subscribed(ctx, tt.userID, tt.event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(subscribed) != tt.want {
+			t.Errorf("Subscribed(%d, %s) got %d webhooks, want %d", tt.userID, tt.event, len(subscribed), tt.want)
+		}
+	}
+
+	err = m.Webhooks.LogDelivery(ctx, &models.WebhookDelivery{
+		WebhookID: id, Event: models.EventSnippetCreated, Payload: "{}", Attempt: 1, StatusCode: 204, DurationMS: 12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := m.Webhooks.Deliveries(ctx, id, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].StatusCode != 204 || deliveries[0].Attempt != 1 {
+		t.Errorf("got deliveries %+v", deliveries)
+	}
+
+	if err := m.Webhooks.Delete(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Webhooks.Get(ctx, id)
+	wantErr(t, "getting a deleted webhook", err, models.ErrNoRecord)
+
+	// a delivery that finishes after its webhook was deleted isn't an error.
+	err = m.Webhooks.LogDelivery(ctx, &models.WebhookDelivery{WebhookID: id, Event: models.EventSnippetCreated, Payload: "{}", Attempt: 1})
+	if err != nil {
+		t.Errorf("logging a delivery for a deleted webhook: %v", err)
+	}
+}
+
+func testNotifications(t *testing.T, m Models) {
+	alice := newUser(t, m, "alice")
+	bob := newUser(t, m, "bob")
+	id := newSnippet(t, m, alice, "noticed")
+
+	commentID, err := m.Comments.Insert(ctx, id, bob, 0, 0, 0, "nice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Notifications.SetPreferences(ctx, alice, []string{models.NotifyStar, models.NotifyComment}); err != nil {
+		t.Fatal(err)
+	}
+
+	prefs, err := m.Notifications.Preferences(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{models.NotifyStar: true, models.NotifyComment: true, models.NotifyReply: false}
+	if !maps.Equal(prefs, want) {
+		t.Errorf("Preferences() got %v, want %v", prefs, want)
+	}
+
+	for _, tt := range []struct {
+		name            string
+		userID, actorID int
+		kind            string
+		commentID       int
+		want            bool
+	}{
+		{"star", alice, bob, models.NotifyStar, 0, true},
+		{"comment", alice, bob, models.NotifyComment, commentID, true},
+		{"own snippet", alice, alice, models.NotifyStar, 0, false},
+		{"switched off", alice, bob, models.NotifyReply, commentID, false},
+	} {
+		added, err := m.Notifications.Insert(ctx, tt.userID, tt.actorID, tt.kind, id, tt.commentID)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if added != tt.want {
+			t.Errorf("%s: Insert() got %t, want %t", tt.name, added, tt.want)
+		}
+	}
+
+	notifications, err := m.Notifications.ForUser(ctx, alice, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 2 {
+		t.Fatalf("ForUser() got %d notifications, want 2", len(notifications))
+	}
+
+	// newest first.
+	got := notifications[0]
+	if got.Kind != models.NotifyComment || got.ActorID != bob || got.ActorName != "bob" ||
+		got.SnippetID != id || got.SnippetTitle != "noticed" || got.CommentID != commentID || got.Read {
+		t.Errorf("got %+v", got)
+	}
+	if notifications[1].Kind != models.NotifyStar || notifications[1].CommentID != 0 {
+		t.Errorf("got %+v", notifications[1])
+	}
+
+	if count, err := m.Notifications.UnreadCount(ctx, alice); err != nil || count != 2 {
+		t.Errorf("UnreadCount() got %d, %v, want 2", count, err)
+	}
+
+	err = m.Notifications.MarkRead(ctx, got.ID, bob)
+	wantErr(t, "marking someone else's notification read", err, models.ErrNoRecord)
+
+	if err := m.Notifications.MarkRead(ctx, got.ID, alice); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := m.Notifications.UnreadCount(ctx, alice); err != nil || count != 1 {
+		t.Errorf("UnreadCount() after MarkRead() got %d, %v, want 1", count, err)
+	}
+
+	if err := m.Notifications.MarkAllRead(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := m.Notifications.UnreadCount(ctx, alice); err != nil || count != 0 {
+		t.Errorf("UnreadCount() after MarkAllRead() got %d, %v, want 0", count, err)
+	}
+}
+
+// today() is midnight UTC, the day views are counted against.
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+func ids(snippets []models.Snippet) []int {
+	var ids []int
+	for _, snippet := range snippets {
+		ids = append(ids, snippet.ID)
+	}
+	return ids
+}
+
+func commentIDs(comments []models.Comment) []int {
+	var ids []int
+	for _, comment := range comments {
+		ids = append(ids, comment.ID)
+	}
+	return ids
+}
+
+// every store runs its queries with the caller's context, and a query that runs
+// out of time comes back as ErrTimeout.
+func testTimeouts(t *testing.T, m Models) {
+	userID := newUser(t, m, "alice")
+	snippetID := newSnippet(t, m, userID, "An old silent pond")
+
+	expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	defer cancel()
+
+	for _, tt := range []struct {
+		name string
+		call func() error
+	}{
+		{"snippets", func() error { _, err := m.Snippets.Get(expired, snippetID); return err }},
+		{"views", func() error { _, err := m.Views.Stats(expired, snippetID, 7); return err }},
+		{"stars", func() error { _, err := m.Stars.Count(expired, snippetID); return err }},
+		{"comments", func() error { _, err := m.Comments.ForSnippet(expired, snippetID); return err }},
+		{"webhooks", func() error { _, err := m.Webhooks.ForUser(expired, userID); return err }},
+		{"notifications", func() error { _, err := m.Notifications.UnreadCount(expired, userID); return err }},
+	} {
+		wantErr(t, tt.name, tt.call(), models.ErrTimeout)
+	}
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// kinds of notification a user can get.
+const (
+	NotifyStar    = "star"    // someone starred one of your snippets
+	NotifyComment = "comment" // someone commented on one of your snippets
+	NotifyReply   = "reply"   // someone replied to one of your comments
+)
+
+// NotificationKinds lists every kind of notification, in the order they are
+// shown on the preferences form.
+var NotificationKinds = []string{NotifyStar, NotifyComment, NotifyReply}
+
+// notification struct to represent something that happened that a user should
+// know about
+type Notification struct {
+	ID           int
+	UserID       int
+	ActorID      int
+	ActorName    string
+	Kind         string
+	SnippetID    int
+	SnippetTitle string
+	CommentID    int // 0 for notifications that aren't about a comment
+	Read         bool
+	Created      time.Time
+}
+
+// NotificationModelInterface is what the web app needs from a notification
+// store.
+type NotificationModelInterface interface {
+	Insert(ctx context.Context, userID, actorID int, kind string, snippetID, commentID int) (bool, error)
+	ForUser(ctx context.Context, userID, limit int) ([]Notification, error)
+	UnreadCount(ctx context.Context, userID int) (int, error)
+	MarkRead(ctx context.Context, id, userID int) error
+	MarkAllRead(ctx context.Context, userID int) error
+	Preferences(ctx context.Context, userID int) (map[string]bool, error)
+	SetPreferences(ctx context.Context, userID int, enabled []string) error
+}
+
+// notification model that wraps a postgres db connection
+type NotificationModel struct {
+	DB      *pgxpool.Pool
+	Timeout time.Duration // how long a single query may run, 0 for no limit
+}
+
+// Insert adds a notification for userID, unless they have switched that kind of
+// notification off or they are the actor themselves (nobody needs to be told
+// they starred their own snippet). It returns true if a notification was added.
+//
+// NOTE: the parameters are cast because postgres can't tell their types from a
+// SELECT, $1 <> $2 would compare them as text.
+func (n *NotificationModel) Insert(ctx context.Context, userID, actorID int, kind string, snippetID, commentID int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	statement := `INSERT INTO notifications (user_id, actor_id, kind, snippet_id, comment_id, created)
+								SELECT $1::integer, $2::integer, $3::text, $4::integer, NULLIF($5::integer, 0), NOW() AT TIME ZONE 'UTC'
+								WHERE $1::integer <> $2::integer AND NOT EXISTS (
+									SELECT true FROM notification_preferences
+									WHERE user_id = $1 AND kind = $3 AND NOT enabled
+								);`
+
+	tag, err := n.DB.Exec(ctx, statement, userID, actorID, kind, snippetID, commentID)
+	if err != nil {
+		return false, classify(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// ForUser returns a user's most recent notifications, newest first.
+func (n *NotificationModel) ForUser(ctx context.Context, userID, limit int) ([]Notification, error) {
+	ctx, cancel := withTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	statement := `SELECT notifications.id, notifications.user_id, notifications.actor_id,
+									users.name AS actor_name, notifications.kind, notifications.snippet_id,
+									snippets.title AS snippet_title, COALESCE(notifications.comment_id, 0) AS comment_id,
+									notifications.read, notifications.created
+								FROM notifications
+								JOIN users ON users.id = notifications.actor_id
+								JOIN snippets ON snippets.id = notifications.snippet_id
+								WHERE notifications.user_id = $1
+								ORDER BY notifications.id DESC LIMIT $2;`
+
+	rows, err := n.DB.Query(ctx, statement, userID, limit)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	notifications, err := pgx.CollectRows(rows, pgx.RowToStructByName[Notification])
+	return notifications, classify(err)
+}
+
+// UnreadCount returns how many unread notifications a user has.
+func (n *NotificationModel) UnreadCount(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := withTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	var count int
+	statement := `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND NOT read;`
+
+	err := n.DB.QueryRow(ctx, statement, userID).Scan(&count)
+	if err != nil {
+		return 0, classify(err)
+	}
+
+	return count, nil
+}
+
+// MarkRead marks one of a user's notifications as read. It returns ErrNoRecord
+// if the notification doesn't exist or belongs to someone else.
+func (n *NotificationModel) MarkRead(ctx context.Context, id, userID int) error {
+	ctx, cancel := withTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	statement := `UPDATE notifications SET read = true WHERE id = $1 AND user_id = $2;`
+
+	tag, err := n.DB.Exec(ctx, statement, id, userID)
+	if err != nil {
+		return classify(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// MarkAllRead marks all of a user's notifications as read.
+func (n *NotificationModel) MarkAllRead(ctx context.Context, userID int) error {
+	ctx, cancel := withTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	statement := `UPDATE notifications SET read = true WHERE user_id = $1 AND NOT read;`
+
+	_, err := n.DB.Exec(ctx, statement, userID)
+	return classify(err)
+}
+
+// Preferences returns which kinds of notification a user wants, keyed by kind.
+// Every kind in NotificationKinds is present in the map.
+func (n *NotificationModel) Preferences(ctx context.Context, userID int) (map[string]bool, error) {
+	ctx, cancel := withTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	prefs := make(map[string]bool, len(NotificationKinds))
+	for _, kind := range NotificationKinds {
+		prefs[kind] = true
+	}
+
+	statement := `SELECT kind, enabled FROM notification_preferences WHERE user_id = $1;`
+
+	rows, err := n.DB.Query(ctx, statement, userID)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	var kind string
+	var enabled bool
+	_, err = pgx.ForEachRow(rows, []any{&kind, &enabled}, func() error {
+		prefs[kind] = enabled
+		return nil
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	return prefs, nil
+}
+
+// SetPreferences saves which kinds of notification a user wants. Kinds missing
+// from enabled are switched off.
+func (n *NotificationModel) SetPreferences(ctx context.Context, userID int, enabled []string) error {
+	ctx, cancel := withTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	statement := `INSERT INTO notification_preferences (user_id, kind, enabled)
+								SELECT $1::integer, kind, COALESCE(kind = ANY($3::TEXT[]), false) FROM unnest($2::TEXT[]) AS kind
+								ON CONFLICT (user_id, kind) DO UPDATE SET enabled = EXCLUDED.enabled;`
+
+	_, err := n.DB.Exec(ctx, statement, userID, NotificationKinds, enabled)
+	return classify(err)
+}
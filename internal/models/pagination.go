@@ -0,0 +1,184 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// sort orders accepted by SnippetModel.List().
+const (
+	SortNewest     = "newest"
+	SortOldest     = "oldest"
+	SortExpiring   = "expiring"
+	SortMostViewed = "views"
+)
+
+// SnippetPage is a single page of a snippet listing along with the cursors
+// needed to fetch the pages either side of it. A cursor is empty when there is
+// no page in that direction.
+type SnippetPage struct {
+	Snippets   []Snippet
+	NextCursor string
+	PrevCursor string
+}
+
+// snippetSortOrder describes how a sort order maps onto the snippets table. Rows
+// are always ordered by the sort column and then by id, so the order is total
+// and a (key, id) pair identifies an exact position in the listing.
+type snippetSortOrder struct {
+	column     string
+	descending bool
+	key        func(s *Snippet) string       // the sort key of a row, as stored in a cursor
+	parseKey   func(key string) (any, error) // turns a cursor key back into a query arg
+}
+
+var snippetSortOrders = map[string]snippetSortOrder{
+	SortNewest:     {"created", true, createdKey, parseTimeKey},
+	SortOldest:     {"created", false, createdKey, parseTimeKey},
+	SortExpiring:   {"expires", false, expiresKey, parseTimeKey},
+	SortMostViewed: {"views", true, viewsKey, parseIntKey},
+}
+
+func createdKey(s *Snippet) string { return s.Created.Format(time.RFC3339Nano) }
+func expiresKey(s *Snippet) string { return s.Expires.Format(time.RFC3339Nano) }
+func viewsKey(s *Snippet) string   { return strconv.FormatInt(s.Views, 10) }
+
+func parseTimeKey(key string) (any, error) { return time.Parse(time.RFC3339Nano, key) }
+func parseIntKey(key string) (any, error)  { return strconv.ParseInt(key, 10, 64) }
+
+// IsValidSort() reports whether sort is one of the sort orders List() accepts.
+func IsValidSort(sort string) bool {
+	_, ok := snippetSortOrders[sort]
+	return ok
+}
+
+// pageCursor is the position a page starts from. It is handed to clients as
+// opaque base64, so the fields are free to change as long as old cursors are
+// rejected rather than misread.
+type pageCursor struct {
+	Sort     string `json:"s"`
+	Key      string `json:"k"`
+	ID       int    `json:"i"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+func encodeCursor(sort, key string, id int, backward bool) string {
+	// marshalling a struct of strings, ints and bools can't fail.
+	js, _ := json.Marshal(pageCursor{Sort: sort, Key: key, ID: id, Backward: backward})
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// decodeCursor() parses a cursor, returning ErrInvalidCursor if it is malformed
+// or was created for a different sort order.
+func decodeCursor(cursor, sort string) (*pageCursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c pageCursor
+	if err := json.Unmarshal(js, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if c.Sort != sort || c.ID < 1 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// SnippetListQuery is a request for one page of a snippet listing, worked out
+// into the parts a store needs to build its query. Every store pages the same
+// way through it, only the SQL around it differs.
+type SnippetListQuery struct {
+	Column     string // the sort column, rows are ordered by it and then by id
+	Direction  string // ASC or DESC, for both Column and id
+	Comparison string // > or <, rows come after the cursor when (Column, id) Comparison (Key, ID)
+	After      bool   // false on the first page, when there is no cursor to start after
+	Key        any    // the cursor's sort key, as a query arg
+	ID         int    // the cursor's id
+	Limit      int    // how many rows to fetch, one more than the page size
+
+	sort     string
+	order    snippetSortOrder
+	backward bool
+}
+
+// NewSnippetListQuery() checks the sort and cursor of a listing request. An
+// empty cursor starts from the first page, otherwise cursor must be one of the
+// NextCursor or PrevCursor values from a previous page with the same sort.
+func NewSnippetListQuery(sort string, limit int, cursor string) (*SnippetListQuery, error) {
+	order, ok := snippetSortOrders[sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	q := &SnippetListQuery{Column: order.column, sort: sort, order: order}
+
+	var c *pageCursor
+	if cursor != "" {
+		var err error
+		c, err = decodeCursor(cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+
+		q.Key, err = order.parseKey(c.Key)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+
+		q.After, q.ID, q.backward = true, c.ID, c.Backward
+	}
+
+	// walking backwards is the same query with the comparison and ordering
+	// flipped, Page() then reverses the rows so the page still reads top to
+	// bottom.
+	q.Direction, q.Comparison = "ASC", ">"
+	if order.descending != q.backward {
+		q.Direction, q.Comparison = "DESC", "<"
+	}
+
+	// fetch one extra row so we know whether there is another page after this one.
+	q.Limit = limit + 1
+
+	return q, nil
+}
+
+// Page() turns the rows the query returned into the page, with the cursors
+// for the pages either side of it.
+func (q *SnippetListQuery) Page(snippets []Snippet) *SnippetPage {
+	limit := q.Limit - 1
+
+	hasMore := len(snippets) > limit
+	if hasMore {
+		snippets = snippets[:limit]
+	}
+
+	if q.backward {
+		slices.Reverse(snippets)
+	}
+
+	page := &SnippetPage{Snippets: snippets}
+	if len(snippets) == 0 {
+		return page
+	}
+
+	first, last := &snippets[0], &snippets[len(snippets)-1]
+
+	// going forwards there is a next page if we got the extra row, and a
+	// previous page if we started from a cursor. Going backwards it's the
+	// other way around.
+	if (!q.backward && hasMore) || q.backward {
+		page.NextCursor = encodeCursor(q.sort, q.order.key(last), last.ID, false)
+	}
+	if (q.backward && hasMore) || (!q.backward && q.After) {
+		page.PrevCursor = encodeCursor(q.sort, q.order.key(first), first.ID, true)
+	}
+
+	return page
+}
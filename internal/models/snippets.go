@@ -2,64 +2,265 @@ package models
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// content types a snippet can be stored as. Text snippets are shown as-is in a
+// code block, markdown snippets are rendered into HTML on the view page.
+const (
+	ContentTypeText     = "text"
+	ContentTypeMarkdown = "markdown"
+)
+
 // snippet struct to represent a individual snippet type
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	Content     string    `json:"content"`
+	ContentType string    `json:"content_type"`
+	UserID      int       `json:"user_id"` // 0 when the snippet has no owner
+	Views       int64     `json:"views"`
+	Revision    int       `json:"revision"` // bumped every time the snippet is edited
+	Created     time.Time `json:"created"`
+	Updated     time.Time `json:"updated"` // when the content last changed, the same as Created until it is edited
+	Expires     time.Time `json:"expires"`
+}
+
+// snippetColumns lists the columns selected for a Snippet. They are qualified
+// with the table name so the same list works in queries that join snippets
+// with other tables.
+const snippetColumns = `snippets.id, snippets.title, snippets.content, snippets.content_type,
+	COALESCE(snippets.user_id, 0) AS user_id, snippets.views, snippets.revision, snippets.created, snippets.updated, snippets.expires`
+
+// SnippetModelInterface is what the web app needs from a snippet store. It is
+// satisfied by *SnippetModel, and by the in-memory store in the mocks package
+// so handlers can be tested without a database.
+//
+// Methods that look up a single snippet return ErrNoRecord when it doesn't
+// exist or has expired. Database failures are wrapped in ErrConstraint,
+// ErrUnavailable or ErrTimeout where they are one of those, check for them
+// with errors.Is().
+type SnippetModelInterface interface {
+	Insert(ctx context.Context, userID int, title string, content string, contentType string, expires int) (int, error)
+	Get(ctx context.Context, id int) (*Snippet, error)
+	Update(ctx context.Context, id int, title, content, contentType string) (int, error)
+	Delete(ctx context.Context, id int) (*Snippet, error)
+	MarkExpired(ctx context.Context) ([]Snippet, error)
+	GetRevision(ctx context.Context, id, revision int) (*Snippet, error)
+	GetMany(ctx context.Context, ids []int) ([]Snippet, error)
+	List(ctx context.Context, sort string, limit int, cursor string) (*SnippetPage, error)
 }
 
 // snippet model that wraps a postgres db connection
 type SnippetModel struct {
-	DB *pgxpool.Pool
+	DB      *pgxpool.Pool
+	Timeout time.Duration // how long a single query may run, 0 for no limit
 }
 
-// insert a new snippet into the db, and returns the created snippet id
-func (s *SnippetModel) Insert(Title string, Content string, Expiers int) (int, error) {
-	statement := `INSERT INTO snippets (title, content, created, expires)
-								VALUES ($1, $2, NOW() AT TIME ZONE 'UTC', (NOW() AT TIME ZONE 'UTC') + $3 * INTERVAL '1 day') RETURNING id;`
+// insert a new snippet owned by userID into the db, and returns the created snippet id.
+// The content is also saved as the snippet's first revision.
+func (s *SnippetModel) Insert(ctx context.Context, UserID int, Title string, Content string, ContentType string, Expiers int) (int, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `WITH inserted AS (
+									INSERT INTO snippets (user_id, title, content, content_type, created, updated, expires)
+									VALUES ($1, $2, $3, $4, $5, $5, $6)
+									RETURNING id, revision, title, content, content_type, created
+								)
+								INSERT INTO snippet_revisions (snippet_id, revision, title, content, content_type, created)
+								SELECT id, revision, title, content, content_type, created FROM inserted RETURNING snippet_id;`
+	now := utcNow()
 	var id int64
-	err := s.DB.QueryRow(context.Background(), statement, Title, Content, Expiers).Scan(&id)
+	err := s.DB.QueryRow(ctx, statement, UserID, Title, Content, ContentType, now, now.AddDate(0, 0, Expiers)).Scan(&id)
 	if err != nil {
-		return 0, nil
+		return 0, classify(err)
 	}
 
 	return int(id), nil
 }
 
 // Get snippet by ID
-func (s *SnippetModel) Get(id int) (*Snippet, error) {
-	statement := `SELECT id, title, content, created, expires FROM snippets
-								WHERE expires > NOW() AT TIME ZONE 'UTC' AND id = $1;`
+func (s *SnippetModel) Get(ctx context.Context, id int) (*Snippet, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `SELECT ` + snippetColumns + ` FROM snippets
+								WHERE expires > $2 AND id = $1;`
 	newSnip := &Snippet{}
-	err := s.DB.QueryRow(context.Background(), statement, id).Scan(
-		&newSnip.ID, &newSnip.Title, &newSnip.Content, &newSnip.Created, &newSnip.Expires,
+	err := s.DB.QueryRow(ctx, statement, id, utcNow()).Scan(
+		&newSnip.ID, &newSnip.Title, &newSnip.Content, &newSnip.ContentType, &newSnip.UserID, &newSnip.Views, &newSnip.Revision, &newSnip.Created, &newSnip.Updated, &newSnip.Expires,
 	)
 	if err != nil {
-		return nil, ErrNoRecord
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, classify(err)
 	}
 	return newSnip, nil
 }
 
-// get the 10 latest snippets created
-func (s *SnippetModel) Latest() ([]Snippet, error) {
-	statement := `SELECT id, title, content, created, expires FROM snippets
-								WHERE expires > NOW() at TIME zone 'UTC' order by id desc limit 10;`
+// Update replaces the title, content and content type of an unexpired snippet.
+// Every edit bumps the snippet's revision and keeps a copy of the new content
+// in snippet_revisions, so things that refer to an older revision (like line
+// comments) still have the content they were written against. It returns the
+// new revision number.
+func (s *SnippetModel) Update(ctx context.Context, id int, title, content, contentType string) (int, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `WITH updated AS (
+									UPDATE snippets SET title = $2, content = $3, content_type = $4, revision = revision + 1, updated = $5
+									WHERE id = $1 AND expires > $5
+									RETURNING id, revision, title, content, content_type
+								)
+								INSERT INTO snippet_revisions (snippet_id, revision, title, content, content_type, created)
+								SELECT id, revision, title, content, content_type, $5 FROM updated
+								RETURNING revision;`
+
+	var revision int
+	err := s.DB.QueryRow(ctx, statement, id, title, content, contentType, utcNow()).Scan(&revision)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, classify(err)
+	}
+
+	return revision, nil
+}
+
+// Delete removes a snippet, along with everything that hangs off it (revisions,
+// comments, stars and view counts), and returns what was deleted.
+func (s *SnippetModel) Delete(ctx context.Context, id int) (*Snippet, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `DELETE FROM snippets WHERE id = $1 RETURNING ` + snippetColumns + `;`
+
+	rows, err := s.DB.Query(ctx, statement, id)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	snippet, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[Snippet])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, classify(err)
+	}
+
+	return snippet, nil
+}
+
+// MarkExpired finds the snippets that have expired since the last call, flags
+// them so they aren't returned again, and returns them.
+func (s *SnippetModel) MarkExpired(ctx context.Context) ([]Snippet, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `UPDATE snippets SET expiry_notified = true
+								WHERE expires <= $1 AND NOT expiry_notified
+								RETURNING ` + snippetColumns + `;`
+
+	rows, err := s.DB.Query(ctx, statement, utcNow())
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	snippets, err := pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+	return snippets, classify(err)
+}
+
+// GetRevision returns an unexpired snippet as it was at the given revision. Only
+// the title, content and content type come from the revision, everything else
+// is the snippet's current state.
+func (s *SnippetModel) GetRevision(ctx context.Context, id, revision int) (*Snippet, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `SELECT snippets.id, r.title, r.content, r.content_type, COALESCE(snippets.user_id, 0) AS user_id,
+									snippets.views, r.revision, snippets.created, r.created AS updated, snippets.expires
+								FROM snippets JOIN snippet_revisions r ON r.snippet_id = snippets.id
+								WHERE snippets.id = $1 AND r.revision = $2 AND snippets.expires > $3;`
+
+	rows, err := s.DB.Query(ctx, statement, id, revision, utcNow())
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	snippet, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[Snippet])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, classify(err)
+	}
+
+	return snippet, nil
+}
+
+// Get every unexpired snippet whose id is in ids, ordered by id. Ids that don't
+// exist or have expired are skipped rather than treated as an error.
+func (s *SnippetModel) GetMany(ctx context.Context, ids []int) ([]Snippet, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `SELECT ` + snippetColumns + ` FROM snippets
+								WHERE expires > $2 AND id = ANY($1) ORDER BY id;`
 
-	rows, _ := s.DB.Query(context.Background(), statement)
-	res, err := pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+	rows, err := s.DB.Query(ctx, statement, ids, utcNow())
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	snippets, err := pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+	return snippets, classify(err)
+}
 
+// List returns one page of unexpired snippets in the given sort order. An empty
+// cursor starts from the first page, otherwise cursor must be one of the
+// NextCursor or PrevCursor values from a previous page with the same sort.
+//
+// NOTE: this uses keyset pagination rather than OFFSET, the cursor remembers the
+// sort key and id of the last row we showed and the next query starts right
+// after it. That keeps every page an index range scan no matter how deep in
+// the listing we are.
+func (s *SnippetModel) List(ctx context.Context, sort string, limit int, cursor string) (*SnippetPage, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	q, err := NewSnippetListQuery(sort, limit, cursor)
 	if err != nil {
 		return nil, err
 	}
 
-	return res, nil
+	args := []any{utcNow()}
+	where := "expires > $1"
+	if q.After {
+		args = append(args, q.Key, q.ID)
+		where += fmt.Sprintf(" AND (%s, id) %s ($2, $3)", q.Column, q.Comparison)
+	}
+
+	args = append(args, q.Limit)
+	statement := fmt.Sprintf(`SELECT %s FROM snippets WHERE %s ORDER BY %s %s, id %s LIMIT $%d;`,
+		snippetColumns, where, q.Column, q.Direction, q.Direction, len(args))
+
+	rows, err := s.DB.Query(ctx, statement, args...)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	snippets, err := pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	return q.Page(snippets), nil
 }
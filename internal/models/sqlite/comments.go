@@ -0,0 +1,170 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+// commentColumns lists the columns selected for a Comment, in the order
+// scanComment() reads them.
+const commentColumns = `comments.id, comments.snippet_id, comments.user_id, users.name AS user_name,
+	COALESCE(comments.parent_id, 0) AS parent_id, COALESCE(comments.line, 0) AS line,
+	COALESCE(comments.revision, 0) AS revision, comments.body, comments.created,
+	comments.updated IS NOT NULL AS edited`
+
+func scanComment(row scanner, c *models.Comment) error {
+	return row.Scan(&c.ID, &c.SnippetID, &c.UserID, &c.UserName, &c.ParentID, &c.Line, &c.Revision,
+		&c.Body, timestamp{&c.Created}, &c.Edited)
+}
+
+// comment model that wraps a sqlite db
+type CommentModel struct {
+	DB      *sql.DB
+	Timeout time.Duration // how long a single query may run, 0 for no limit
+}
+
+var _ models.CommentModelInterface = (*CommentModel)(nil)
+
+// Insert adds a comment to a snippet and returns its id, see
+// models.CommentModel.Insert() for how replies and line comments are stored.
+func (c *CommentModel) Insert(ctx context.Context, snippetID, userID, parentID, line, revision int, body string) (int, error) {
+	ctx, cancel := withTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	// these stay NULL unless they are set below.
+	var parent, lineArg, revisionArg any
+	if line != 0 {
+		lineArg, revisionArg = line, revision
+	}
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, classify(err)
+	}
+	defer tx.Rollback()
+
+	if parentID != 0 {
+		var grandparentID, parentLine, parentRevision sql.NullInt64
+		statement := `SELECT parent_id, line, revision FROM comments WHERE id = $1 AND snippet_id = $2;`
+
+		err := tx.QueryRowContext(ctx, statement, parentID, snippetID).Scan(&grandparentID, &parentLine, &parentRevision)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, models.ErrNoRecord
+			}
+			return 0, classify(err)
+		}
+
+		parent = parentID
+		if grandparentID.Valid {
+			parent = grandparentID.Int64
+		}
+
+		lineArg, revisionArg = nullable(parentLine), nullable(parentRevision)
+	}
+
+	var id int
+	statement := `INSERT INTO comments (snippet_id, user_id, parent_id, line, revision, body, created)
+								VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id;`
+
+	err = tx.QueryRowContext(ctx, statement, snippetID, userID, parent, lineArg, revisionArg, body, utcNow()).Scan(&id)
+	if err != nil {
+		return 0, classify(err)
+	}
+
+	return id, classify(tx.Commit())
+}
+
+// nullable() turns a NULL back into a nil query arg.
+func nullable(n sql.NullInt64) any {
+	if !n.Valid {
+		return nil
+	}
+	return n.Int64
+}
+
+// Get returns a comment.
+func (c *CommentModel) Get(ctx context.Context, id int) (*models.Comment, error) {
+	ctx, cancel := withTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	statement := `SELECT ` + commentColumns + ` FROM comments
+								JOIN users ON users.id = comments.user_id
+								WHERE comments.id = $1;`
+
+	comment := &models.Comment{}
+	err := scanComment(c.DB.QueryRowContext(ctx, statement, id), comment)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, classify(err)
+	}
+
+	return comment, nil
+}
+
+// Update replaces the body of a comment and marks it as edited.
+func (c *CommentModel) Update(ctx context.Context, id int, body string) error {
+	ctx, cancel := withTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	statement := `UPDATE comments SET body = $2, updated = $3 WHERE id = $1;`
+
+	result, err := c.DB.ExecContext(ctx, statement, id, body, utcNow())
+	return errIfNoRows(result, err)
+}
+
+// Delete removes a comment, along with its replies.
+func (c *CommentModel) Delete(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	statement := `DELETE FROM comments WHERE id = $1;`
+
+	result, err := c.DB.ExecContext(ctx, statement, id)
+	return errIfNoRows(result, err)
+}
+
+// ForSnippet returns the comments on a snippet as threads: the top level
+// comments oldest first, each with its replies (also oldest first).
+func (c *CommentModel) ForSnippet(ctx context.Context, snippetID int) ([]models.Comment, error) {
+	ctx, cancel := withTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	statement := `SELECT ` + commentColumns + ` FROM comments
+								JOIN users ON users.id = comments.user_id
+								WHERE comments.snippet_id = $1
+								ORDER BY comments.created, comments.id;`
+
+	rows, err := c.DB.QueryContext(ctx, statement, snippetID)
+	comments, err := collect(rows, err, scanComment)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	return models.ThreadComments(comments), nil
+}
+
+// errIfNoRows() returns models.ErrNoRecord if a statement didn't change any rows,
+// and classifies the error if it failed.
+func errIfNoRows(result sql.Result, err error) error {
+	if err != nil {
+		return classify(err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return classify(err)
+	}
+
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
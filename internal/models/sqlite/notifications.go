@@ -0,0 +1,154 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+// notification model that wraps a sqlite db
+type NotificationModel struct {
+	DB      *sql.DB
+	Timeout time.Duration // how long a single query may run, 0 for no limit
+}
+
+var _ models.NotificationModelInterface = (*NotificationModel)(nil)
+
+// Insert adds a notification for userID, unless they have switched that kind of
+// notification off or they are the actor themselves. It returns true if a
+// notification was added.
+func (n *NotificationModel) Insert(ctx context.Context, userID, actorID int, kind string, snippetID, commentID int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	statement := `INSERT INTO notifications (user_id, actor_id, kind, snippet_id, comment_id, created)
+								SELECT $1, $2, $3, $4, NULLIF($5, 0), $6
+								WHERE $1 <> $2 AND NOT EXISTS (
+									SELECT true FROM notification_preferences
+									WHERE user_id = $1 AND kind = $3 AND NOT enabled
+								);`
+
+	result, err := n.DB.ExecContext(ctx, statement, userID, actorID, kind, snippetID, commentID, utcNow())
+	return rowsAffected(result, err)
+}
+
+// ForUser returns a user's most recent notifications, newest first.
+func (n *NotificationModel) ForUser(ctx context.Context, userID, limit int) ([]models.Notification, error) {
+	ctx, cancel := withTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	statement := `SELECT notifications.id, notifications.user_id, notifications.actor_id,
+									users.name AS actor_name, notifications.kind, notifications.snippet_id,
+									snippets.title AS snippet_title, COALESCE(notifications.comment_id, 0) AS comment_id,
+									notifications.read, notifications.created
+								FROM notifications
+								JOIN users ON users.id = notifications.actor_id
+								JOIN snippets ON snippets.id = notifications.snippet_id
+								WHERE notifications.user_id = $1
+								ORDER BY notifications.id DESC LIMIT $2;`
+
+	rows, err := n.DB.QueryContext(ctx, statement, userID, limit)
+	notifications, err := collect(rows, err, func(row scanner, n *models.Notification) error {
+		return row.Scan(&n.ID, &n.UserID, &n.ActorID, &n.ActorName, &n.Kind, &n.SnippetID,
+			&n.SnippetTitle, &n.CommentID, &n.Read, timestamp{&n.Created})
+	})
+	return notifications, classify(err)
+}
+
+// UnreadCount returns how many unread notifications a user has.
+func (n *NotificationModel) UnreadCount(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := withTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	var count int
+	statement := `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND NOT read;`
+
+	err := n.DB.QueryRowContext(ctx, statement, userID).Scan(&count)
+	return count, classify(err)
+}
+
+// MarkRead marks one of a user's notifications as read. It returns
+// models.ErrNoRecord if the notification doesn't exist or belongs to someone
+// else.
+func (n *NotificationModel) MarkRead(ctx context.Context, id, userID int) error {
+	ctx, cancel := withTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	statement := `UPDATE notifications SET read = true WHERE id = $1 AND user_id = $2;`
+
+	result, err := n.DB.ExecContext(ctx, statement, id, userID)
+	return errIfNoRows(result, err)
+}
+
+// MarkAllRead marks all of a user's notifications as read.
+func (n *NotificationModel) MarkAllRead(ctx context.Context, userID int) error {
+	ctx, cancel := withTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	statement := `UPDATE notifications SET read = true WHERE user_id = $1 AND NOT read;`
+
+	_, err := n.DB.ExecContext(ctx, statement, userID)
+	return classify(err)
+}
+
+// Preferences returns which kinds of notification a user wants, keyed by kind.
+// Every kind in models.NotificationKinds is present in the map.
+func (n *NotificationModel) Preferences(ctx context.Context, userID int) (map[string]bool, error) {
+	ctx, cancel := withTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	prefs := make(map[string]bool, len(models.NotificationKinds))
+	for _, kind := range models.NotificationKinds {
+		prefs[kind] = true
+	}
+
+	statement := `SELECT kind, enabled FROM notification_preferences WHERE user_id = $1;`
+
+	rows, err := n.DB.QueryContext(ctx, statement, userID)
+	if err != nil {
+		return nil, classify(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind string
+		var enabled bool
+		if err := rows.Scan(&kind, &enabled); err != nil {
+			return nil, classify(err)
+		}
+		prefs[kind] = enabled
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, classify(err)
+	}
+
+	return prefs, nil
+}
+
+// SetPreferences saves which kinds of notification a user wants. Kinds missing
+// from enabled are switched off.
+func (n *NotificationModel) SetPreferences(ctx context.Context, userID int, enabled []string) error {
+	ctx, cancel := withTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	tx, err := n.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return classify(err)
+	}
+	defer tx.Rollback()
+
+	statement := `INSERT INTO notification_preferences (user_id, kind, enabled) VALUES ($1, $2, $3)
+								ON CONFLICT (user_id, kind) DO UPDATE SET enabled = excluded.enabled;`
+
+	for _, kind := range models.NotificationKinds {
+		if _, err := tx.ExecContext(ctx, statement, userID, kind, slices.Contains(enabled, kind)); err != nil {
+			return classify(err)
+		}
+	}
+
+	return classify(tx.Commit())
+}
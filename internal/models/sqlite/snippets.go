@@ -0,0 +1,213 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+// snippet model that wraps a sqlite db
+type SnippetModel struct {
+	DB      *sql.DB
+	Timeout time.Duration // how long a single query may run, 0 for no limit
+}
+
+var _ models.SnippetModelInterface = (*SnippetModel)(nil)
+
+// Insert adds a snippet and saves its content as the first revision.
+func (s *SnippetModel) Insert(ctx context.Context, userID int, title string, content string, contentType string, expires int) (int, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	now := utcNow()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, classify(err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	statement := `INSERT INTO snippets (user_id, title, content, content_type, created, updated, expires)
+								VALUES (NULLIF($1, 0), $2, $3, $4, $5, $5, $6) RETURNING id;`
+
+	err = tx.QueryRowContext(ctx, statement, userID, title, content, contentType, now, now.AddDate(0, 0, expires)).Scan(&id)
+	if err != nil {
+		return 0, classify(err)
+	}
+
+	statement = `INSERT INTO snippet_revisions (snippet_id, revision, title, content, content_type, created)
+								VALUES ($1, 1, $2, $3, $4, $5);`
+
+	if _, err := tx.ExecContext(ctx, statement, id, title, content, contentType, now); err != nil {
+		return 0, classify(err)
+	}
+
+	return id, classify(tx.Commit())
+}
+
+// Get returns an unexpired snippet.
+func (s *SnippetModel) Get(ctx context.Context, id int) (*models.Snippet, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `SELECT ` + snippetColumns + ` FROM snippets WHERE expires > $2 AND id = $1;`
+
+	snippet := &models.Snippet{}
+	err := scanSnippet(s.DB.QueryRowContext(ctx, statement, id, utcNow()), snippet)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, classify(err)
+	}
+
+	return snippet, nil
+}
+
+// Update replaces the content of an unexpired snippet, bumping its revision and
+// saving the new content as that revision. It returns the new revision number.
+func (s *SnippetModel) Update(ctx context.Context, id int, title, content, contentType string) (int, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	now := utcNow()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, classify(err)
+	}
+	defer tx.Rollback()
+
+	var revision int
+	statement := `UPDATE snippets SET title = $2, content = $3, content_type = $4, revision = revision + 1, updated = $5
+								WHERE id = $1 AND expires > $5 RETURNING revision;`
+
+	err = tx.QueryRowContext(ctx, statement, id, title, content, contentType, now).Scan(&revision)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrNoRecord
+		}
+		return 0, classify(err)
+	}
+
+	statement = `INSERT INTO snippet_revisions (snippet_id, revision, title, content, content_type, created)
+								VALUES ($1, $2, $3, $4, $5, $6);`
+
+	if _, err := tx.ExecContext(ctx, statement, id, revision, title, content, contentType, now); err != nil {
+		return 0, classify(err)
+	}
+
+	return revision, classify(tx.Commit())
+}
+
+// Delete removes a snippet and everything that hangs off it, and returns what
+// was deleted.
+func (s *SnippetModel) Delete(ctx context.Context, id int) (*models.Snippet, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `DELETE FROM snippets WHERE id = $1 RETURNING ` + snippetColumns + `;`
+
+	snippet := &models.Snippet{}
+	err := scanSnippet(s.DB.QueryRowContext(ctx, statement, id), snippet)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, classify(err)
+	}
+
+	return snippet, nil
+}
+
+// MarkExpired finds the snippets that have expired since the last call, flags
+// them so they aren't returned again, and returns them.
+func (s *SnippetModel) MarkExpired(ctx context.Context) ([]models.Snippet, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `UPDATE snippets SET expiry_notified = true
+								WHERE expires <= $1 AND NOT expiry_notified
+								RETURNING ` + snippetColumns + `;`
+
+	rows, err := s.DB.QueryContext(ctx, statement, utcNow())
+	snippets, err := collect(rows, err, scanSnippet)
+	return snippets, classify(err)
+}
+
+// GetRevision returns an unexpired snippet as it was at the given revision.
+func (s *SnippetModel) GetRevision(ctx context.Context, id, revision int) (*models.Snippet, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `SELECT snippets.id, r.title, r.content, r.content_type, COALESCE(snippets.user_id, 0) AS user_id,
+									snippets.views, r.revision, snippets.created, r.created AS updated, snippets.expires
+								FROM snippets JOIN snippet_revisions r ON r.snippet_id = snippets.id
+								WHERE snippets.id = $1 AND r.revision = $2 AND snippets.expires > $3;`
+
+	snippet := &models.Snippet{}
+	err := scanSnippet(s.DB.QueryRowContext(ctx, statement, id, revision, utcNow()), snippet)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, classify(err)
+	}
+
+	return snippet, nil
+}
+
+// GetMany returns every unexpired snippet whose id is in ids, ordered by id.
+func (s *SnippetModel) GetMany(ctx context.Context, ids []int) ([]models.Snippet, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	// SQLite has no arrays, so the ids go in as a JSON array.
+	js, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := `SELECT ` + snippetColumns + ` FROM snippets
+								WHERE expires > $2 AND id IN (SELECT value FROM json_each($1)) ORDER BY id;`
+
+	rows, err := s.DB.QueryContext(ctx, statement, string(js), utcNow())
+	snippets, err := collect(rows, err, scanSnippet)
+	return snippets, classify(err)
+}
+
+// List returns one page of unexpired snippets, see models.SnippetModel.List().
+func (s *SnippetModel) List(ctx context.Context, sort string, limit int, cursor string) (*models.SnippetPage, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	q, err := models.NewSnippetListQuery(sort, limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []any{utcNow()}
+	where := "expires > $1"
+	if q.After {
+		args = append(args, q.Key, q.ID)
+		where += fmt.Sprintf(" AND (%s, id) %s ($2, $3)", q.Column, q.Comparison)
+	}
+
+	args = append(args, q.Limit)
+	statement := fmt.Sprintf(`SELECT %s FROM snippets WHERE %s ORDER BY %s %s, id %s LIMIT $%d;`,
+		snippetColumns, where, q.Column, q.Direction, q.Direction, len(args))
+
+	rows, err := s.DB.QueryContext(ctx, statement, args...)
+	snippets, err := collect(rows, err, scanSnippet)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	return q.Page(snippets), nil
+}
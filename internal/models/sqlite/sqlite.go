@@ -0,0 +1,181 @@
+// Package sqlite has SQLite versions of the model stores, for running the app
+// from a single file without a Postgres server. It uses a pure Go driver, so
+// no cgo is needed.
+//
+// The stores behave like the postgres ones in the models package, including
+// their errors, and implement the same interfaces. The schema is in
+// internal/migrations/sqlite.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+	sqlite3 "modernc.org/sqlite"
+	sqlite3lib "modernc.org/sqlite/lib"
+)
+
+// timeLayout is how the driver writes times with _time_format=sqlite. Times
+// are always stored in UTC, so comparing them as text orders them correctly.
+const timeLayout = "2006-01-02 15:04:05.999999999-07:00"
+
+// Open opens the database file at path, creating it if it doesn't exist.
+func Open(path string) (*sql.DB, error) {
+	if path == "" {
+		return nil, errors.New("sqlite: a database file is required, e.g. sqlite:snippetbox.db")
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	// WAL lets readers carry on while something is being written.
+	params.Add("_pragma", "journal_mode(WAL)")
+	// wait for the write lock rather than failing straight away.
+	params.Add("_pragma", "busy_timeout(5000)")
+	// take the write lock when a transaction starts, otherwise two transactions
+	// that read and then write can deadlock, and one of them fails without
+	// waiting out the busy timeout.
+	params.Set("_txlock", "immediate")
+	params.Set("_time_format", "sqlite")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// timestamp scans a time column. The driver parses columns declared as a
+// TIMESTAMP, but SQLite doesn't know the type of an expression or of a
+// RETURNING column, in which case we get the stored text.
+type timestamp struct {
+	t *time.Time
+}
+
+func (ts timestamp) Scan(value any) error {
+	switch v := value.(type) {
+	case time.Time:
+		*ts.t = v.UTC()
+	case string:
+		return ts.parse(v)
+	case []byte:
+		return ts.parse(string(v))
+	case nil:
+		*ts.t = time.Time{}
+	default:
+		return fmt.Errorf("sqlite: can't scan %T into a time", value)
+	}
+
+	return nil
+}
+
+func (ts timestamp) parse(s string) error {
+	t, err := time.Parse(timeLayout, s)
+	if err != nil {
+		return err
+	}
+
+	*ts.t = t.UTC()
+	return nil
+}
+
+// utcNow() is the current time in UTC, see models.utcNow().
+func utcNow() time.Time {
+	return time.Now().UTC()
+}
+
+// withTimeout() bounds a single query, see models.withTimeout().
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// isConstraintError() reports whether err is SQLite refusing a write because
+// of a constraint, code is one of the SQLITE_CONSTRAINT_* codes. If what isn't
+// empty the message must mention it too, e.g. "users.email".
+func isConstraintError(err error, code int, what string) bool {
+	var sqliteError *sqlite3.Error
+	if !errors.As(err, &sqliteError) || sqliteError.Code() != code {
+		return false
+	}
+
+	return what == "" || strings.Contains(sqliteError.Error(), what)
+}
+
+// classify() wraps a database error in models.ErrConstraint,
+// models.ErrUnavailable or models.ErrTimeout, see models.classify().
+func classify(err error) error {
+	var sqliteError *sqlite3.Error
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", models.ErrTimeout, err)
+	case errors.As(err, &sqliteError):
+		// the low byte of an extended result code is its primary code.
+		switch sqliteError.Code() & 0xff {
+		case sqlite3lib.SQLITE_CONSTRAINT:
+			return fmt.Errorf("%w: %w", models.ErrConstraint, err)
+		case sqlite3lib.SQLITE_BUSY, sqlite3lib.SQLITE_LOCKED, sqlite3lib.SQLITE_CANTOPEN,
+			sqlite3lib.SQLITE_IOERR, sqlite3lib.SQLITE_FULL:
+			return fmt.Errorf("%w: %w", models.ErrUnavailable, err)
+		}
+	}
+
+	return err
+}
+
+// snippetColumns lists the columns selected for a Snippet, in the order
+// scanSnippet() reads them.
+const snippetColumns = `snippets.id, snippets.title, snippets.content, snippets.content_type,
+	COALESCE(snippets.user_id, 0) AS user_id, snippets.views, snippets.revision, snippets.created, snippets.updated, snippets.expires`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSnippet(row scanner, snippet *models.Snippet) error {
+	return row.Scan(&snippet.ID, &snippet.Title, &snippet.Content, &snippet.ContentType, &snippet.UserID,
+		&snippet.Views, &snippet.Revision, timestamp{&snippet.Created}, timestamp{&snippet.Updated}, timestamp{&snippet.Expires})
+}
+
+// collect() scans every row with scan, and closes rows.
+func collect[T any](rows *sql.Rows, err error, scan func(scanner, *T) error) ([]T, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []T{}
+	for rows.Next() {
+		var item T
+		if err := scan(rows, &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// these are the constraint codes we check for, named so callers don't need to
+// import the driver's lib package.
+const (
+	constraintUnique     = sqlite3lib.SQLITE_CONSTRAINT_UNIQUE
+	constraintForeignKey = sqlite3lib.SQLITE_CONSTRAINT_FOREIGNKEY
+)
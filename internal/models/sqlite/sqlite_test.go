@@ -0,0 +1,43 @@
+package sqlite_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/corbinlazarone/snippetbox/internal/migrations"
+	"github.com/corbinlazarone/snippetbox/internal/models/modeltest"
+	"github.com/corbinlazarone/snippetbox/internal/models/sqlite"
+)
+
+func TestModels(t *testing.T) {
+	modeltest.Run(t, func(t *testing.T) modeltest.Models {
+		db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		migrator, err := migrations.New(db, migrations.SQLite, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := migrator.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		return modeltest.Models{
+			Snippets: &sqlite.SnippetModel{DB: db},
+			Users:    &sqlite.UserModel{DB: db},
+			Views:    &sqlite.ViewModel{DB: db},
+			Stars:    &sqlite.StarModel{DB: db},
+			Comments: &sqlite.CommentModel{DB: db},
+			Webhooks: &sqlite.WebhookModel{DB: db},
+
+			Notifications: &sqlite.NotificationModel{DB: db},
+		}
+	})
+}
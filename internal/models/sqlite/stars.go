@@ -0,0 +1,116 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+// star model that wraps a sqlite db
+type StarModel struct {
+	DB      *sql.DB
+	Timeout time.Duration // how long a single query may run, 0 for no limit
+}
+
+var _ models.StarModelInterface = (*StarModel)(nil)
+
+// Star records that a user has starred an unexpired snippet, starring it twice
+// is not an error. It returns true if a new star was added.
+func (s *StarModel) Star(ctx context.Context, userID, snippetID int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `INSERT INTO stars (user_id, snippet_id, created)
+								SELECT $1, id, $3 FROM snippets WHERE id = $2 AND expires > $3
+								ON CONFLICT (user_id, snippet_id) DO NOTHING;`
+
+	result, err := s.DB.ExecContext(ctx, statement, userID, snippetID, utcNow())
+	return rowsAffected(result, err)
+}
+
+// Unstar removes a user's star from a snippet. It returns true if a star was
+// removed.
+func (s *StarModel) Unstar(ctx context.Context, userID, snippetID int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `DELETE FROM stars WHERE user_id = $1 AND snippet_id = $2;`
+
+	result, err := s.DB.ExecContext(ctx, statement, userID, snippetID)
+	return rowsAffected(result, err)
+}
+
+// Count returns how many users have starred a snippet.
+func (s *StarModel) Count(ctx context.Context, snippetID int) (int64, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	var count int64
+	statement := `SELECT COUNT(*) FROM stars WHERE snippet_id = $1;`
+
+	err := s.DB.QueryRowContext(ctx, statement, snippetID).Scan(&count)
+	return count, classify(err)
+}
+
+// IsStarred reports whether a user has starred a snippet.
+func (s *StarModel) IsStarred(ctx context.Context, userID, snippetID int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	var starred bool
+	statement := `SELECT EXISTS(SELECT true FROM stars WHERE user_id = $1 AND snippet_id = $2);`
+
+	err := s.DB.QueryRowContext(ctx, statement, userID, snippetID).Scan(&starred)
+	return starred, classify(err)
+}
+
+// Starred returns the unexpired snippets a user has starred, most recently
+// starred first.
+func (s *StarModel) Starred(ctx context.Context, userID int) ([]models.Snippet, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `SELECT ` + snippetColumns + ` FROM stars
+								JOIN snippets ON snippets.id = stars.snippet_id
+								WHERE stars.user_id = $1 AND snippets.expires > $2
+								ORDER BY stars.created DESC;`
+
+	rows, err := s.DB.QueryContext(ctx, statement, userID, utcNow())
+	snippets, err := collect(rows, err, scanSnippet)
+	return snippets, classify(err)
+}
+
+// MostStarredThisWeek returns the unexpired snippets that picked up the most
+// stars over the last 7 days.
+func (s *StarModel) MostStarredThisWeek(ctx context.Context, limit int) ([]models.StarredSnippet, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `SELECT ` + snippetColumns + `, COUNT(*) AS stars FROM stars
+								JOIN snippets ON snippets.id = stars.snippet_id
+								WHERE stars.created > $2 AND snippets.expires > $3
+								GROUP BY snippets.id
+								ORDER BY stars DESC, snippets.id DESC LIMIT $1;`
+
+	now := utcNow()
+	rows, err := s.DB.QueryContext(ctx, statement, limit, now.AddDate(0, 0, -7), now)
+
+	snippets, err := collect(rows, err, func(row scanner, s *models.StarredSnippet) error {
+		return row.Scan(&s.ID, &s.Title, &s.Content, &s.ContentType, &s.UserID, &s.Views, &s.Revision,
+			timestamp{&s.Created}, timestamp{&s.Updated}, timestamp{&s.Expires}, &s.Stars)
+	})
+	return snippets, classify(err)
+}
+
+// rowsAffected() reports whether a statement changed exactly one row, and
+// classifies the error if it failed.
+func rowsAffected(result sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, classify(err)
+	}
+
+	n, err := result.RowsAffected()
+	return n == 1, classify(err)
+}
@@ -0,0 +1,82 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// user model that wraps a sqlite db
+type UserModel struct {
+	DB      *sql.DB
+	Timeout time.Duration // how long a single query may run, 0 for no limit
+}
+
+var _ models.UserModelInterface = (*UserModel)(nil)
+
+// Insert creates a user, returning models.ErrDuplicateEmail if the email is
+// already taken.
+func (u *UserModel) Insert(ctx context.Context, name, email, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+
+	// the timeout starts after hashing, it is only meant for the query.
+	ctx, cancel := withTimeout(ctx, u.Timeout)
+	defer cancel()
+
+	statement := `INSERT INTO users (name, email, hashed_password, created) VALUES ($1, $2, $3, $4);`
+
+	_, err = u.DB.ExecContext(ctx, statement, name, email, string(hashedPassword), utcNow())
+	if isConstraintError(err, constraintUnique, "users.email") {
+		return models.ErrDuplicateEmail
+	}
+
+	return classify(err)
+}
+
+// Authenticate returns the id of the user with this email and password, or
+// models.ErrInvalidCredentials.
+func (u *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
+	ctx, cancel := withTimeout(ctx, u.Timeout)
+	defer cancel()
+
+	var id int
+	var hashedPassword string
+	statement := `SELECT id, hashed_password FROM users WHERE email = $1;`
+
+	err := u.DB.QueryRowContext(ctx, statement, email).Scan(&id, &hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrInvalidCredentials
+		}
+		return 0, classify(err)
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return 0, models.ErrInvalidCredentials
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Exists reports whether there is a user with this id.
+func (u *UserModel) Exists(ctx context.Context, id int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, u.Timeout)
+	defer cancel()
+
+	var exists bool
+	statement := `SELECT EXISTS(SELECT true FROM users WHERE id = $1);`
+
+	err := u.DB.QueryRowContext(ctx, statement, id).Scan(&exists)
+	return exists, classify(err)
+}
@@ -0,0 +1,110 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+// view model that wraps a sqlite db
+type ViewModel struct {
+	DB      *sql.DB
+	Timeout time.Duration // how long a single query may run, 0 for no limit
+}
+
+var _ models.ViewModelInterface = (*ViewModel)(nil)
+
+// RecordBatch adds a batch of buffered view counts in a single transaction, so
+// a flush is either saved completely or not at all. Views of snippets that have
+// been deleted since are dropped.
+func (v *ViewModel) RecordBatch(ctx context.Context, counts map[models.ViewKey]int64) error {
+	ctx, cancel := withTimeout(ctx, v.Timeout)
+	defer cancel()
+
+	if len(counts) == 0 {
+		return nil
+	}
+
+	// the same totals as the postgres model: per snippet, per day and per
+	// referrer.
+	totals := make(map[int]int64)
+	daily := make(map[models.ViewKey]int64)
+	referrers := make(map[models.ViewKey]int64)
+
+	for key, n := range counts {
+		totals[key.SnippetID] += n
+		daily[models.ViewKey{SnippetID: key.SnippetID, Day: key.Day}] += n
+		if key.Referrer != "" {
+			referrers[models.ViewKey{SnippetID: key.SnippetID, Referrer: key.Referrer}] += n
+		}
+	}
+
+	tx, err := v.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return classify(err)
+	}
+	defer tx.Rollback()
+
+	for id, n := range totals {
+		statement := `UPDATE snippets SET views = views + $2 WHERE id = $1;`
+		if _, err := tx.ExecContext(ctx, statement, id, n); err != nil {
+			return classify(err)
+		}
+	}
+
+	for key, n := range daily {
+		statement := `INSERT INTO snippet_daily_views (snippet_id, day, views)
+									SELECT $1, $2, $3 WHERE EXISTS (SELECT 1 FROM snippets WHERE id = $1)
+									ON CONFLICT (snippet_id, day) DO UPDATE SET views = views + excluded.views;`
+		if _, err := tx.ExecContext(ctx, statement, key.SnippetID, key.Day.UTC(), n); err != nil {
+			return classify(err)
+		}
+	}
+
+	for key, n := range referrers {
+		statement := `INSERT INTO snippet_referrers (snippet_id, referrer, views)
+									SELECT $1, $2, $3 WHERE EXISTS (SELECT 1 FROM snippets WHERE id = $1)
+									ON CONFLICT (snippet_id, referrer) DO UPDATE SET views = views + excluded.views;`
+		if _, err := tx.ExecContext(ctx, statement, key.SnippetID, key.Referrer, n); err != nil {
+			return classify(err)
+		}
+	}
+
+	return classify(tx.Commit())
+}
+
+// Stats returns the views per day over the last `days` days (oldest first) and
+// the snippet's top referrers of all time.
+func (v *ViewModel) Stats(ctx context.Context, snippetID int, days int) (*models.SnippetStats, error) {
+	ctx, cancel := withTimeout(ctx, v.Timeout)
+	defer cancel()
+
+	stats := &models.SnippetStats{}
+
+	today := utcNow().Truncate(24 * time.Hour)
+	statement := `SELECT day, views FROM snippet_daily_views
+								WHERE snippet_id = $1 AND day > $2 ORDER BY day;`
+
+	rows, err := v.DB.QueryContext(ctx, statement, snippetID, today.AddDate(0, 0, -days))
+	stats.Daily, err = collect(rows, err, func(row scanner, d *models.DailyViews) error {
+		return row.Scan(timestamp{&d.Day}, &d.Views)
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	statement = `SELECT referrer, views FROM snippet_referrers
+								WHERE snippet_id = $1 ORDER BY views DESC, referrer LIMIT 10;`
+
+	rows, err = v.DB.QueryContext(ctx, statement, snippetID)
+	stats.TopReferrers, err = collect(rows, err, func(row scanner, r *models.ReferrerViews) error {
+		return row.Scan(&r.Referrer, &r.Views)
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,150 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+// webhook model that wraps a sqlite db
+//
+// NOTE: SQLite has no arrays, so the events a webhook subscribes to are stored
+// as a JSON array.
+type WebhookModel struct {
+	DB      *sql.DB
+	Timeout time.Duration // how long a single query may run, 0 for no limit
+}
+
+var _ models.WebhookModelInterface = (*WebhookModel)(nil)
+
+const webhookColumns = `id, user_id, url, secret, events, created`
+
+func scanWebhook(row scanner, w *models.Webhook) error {
+	var events string
+	if err := row.Scan(&w.ID, &w.UserID, &w.URL, &w.Secret, &events, timestamp{&w.Created}); err != nil {
+		return classify(err)
+	}
+
+	return json.Unmarshal([]byte(events), &w.Events)
+}
+
+// Insert adds a webhook for a user and returns its id.
+func (m *WebhookModel) Insert(ctx context.Context, userID int, url, secret string, events []string) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	js, err := json.Marshal(events)
+	if err != nil {
+		return 0, classify(err)
+	}
+
+	var id int
+	statement := `INSERT INTO webhooks (user_id, url, secret, events, created)
+								VALUES ($1, $2, $3, $4, $5) RETURNING id;`
+
+	err = m.DB.QueryRowContext(ctx, statement, userID, url, secret, string(js), utcNow()).Scan(&id)
+	if err != nil {
+		return 0, classify(err)
+	}
+
+	return id, nil
+}
+
+// Get returns a webhook.
+func (m *WebhookModel) Get(ctx context.Context, id int) (*models.Webhook, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	statement := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1;`
+
+	webhook := &models.Webhook{}
+	err := scanWebhook(m.DB.QueryRowContext(ctx, statement, id), webhook)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, classify(err)
+	}
+
+	return webhook, nil
+}
+
+// Delete removes a webhook along with its delivery log.
+func (m *WebhookModel) Delete(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	statement := `DELETE FROM webhooks WHERE id = $1;`
+
+	result, err := m.DB.ExecContext(ctx, statement, id)
+	return errIfNoRows(result, err)
+}
+
+// ForUser returns the webhooks a user has set up, newest first.
+func (m *WebhookModel) ForUser(ctx context.Context, userID int) ([]models.Webhook, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	statement := `SELECT ` + webhookColumns + ` FROM webhooks WHERE user_id = $1 ORDER BY id DESC;`
+
+	rows, err := m.DB.QueryContext(ctx, statement, userID)
+	webhooks, err := collect(rows, err, scanWebhook)
+	return webhooks, classify(err)
+}
+
+// Subscribed returns the webhooks a user has set up that want to hear about
+// event.
+func (m *WebhookModel) Subscribed(ctx context.Context, userID int, event string) ([]models.Webhook, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	statement := `SELECT ` + webhookColumns + ` FROM webhooks
+								WHERE user_id = $1 AND EXISTS (SELECT true FROM json_each(webhooks.events) WHERE value = $2);`
+
+	rows, err := m.DB.QueryContext(ctx, statement, userID, event)
+	webhooks, err := collect(rows, err, scanWebhook)
+	return webhooks, classify(err)
+}
+
+// LogDelivery records the outcome of a delivery attempt.
+func (m *WebhookModel) LogDelivery(ctx context.Context, d *models.WebhookDelivery) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	statement := `INSERT INTO webhook_deliveries
+									(webhook_id, event, payload, attempt, status_code, response, error, duration_ms, created)
+								VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6, $7, $8, $9);`
+
+	_, err := m.DB.ExecContext(ctx, statement,
+		d.WebhookID, d.Event, d.Payload, d.Attempt, d.StatusCode, d.Response, d.Error, d.DurationMS, utcNow())
+
+	// the webhook might have been deleted while the delivery was in flight,
+	// there is nothing left to log against so that's not an error.
+	if isConstraintError(err, constraintForeignKey, "") {
+		return nil
+	}
+
+	return classify(err)
+}
+
+// Deliveries returns the most recent delivery attempts for a webhook, newest first.
+func (m *WebhookModel) Deliveries(ctx context.Context, webhookID int, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	statement := `SELECT id, webhook_id, event, payload, attempt, COALESCE(status_code, 0) AS status_code,
+									response, error, duration_ms, created
+								FROM webhook_deliveries WHERE webhook_id = $1
+								ORDER BY id DESC LIMIT $2;`
+
+	rows, err := m.DB.QueryContext(ctx, statement, webhookID, limit)
+	deliveries, err := collect(rows, err, func(row scanner, d *models.WebhookDelivery) error {
+		return row.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Attempt, &d.StatusCode,
+			&d.Response, &d.Error, &d.DurationMS, timestamp{&d.Created})
+	})
+	return deliveries, classify(err)
+}
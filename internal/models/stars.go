@@ -0,0 +1,145 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// StarredSnippet is a snippet along with how many stars it has.
+type StarredSnippet struct {
+	Snippet
+	Stars int64
+}
+
+// StarModelInterface is what the web app needs from a star store.
+type StarModelInterface interface {
+	Star(ctx context.Context, userID, snippetID int) (bool, error)
+	Unstar(ctx context.Context, userID, snippetID int) (bool, error)
+	Count(ctx context.Context, snippetID int) (int64, error)
+	IsStarred(ctx context.Context, userID, snippetID int) (bool, error)
+	Starred(ctx context.Context, userID int) ([]Snippet, error)
+	MostStarredThisWeek(ctx context.Context, limit int) ([]StarredSnippet, error)
+}
+
+// star model that wraps a postgres db connection
+type StarModel struct {
+	DB      *pgxpool.Pool
+	Timeout time.Duration // how long a single query may run, 0 for no limit
+}
+
+// Star records that a user has starred a snippet. Starring a snippet twice is
+// not an error, the second insert is ignored because of the primary key on
+// (user_id, snippet_id), which also keeps concurrent requests from creating
+// duplicates. It returns true if a new star was added.
+//
+// NOTE: postgres doesn't take a parameter's type from the column when it is
+// selected into an INSERT, an uncast $1 would be text.
+func (s *StarModel) Star(ctx context.Context, userID, snippetID int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `INSERT INTO stars (user_id, snippet_id, created)
+								SELECT $1::integer, id, NOW() AT TIME ZONE 'UTC' FROM snippets
+								WHERE id = $2 AND expires > NOW() AT TIME ZONE 'UTC'
+								ON CONFLICT (user_id, snippet_id) DO NOTHING;`
+
+	tag, err := s.DB.Exec(ctx, statement, userID, snippetID)
+	if err != nil {
+		return false, classify(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// Unstar removes a user's star from a snippet. Removing a star that isn't there
+// is not an error. It returns true if a star was removed.
+func (s *StarModel) Unstar(ctx context.Context, userID, snippetID int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `DELETE FROM stars WHERE user_id = $1 AND snippet_id = $2;`
+
+	tag, err := s.DB.Exec(ctx, statement, userID, snippetID)
+	if err != nil {
+		return false, classify(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// Count returns how many users have starred a snippet.
+func (s *StarModel) Count(ctx context.Context, snippetID int) (int64, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	var count int64
+	statement := `SELECT COUNT(*) FROM stars WHERE snippet_id = $1;`
+
+	err := s.DB.QueryRow(ctx, statement, snippetID).Scan(&count)
+	if err != nil {
+		return 0, classify(err)
+	}
+
+	return count, nil
+}
+
+// IsStarred reports whether a user has starred a snippet.
+func (s *StarModel) IsStarred(ctx context.Context, userID, snippetID int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	var starred bool
+	statement := `SELECT EXISTS(SELECT true FROM stars WHERE user_id = $1 AND snippet_id = $2);`
+
+	err := s.DB.QueryRow(ctx, statement, userID, snippetID).Scan(&starred)
+	if err != nil {
+		return false, classify(err)
+	}
+
+	return starred, nil
+}
+
+// Starred returns the unexpired snippets a user has starred, most recently
+// starred first.
+func (s *StarModel) Starred(ctx context.Context, userID int) ([]Snippet, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `SELECT ` + snippetColumns + ` FROM stars
+								JOIN snippets ON snippets.id = stars.snippet_id
+								WHERE stars.user_id = $1 AND snippets.expires > NOW() AT TIME ZONE 'UTC'
+								ORDER BY stars.created DESC;`
+
+	rows, err := s.DB.Query(ctx, statement, userID)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	snippets, err := pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+	return snippets, classify(err)
+}
+
+// MostStarredThisWeek returns the unexpired snippets that picked up the most
+// stars over the last 7 days.
+func (s *StarModel) MostStarredThisWeek(ctx context.Context, limit int) ([]StarredSnippet, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	statement := `SELECT ` + snippetColumns + `, COUNT(*) AS stars FROM stars
+								JOIN snippets ON snippets.id = stars.snippet_id
+								WHERE stars.created > (NOW() AT TIME ZONE 'UTC') - INTERVAL '7 days'
+									AND snippets.expires > NOW() AT TIME ZONE 'UTC'
+								GROUP BY snippets.id
+								ORDER BY stars DESC, snippets.id DESC LIMIT $1;`
+
+	rows, err := s.DB.Query(ctx, statement, limit)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	snippets, err := pgx.CollectRows(rows, pgx.RowToStructByName[StarredSnippet])
+	return snippets, classify(err)
+}
@@ -21,27 +21,41 @@ type User struct {
 	Created        time.Time
 }
 
+// UserModelInterface is what the web app needs from a user store. It is
+// satisfied by *UserModel, and by the in-memory store in the mocks package.
+type UserModelInterface interface {
+	Insert(ctx context.Context, name, email, password string) error
+	Authenticate(ctx context.Context, email, password string) (int, error)
+	Exists(ctx context.Context, id int) (bool, error)
+}
+
 // user model that wraps a db connection pool
 type UserModel struct {
-	DB *pgxpool.Pool
+	DB      *pgxpool.Pool
+	Timeout time.Duration // how long a single query may run, 0 for no limit
 }
 
 // create a new user record in the db
-func (u *UserModel) Insert(name, email, password string) error {
+func (u *UserModel) Insert(ctx context.Context, name, email, password string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
 		return err
 	}
 
-	statement := `INSERT INTO users (name, email, hashed_password, created) VALUES ($1, $2, $3, NOW() AT TIME ZONE 'UTC');`
+	// the timeout starts after hashing, it is only meant for the query.
+	ctx, cancel := withTimeout(ctx, u.Timeout)
+	defer cancel()
+
+	statement := `INSERT INTO users (name, email, hashed_password, created) VALUES ($1, $2, $3, $4);`
 
 	args := []any{
 		name,
 		email,
 		hashedPassword,
+		utcNow(),
 	}
 
-	_, err = u.DB.Exec(context.Background(), statement, args...)
+	_, err = u.DB.Exec(ctx, statement, args...)
 	if err != nil {
 		var postgreqlError *pgconn.PgError
 
@@ -53,7 +67,7 @@ func (u *UserModel) Insert(name, email, password string) error {
 			}
 		}
 
-		return err
+		return classify(err)
 	}
 
 	return nil
@@ -61,18 +75,20 @@ func (u *UserModel) Insert(name, email, password string) error {
 
 // Verifys whether a user exists with the provided email and password.
 // This will return the relevant user ID if they do.
-func (u *UserModel) Authenticate(email, password string) (int, error) {
+func (u *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
+	ctx, cancel := withTimeout(ctx, u.Timeout)
+	defer cancel()
 
 	// Check if user exists
 	var id int
 	var hashedPassword []byte
 	statement := "select id, hashed_password from users where email = $1"
-	err := u.DB.QueryRow(context.Background(), statement, email).Scan(&id, &hashedPassword)
+	err := u.DB.QueryRow(ctx, statement, email).Scan(&id, &hashedPassword)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return 0, ErrInvalidCredentials
 		} else {
-			return 0, err
+			return 0, classify(err)
 		}
 	}
 
@@ -90,6 +106,13 @@ func (u *UserModel) Authenticate(email, password string) (int, error) {
 }
 
 // Used to check if a user exists with a specific ID
-func (u *UserModel) Exists(id int) (bool, error) {
-	return false, nil
+func (u *UserModel) Exists(ctx context.Context, id int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, u.Timeout)
+	defer cancel()
+
+	var exists bool
+	statement := `SELECT EXISTS(SELECT true FROM users WHERE id = $1);`
+
+	err := u.DB.QueryRow(ctx, statement, id).Scan(&exists)
+	return exists, classify(err)
 }
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ViewKey identifies one bucket of buffered view counts: views of a snippet on
+// a given day coming from a given referrer.
+type ViewKey struct {
+	SnippetID int
+	Day       time.Time // truncated to midnight UTC
+	Referrer  string    // referring host, or "" for direct visits
+}
+
+// DailyViews is the number of views a snippet got on a single day.
+type DailyViews struct {
+	Day   time.Time
+	Views int64
+}
+
+// ReferrerViews is the number of views a snippet got from a single referrer.
+type ReferrerViews struct {
+	Referrer string
+	Views    int64
+}
+
+// SnippetStats holds the analytics shown to a snippet's owner.
+type SnippetStats struct {
+	Daily        []DailyViews
+	TopReferrers []ReferrerViews
+}
+
+// ViewModelInterface is what the web app needs from a view count store.
+type ViewModelInterface interface {
+	RecordBatch(ctx context.Context, counts map[ViewKey]int64) error
+	Stats(ctx context.Context, snippetID int, days int) (*SnippetStats, error)
+}
+
+// view model that wraps a postgres db connection
+type ViewModel struct {
+	DB      *pgxpool.Pool
+	Timeout time.Duration // how long a single query may run, 0 for no limit
+}
+
+// RecordBatch adds a batch of buffered view counts to the database in a single
+// transaction, so a flush is either saved completely or not at all. Views of
+// snippets that have been deleted since are dropped.
+func (v *ViewModel) RecordBatch(ctx context.Context, counts map[ViewKey]int64) error {
+	ctx, cancel := withTimeout(ctx, v.Timeout)
+	defer cancel()
+
+	if len(counts) == 0 {
+		return nil
+	}
+
+	// the total per snippet goes onto the snippets table so the listing can sort
+	// on it, the per day and per referrer totals go into their own tables.
+	totals := make(map[int]int64)
+	referrers := make(map[ViewKey]int64)
+	daily := make(map[ViewKey]int64)
+
+	for key, n := range counts {
+		totals[key.SnippetID] += n
+		daily[ViewKey{SnippetID: key.SnippetID, Day: key.Day}] += n
+		if key.Referrer != "" {
+			referrers[ViewKey{SnippetID: key.SnippetID, Referrer: key.Referrer}] += n
+		}
+	}
+
+	batch := &pgx.Batch{}
+
+	for id, n := range totals {
+		batch.Queue(`UPDATE snippets SET views = views + $2 WHERE id = $1;`, id, n)
+	}
+
+	for key, n := range daily {
+		batch.Queue(`INSERT INTO snippet_daily_views (snippet_id, day, views)
+								SELECT $1::integer, $2::date, $3::bigint WHERE EXISTS (SELECT 1 FROM snippets WHERE id = $1)
+								ON CONFLICT (snippet_id, day) DO UPDATE SET views = snippet_daily_views.views + EXCLUDED.views;`,
+			key.SnippetID, key.Day, n)
+	}
+
+	for key, n := range referrers {
+		batch.Queue(`INSERT INTO snippet_referrers (snippet_id, referrer, views)
+								SELECT $1::integer, $2::text, $3::bigint WHERE EXISTS (SELECT 1 FROM snippets WHERE id = $1)
+								ON CONFLICT (snippet_id, referrer) DO UPDATE SET views = snippet_referrers.views + EXCLUDED.views;`,
+			key.SnippetID, key.Referrer, n)
+	}
+
+	tx, err := v.DB.Begin(ctx)
+	if err != nil {
+		return classify(err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.SendBatch(ctx, batch).Close()
+	if err != nil {
+		return classify(err)
+	}
+
+	return classify(tx.Commit(ctx))
+}
+
+// Stats returns the views per day over the last `days` days (oldest first) and
+// the snippet's top referrers of all time.
+func (v *ViewModel) Stats(ctx context.Context, snippetID int, days int) (*SnippetStats, error) {
+	ctx, cancel := withTimeout(ctx, v.Timeout)
+	defer cancel()
+
+	stats := &SnippetStats{}
+
+	statement := `SELECT day, views FROM snippet_daily_views
+								WHERE snippet_id = $1 AND day > (NOW() AT TIME ZONE 'UTC')::date - $2::int
+								ORDER BY day;`
+
+	rows, err := v.DB.Query(ctx, statement, snippetID, days)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	stats.Daily, err = pgx.CollectRows(rows, pgx.RowToStructByPos[DailyViews])
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	statement = `SELECT referrer, views FROM snippet_referrers
+								WHERE snippet_id = $1 ORDER BY views DESC, referrer LIMIT 10;`
+
+	rows, err = v.DB.Query(ctx, statement, snippetID)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	stats.TopReferrers, err = pgx.CollectRows(rows, pgx.RowToStructByPos[ReferrerViews])
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// snippet events that webhooks can subscribe to.
+const (
+	EventSnippetCreated = "snippet.created"
+	EventSnippetUpdated = "snippet.updated"
+	EventSnippetDeleted = "snippet.deleted"
+	EventSnippetExpired = "snippet.expired"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to.
+var WebhookEvents = []string{EventSnippetCreated, EventSnippetUpdated, EventSnippetDeleted, EventSnippetExpired}
+
+// webhook struct to represent an endpoint we send snippet events to
+type Webhook struct {
+	ID      int
+	UserID  int
+	URL     string
+	Secret  string // used to sign each delivery with HMAC-SHA256
+	Events  []string
+	Created time.Time
+}
+
+// WebhookDelivery is a single attempt at delivering an event to a webhook.
+type WebhookDelivery struct {
+	ID         int
+	WebhookID  int
+	Event      string
+	Payload    string
+	Attempt    int
+	StatusCode int    // 0 if we never got a response
+	Response   string // the response status line, e.g. "200 OK"
+	Error      string // why the attempt failed, empty on success
+	DurationMS int64
+	Created    time.Time
+}
+
+// WebhookModelInterface is what the web app needs from a webhook store. It
+// includes webhook.Store, so the same store can be handed to the dispatcher.
+type WebhookModelInterface interface {
+	Insert(ctx context.Context, userID int, url, secret string, events []string) (int, error)
+	Get(ctx context.Context, id int) (*Webhook, error)
+	Delete(ctx context.Context, id int) error
+	ForUser(ctx context.Context, userID int) ([]Webhook, error)
+	Subscribed(ctx context.Context, userID int, event string) ([]Webhook, error)
+	LogDelivery(ctx context.Context, d *WebhookDelivery) error
+	Deliveries(ctx context.Context, webhookID int, limit int) ([]WebhookDelivery, error)
+}
+
+// webhook model that wraps a postgres db connection
+type WebhookModel struct {
+	DB      *pgxpool.Pool
+	Timeout time.Duration // how long a single query may run, 0 for no limit
+}
+
+// Insert adds a webhook for a user and returns its id.
+func (m *WebhookModel) Insert(ctx context.Context, userID int, url, secret string, events []string) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var id int
+	statement := `INSERT INTO webhooks (user_id, url, secret, events, created)
+								VALUES ($1, $2, $3, $4, NOW() AT TIME ZONE 'UTC') RETURNING id;`
+
+	err := m.DB.QueryRow(ctx, statement, userID, url, secret, events).Scan(&id)
+	if err != nil {
+		return 0, classify(err)
+	}
+
+	return id, nil
+}
+
+// Get webhook by ID
+func (m *WebhookModel) Get(ctx context.Context, id int) (*Webhook, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	statement := `SELECT id, user_id, url, secret, events, created FROM webhooks WHERE id = $1;`
+
+	rows, err := m.DB.Query(ctx, statement, id)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	webhook, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[Webhook])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, classify(err)
+	}
+
+	return webhook, nil
+}
+
+// Delete removes a webhook along with its delivery log.
+func (m *WebhookModel) Delete(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	statement := `DELETE FROM webhooks WHERE id = $1;`
+
+	tag, err := m.DB.Exec(ctx, statement, id)
+	if err != nil {
+		return classify(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// ForUser returns the webhooks a user has set up, newest first.
+func (m *WebhookModel) ForUser(ctx context.Context, userID int) ([]Webhook, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	statement := `SELECT id, user_id, url, secret, events, created FROM webhooks
+								WHERE user_id = $1 ORDER BY id DESC;`
+
+	rows, err := m.DB.Query(ctx, statement, userID)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	webhooks, err := pgx.CollectRows(rows, pgx.RowToStructByName[Webhook])
+	return webhooks, classify(err)
+}
+
+// Subscribed returns the webhooks a user has set up that want to hear about
+// event.
+func (m *WebhookModel) Subscribed(ctx context.Context, userID int, event string) ([]Webhook, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	statement := `SELECT id, user_id, url, secret, events, created FROM webhooks
+								WHERE user_id = $1 AND $2 = ANY(events);`
+
+	rows, err := m.DB.Query(ctx, statement, userID, event)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	webhooks, err := pgx.CollectRows(rows, pgx.RowToStructByName[Webhook])
+	return webhooks, classify(err)
+}
+
+// LogDelivery records the outcome of a delivery attempt.
+func (m *WebhookModel) LogDelivery(ctx context.Context, d *WebhookDelivery) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	statement := `INSERT INTO webhook_deliveries
+									(webhook_id, event, payload, attempt, status_code, response, error, duration_ms, created)
+								VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6, $7, $8, NOW() AT TIME ZONE 'UTC');`
+
+	_, err := m.DB.Exec(ctx, statement,
+		d.WebhookID, d.Event, d.Payload, d.Attempt, d.StatusCode, d.Response, d.Error, d.DurationMS)
+
+	// the webhook might have been deleted while the delivery was in flight,
+	// there is nothing left to log against so that's not an error.
+	if isForeignKeyViolation(err) {
+		return nil
+	}
+
+	return classify(err)
+}
+
+// Deliveries returns the most recent delivery attempts for a webhook, newest first.
+func (m *WebhookModel) Deliveries(ctx context.Context, webhookID int, limit int) ([]WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	statement := `SELECT id, webhook_id, event, payload, attempt, COALESCE(status_code, 0) AS status_code,
+									response, error, duration_ms, created
+								FROM webhook_deliveries WHERE webhook_id = $1
+								ORDER BY id DESC LIMIT $2;`
+
+	rows, err := m.DB.Query(ctx, statement, webhookID, limit)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	deliveries, err := pgx.CollectRows(rows, pgx.RowToStructByName[WebhookDelivery])
+	return deliveries, classify(err)
+}
@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestStore returns a MemoryStore on a clock the test moves forward.
+func newTestStore(idle time.Duration) (*MemoryStore, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	s := NewMemoryStore(idle)
+	s.lastSweep = now
+	s.now = func() time.Time { return now }
+
+	return s, &now
+}
+
+func take(t *testing.T, s *MemoryStore, key string, limit Limit) (bool, time.Duration) {
+	t.Helper()
+
+	ok, retryAfter, err := s.Take(t.Context(), key, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ok, retryAfter
+}
+
+func TestBurst(t *testing.T) {
+	s, _ := newTestStore(time.Hour)
+	limit := Limit{Burst: 3, Period: time.Minute}
+
+	for i := range 3 {
+		if ok, _ := take(t, s, "a", limit); !ok {
+			t.Fatalf("request %d of the burst was refused", i+1)
+		}
+	}
+
+	ok, retryAfter := take(t, s, "a", limit)
+	if ok {
+		t.Fatal("request after the burst was allowed")
+	}
+
+	// 3 a minute is one every 20 seconds.
+	if retryAfter.Round(time.Millisecond) != 20*time.Second {
+		t.Errorf("got Retry-After %s, want 20s", retryAfter)
+	}
+
+	// every key has its own bucket.
+	if ok, _ := take(t, s, "b", limit); !ok {
+		t.Error("another key was refused")
+	}
+}
+
+func TestRefill(t *testing.T) {
+	s, now := newTestStore(time.Hour)
+	limit := Limit{Burst: 3, Period: time.Minute}
+
+	for range 3 {
+		take(t, s, "a", limit)
+	}
+
+	*now = now.Add(19 * time.Second)
+	if ok, retryAfter := take(t, s, "a", limit); ok || retryAfter.Round(time.Millisecond) != time.Second {
+		t.Fatalf("got %t, Retry-After %s before a token came back, want false, 1s", ok, retryAfter)
+	}
+
+	*now = now.Add(time.Second)
+	if ok, _ := take(t, s, "a", limit); !ok {
+		t.Fatal("refused after a token came back")
+	}
+	if ok, _ := take(t, s, "a", limit); ok {
+		t.Fatal("allowed a second request when only one token came back")
+	}
+
+	// a long wait fills the bucket, but no further than the burst.
+	*now = now.Add(time.Hour)
+	for i := range 3 {
+		if ok, _ := take(t, s, "a", limit); !ok {
+			t.Fatalf("request %d after refilling was refused", i+1)
+		}
+	}
+	if ok, _ := take(t, s, "a", limit); ok {
+		t.Error("the bucket refilled past the burst")
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	s, _ := newTestStore(time.Hour)
+
+	for range 100 {
+		if ok, _ := take(t, s, "a", Limit{}); !ok {
+			t.Fatal("the zero Limit refused a request")
+		}
+	}
+
+	if got := s.Len(); got != 0 {
+		t.Errorf("Len() = %d, want no buckets for the zero Limit", got)
+	}
+}
+
+func TestIdleBucketsForgotten(t *testing.T) {
+	s, now := newTestStore(time.Minute)
+	limit := Limit{Burst: 2, Period: time.Hour}
+
+	// a has one token left and takes half an hour to fill up again, b is
+	// taken once a minute later.
+	take(t, s, "a", limit)
+	*now = now.Add(time.Minute)
+	take(t, s, "b", limit)
+
+	// both are idle, but neither is full, so forgetting them would hand back
+	// a token early.
+	*now = now.Add(2 * time.Minute)
+	take(t, s, "c", limit)
+	if got := s.Len(); got != 3 {
+		t.Fatalf("Len() = %d, want the 3 buckets that aren't full kept", got)
+	}
+
+	// a and b have filled up and been idle since, c is still filling up.
+	*now = now.Add(29 * time.Minute)
+	take(t, s, "d", limit)
+	if got := s.Len(); got != 2 {
+		t.Fatalf("Len() = %d, want a and b forgotten", got)
+	}
+
+	// a forgotten bucket starts full again, which is where it had got to.
+	take(t, s, "a", limit)
+	if ok, _ := take(t, s, "a", limit); !ok {
+		t.Error("a forgotten bucket didn't start full")
+	}
+	if ok, _ := take(t, s, "a", limit); ok {
+		t.Error("a forgotten bucket started with more than the burst")
+	}
+}
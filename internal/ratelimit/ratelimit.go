@@ -0,0 +1,103 @@
+// Package ratelimit limits how often a client can do something, with a token
+// bucket per client: each request takes a token, and tokens come back at a
+// steady rate up to the bucket's size.
+//
+// Buckets are kept in a Store. MemoryStore keeps them in the process, so with
+// several instances running each one applies the limits on its own.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Burst requests at once, and Burst more every Period after that,
+// e.g. 30/1m is 30 requests at once or one every two seconds. The zero Limit
+// allows everything.
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// Store keeps the token buckets. Implementations must be safe to use from
+// several goroutines.
+type Store interface {
+	// Take takes a token from the bucket for key, sized and refilled as limit
+	// says. If the bucket is empty it returns false and how long until the
+	// next token.
+	Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error)
+}
+
+// ParseLimit parses a limit written as requests/period, e.g. "30/1m". "" and
+// "0" are the zero Limit.
+func ParseLimit(s string) (Limit, error) {
+	if s == "" || s == "0" {
+		return Limit{}, nil
+	}
+
+	burst, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("%q is not requests/period, e.g. 30/1m", s)
+	}
+
+	var limit Limit
+	var err error
+
+	limit.Burst, err = strconv.Atoi(burst)
+	if err != nil || limit.Burst < 0 {
+		return Limit{}, fmt.Errorf("%q: requests must be a whole number", s)
+	}
+
+	limit.Period, err = time.ParseDuration(period)
+	if err != nil || limit.Period <= 0 {
+		return Limit{}, fmt.Errorf("%q: period must be a positive duration", s)
+	}
+
+	if limit.Burst == 0 {
+		return Limit{}, nil
+	}
+
+	return limit, nil
+}
+
+// Unlimited reports whether l is the zero Limit.
+func (l Limit) Unlimited() bool {
+	return l.Burst == 0
+}
+
+// String writes l the way ParseLimit reads it.
+func (l Limit) String() string {
+	if l.Unlimited() {
+		return "0"
+	}
+
+	// 1m rather than 1m0s.
+	period := l.Period.String()
+	if strings.HasSuffix(period, "m0s") {
+		period = strings.TrimSuffix(period, "0s")
+	}
+	if strings.HasSuffix(period, "h0m") {
+		period = strings.TrimSuffix(period, "0m")
+	}
+
+	return fmt.Sprintf("%d/%s", l.Burst, period)
+}
+
+// Set parses s into l, so a *Limit can be used as a flag.Value.
+func (l *Limit) Set(s string) error {
+	limit, err := ParseLimit(s)
+	if err != nil {
+		return err
+	}
+
+	*l = limit
+	return nil
+}
+
+// rate is how many tokens come back per second.
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
@@ -1,6 +1,7 @@
 package validator
 
 import (
+	"net/url"
 	"regexp"
 	"strings"
 	"unicode/utf8"
@@ -64,6 +65,16 @@ func PermittedInt(value int, permittedValues ...int) bool {
 	return false
 }
 
+// PermittedString() returns true if a value is in a list of permitted strings.
+func PermittedString(value string, permittedValues ...string) bool {
+	for i := range permittedValues {
+		if value == permittedValues[i] {
+			return true
+		}
+	}
+	return false
+}
+
 // Use the regexp.MustCompile() function to parse a regular expression pattern
 // for sanity checking the format of an email address. This returns a pointer to
 // a 'compiled' regexp.Regexp type, or panics in the event of an error. Parsing
@@ -71,6 +82,16 @@ func PermittedInt(value int, permittedValues ...int) bool {
 // variable is more performant than re-parsing the pattern each time we need it.
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+// ValidURL() returns true if a value is an absolute http or https URL.
+func ValidURL(value string) bool {
+	u, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
 // MinChars() returns true if a value contains at least n characters
 func MinChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) >= n
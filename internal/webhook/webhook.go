@@ -0,0 +1,412 @@
+// Package webhook delivers snippet events to the webhook endpoints users have
+// configured. A user's webhooks only hear about the snippets they own.
+// Deliveries happen on a background queue, are signed with HMAC-SHA256 and are
+// retried with exponential backoff when they fail.
+//
+// Webhook URLs are picked by users, so deliveries refuse to connect to
+// loopback, private, link-local and other internal addresses. The check is
+// made on the address actually dialed, after DNS, so a hostname that resolves
+// to an internal address is refused too.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+	"github.com/corbinlazarone/snippetbox/internal/worker"
+)
+
+// headers sent with every delivery.
+const (
+	SignatureHeader = "X-Snippetbox-Signature" // "sha256=" followed by the hex HMAC of the body
+	EventHeader     = "X-Snippetbox-Event"
+)
+
+// ErrForbiddenAddress is returned for a delivery to an internal address.
+var ErrForbiddenAddress = errors.New("webhook: address not allowed")
+
+// forbiddenPrefixes are the ranges refused on top of what netip.Addr already
+// reports as loopback, private, link-local, multicast or unspecified.
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT, also some cloud metadata services
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, can reach any IPv4 address
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+	netip.MustParsePrefix("2002::/16"),      // 6to4, embeds an IPv4 address
+	netip.MustParsePrefix("fec0::/10"),      // deprecated site-local
+}
+
+// Store is what the dispatcher needs from the database. It is satisfied by
+// *models.WebhookModel.
+type Store interface {
+	Subscribed(ctx context.Context, userID int, event string) ([]models.Webhook, error)
+	LogDelivery(ctx context.Context, d *models.WebhookDelivery) error
+}
+
+// Config holds the dispatcher settings. Zero values are replaced with the
+// defaults in New().
+type Config struct {
+	Workers     int           // number of deliveries made in parallel
+	QueueSize   int           // deliveries that can wait for a worker before events are dropped
+	MaxAttempts int           // attempts per delivery, including the first one
+	Backoff     time.Duration // wait before the first retry, doubled on every retry after that
+
+	// Client makes the deliveries. The default one refuses internal addresses
+	// and doesn't follow redirects, a Client given here has to take care of
+	// that itself.
+	Client *http.Client
+}
+
+// Event is the JSON body POSTed to a webhook.
+type Event struct {
+	Event   string    `json:"event"`
+	Created time.Time `json:"created"`
+	Data    any       `json:"data"`
+}
+
+type delivery struct {
+	webhook models.Webhook
+	event   string
+	payload []byte
+	attempt int
+}
+
+// Dispatcher fans events out to the subscribed webhooks and delivers them.
+type Dispatcher struct {
+	store  Store
+	logger *slog.Logger
+	config Config
+
+	queue   chan delivery
+	retries sync.WaitGroup // retries waiting for their backoff to pass
+	workers sync.WaitGroup
+
+	mu      sync.RWMutex
+	stopped bool
+	stop    chan struct{}
+}
+
+// New creates a dispatcher. Call Start() to begin delivering and Stop() to
+// shut it down.
+func New(store Store, logger *slog.Logger, config Config) *Dispatcher {
+	if config.Workers <= 0 {
+		config.Workers = 4
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1000
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = 5 * time.Second
+	}
+	if config.Client == nil {
+		config.Client = newClient()
+	}
+
+	return &Dispatcher{
+		store:  store,
+		logger: logger,
+		config: config,
+		queue:  make(chan delivery, config.QueueSize),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start() starts the delivery workers.
+func (d *Dispatcher) Start() {
+	for i := 0; i < d.config.Workers; i++ {
+		d.workers.Add(1)
+		go d.work()
+	}
+}
+
+// Stop() stops accepting new events, waits for in-flight deliveries to finish
+// and returns. Retries that are still waiting out their backoff are dropped.
+// If ctx is done first, Stop() returns its error without waiting any longer.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return nil
+	}
+	d.stopped = true
+	close(d.stop)
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.retries.Wait()
+		close(d.queue)
+		d.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Publish() queues event for every webhook userID has subscribed to it, userID
+// being the owner of the snippet the event is about. Users only hear about
+// their own snippets, so an event about a snippet with no owner (userID 0)
+// goes nowhere. data is sent as the "data" field of the payload. It doesn't
+// wait for the deliveries, and never blocks the caller: when the queue is full
+// the event is dropped and logged.
+func (d *Dispatcher) Publish(userID int, event string, data any) {
+	payload, err := json.Marshal(Event{Event: event, Created: time.Now().UTC(), Data: data})
+	if err != nil {
+		d.logger.Error("encoding webhook payload", "event", event, "error", err)
+		return
+	}
+
+	// looking up the subscribers is a database query, so do it off the
+	// caller's goroutine.
+	if userID == 0 {
+		return
+	}
+
+	go func() {
+		webhooks, err := d.store.Subscribed(context.Background(), userID, event)
+		if err != nil {
+			d.logger.Error("finding webhook subscribers", "event", event, "error", err)
+			return
+		}
+
+		for _, webhook := range webhooks {
+			d.enqueue(delivery{webhook: webhook, event: event, payload: payload, attempt: 1})
+		}
+	}()
+}
+
+func (d *Dispatcher) enqueue(job delivery) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.stopped {
+		d.logger.Warn("dropping webhook delivery, dispatcher is stopped", "event", job.event, "webhook_id", job.webhook.ID)
+		return
+	}
+
+	select {
+	case d.queue <- job:
+	default:
+		d.logger.Warn("webhook queue full, dropping delivery", "event", job.event, "webhook_id", job.webhook.ID)
+	}
+}
+
+func (d *Dispatcher) work() {
+	defer d.workers.Done()
+
+	for job := range d.queue {
+		d.deliver(job)
+	}
+}
+
+// deliver() makes one attempt at a delivery, logs it, and schedules a retry if
+// it failed and there are attempts left.
+func (d *Dispatcher) deliver(job delivery) {
+	defer worker.Recover(d.logger, "webhook delivery", "webhook_id", job.webhook.ID)
+
+	record := &models.WebhookDelivery{
+		WebhookID: job.webhook.ID,
+		Event:     job.event,
+		Payload:   string(job.payload),
+		Attempt:   job.attempt,
+	}
+
+	start := time.Now()
+	err := d.send(job, record)
+	record.DurationMS = time.Since(start).Milliseconds()
+
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	if logErr := d.store.LogDelivery(context.Background(), record); logErr != nil {
+		d.logger.Error("logging webhook delivery", "webhook_id", job.webhook.ID, "error", logErr)
+	}
+
+	if err != nil && job.attempt < d.config.MaxAttempts {
+		d.retry(job)
+	}
+}
+
+// send() POSTs the payload to the webhook, filling in the response details on
+// record. Anything other than a 2xx response counts as a failure.
+func (d *Dispatcher) send(job delivery, record *models.WebhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, job.webhook.URL, bytes.NewReader(job.payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Snippetbox-Webhook")
+	req.Header.Set(EventHeader, job.event)
+	req.Header.Set(SignatureHeader, Sign(job.webhook.Secret, job.payload))
+
+	resp, err := d.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// NOTE: only the status line is kept, never the body: it would show the
+	// user whatever the receiver answered with.
+	record.StatusCode = resp.StatusCode
+	record.Response = resp.Status
+
+	// read a little of the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+
+	return nil
+}
+
+// retry() puts a failed delivery back on the queue once its backoff has passed.
+// The wait doubles with every attempt: Backoff, 2*Backoff, 4*Backoff...
+func (d *Dispatcher) retry(job delivery) {
+	wait := d.config.Backoff << (job.attempt - 1)
+	job.attempt++
+
+	d.retries.Add(1)
+	go func() {
+		defer d.retries.Done()
+
+		select {
+		case <-time.After(wait):
+			d.enqueue(job)
+		case <-d.stop:
+			d.logger.Warn("dropping webhook retry, shutting down", "event", job.event, "webhook_id", job.webhook.ID)
+		}
+	}()
+}
+
+// Sign() returns the signature header value for a payload: "sha256=" followed
+// by the hex encoded HMAC-SHA256 of the payload, keyed with the webhook secret.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify() checks a signature header value against a payload. Receivers written
+// in Go can use it to check deliveries are really from us.
+func Verify(secret string, payload []byte, signature string) error {
+	if !hmac.Equal([]byte(Sign(secret, payload)), []byte(signature)) {
+		return errors.New("webhook: signature mismatch")
+	}
+	return nil
+}
+
+// newClient() returns the default delivery client. Every connection it makes
+// goes through checkDial(), and redirects are returned as they are, so a
+// receiver can't send us on to an internal address. A redirect counts as a
+// failed delivery like any other non-2xx response.
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: checkDial,
+	}
+
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		// NOTE: no proxy from the environment, the check would only see the
+		// proxy's address.
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// checkDial() is the net.Dialer Control hook. It runs with the resolved
+// address, just before connecting, so it also covers DNS answers that change
+// between lookups.
+func checkDial(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+	}
+
+	return checkAddr(addrPort.Addr())
+}
+
+// checkAddr() returns ErrForbiddenAddress for the addresses a webhook may not
+// be delivered to.
+func checkAddr(ip netip.Addr) error {
+	ip = ip.Unmap()
+
+	forbidden := !ip.IsValid() ||
+		ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() || // includes 169.254.169.254, the metadata service on most clouds
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified()
+
+	for _, prefix := range forbiddenPrefixes {
+		forbidden = forbidden || prefix.Contains(ip)
+	}
+
+	if forbidden {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, ip)
+	}
+
+	return nil
+}
+
+// CheckURL() returns ErrForbiddenAddress if a webhook URL's host is an
+// internal address or localhost, so users find out when they add it rather
+// than from the delivery log. Other hostnames are checked when they are
+// dialed.
+func CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return checkAddr(ip)
+	}
+
+	return nil
+}
@@ -0,0 +1,339 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/corbinlazarone/snippetbox/internal/models"
+)
+
+// store is a Store with one webhook, owned by user 1, that keeps the delivery
+// log and the users subscribers were looked up for.
+type store struct {
+	webhook models.Webhook
+
+	mu         sync.Mutex
+	deliveries []models.WebhookDelivery
+	logged     chan struct{}
+	lookups    chan int
+}
+
+func newStore(url string) *store {
+	return &store{
+		webhook: models.Webhook{ID: 1, UserID: 1, URL: url, Secret: "s3cret", Events: []string{models.EventSnippetCreated}},
+		logged:  make(chan struct{}, 100),
+		lookups: make(chan int, 100),
+	}
+}
+
+func (s *store) Subscribed(_ context.Context, userID int, event string) ([]models.Webhook, error) {
+	s.lookups <- userID
+
+	if userID != s.webhook.UserID {
+		return nil, nil
+	}
+	return []models.Webhook{s.webhook}, nil
+}
+
+func (s *store) LogDelivery(_ context.Context, d *models.WebhookDelivery) error {
+	s.mu.Lock()
+	s.deliveries = append(s.deliveries, *d)
+	s.mu.Unlock()
+
+	s.logged <- struct{}{}
+	return nil
+}
+
+// wait() waits for n deliveries to be logged and returns the log.
+func (s *store) wait(t *testing.T, n int) []models.WebhookDelivery {
+	t.Helper()
+
+	for range n {
+		select {
+		case <-s.logged:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %d deliveries", n)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deliveries
+}
+
+func newDispatcher(t *testing.T, s *store, config Config) *Dispatcher {
+	t.Helper()
+
+	d := New(s, slog.New(slog.NewTextHandler(io.Discard, nil)), config)
+	d.Start()
+	t.Cleanup(func() { d.Stop(context.Background()) })
+
+	return d
+}
+
+// events only go to the webhooks of the snippet's owner, and an event about a
+// snippet with no owner isn't looked up at all.
+func TestPublishToOwner(t *testing.T) {
+	s := newStore("https://example.com/hook")
+	d := newDispatcher(t, s, Config{})
+
+	d.Publish(0, models.EventSnippetCreated, nil)
+	d.Publish(2, models.EventSnippetCreated, nil)
+
+	select {
+	case userID := <-s.lookups:
+		if userID != 2 {
+			t.Errorf("looked up subscribers for user %d, want 2", userID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the subscriber lookup")
+	}
+
+	select {
+	case userID := <-s.lookups:
+		t.Errorf("looked up subscribers for user %d, want no other lookups", userID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDeliverySigned(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	received := make(chan request, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- request{r.Header, body}
+		io.WriteString(w, "thanks, here is something private")
+	}))
+	defer srv.Close()
+
+	s := newStore(srv.URL)
+	d := newDispatcher(t, s, Config{Client: srv.Client()})
+
+	d.Publish(1, models.EventSnippetCreated, map[string]int{"id": 7})
+
+	deliveries := s.wait(t, 1)
+	req := <-received
+
+	if err := Verify("s3cret", req.body, req.header.Get(SignatureHeader)); err != nil {
+		t.Errorf("signature doesn't verify: %v", err)
+	}
+	if err := Verify("wrong", req.body, req.header.Get(SignatureHeader)); err == nil {
+		t.Error("signature verifies with the wrong secret")
+	}
+	if got := req.header.Get(EventHeader); got != models.EventSnippetCreated {
+		t.Errorf("got event header %q, want %q", got, models.EventSnippetCreated)
+	}
+	if !strings.Contains(string(req.body), `"data":{"id":7}`) {
+		t.Errorf("got body %s", req.body)
+	}
+
+	got := deliveries[0]
+	if got.StatusCode != http.StatusOK || got.Response != "200 OK" || got.Error != "" || got.Attempt != 1 {
+		t.Errorf("got delivery %+v", got)
+	}
+}
+
+func TestDeliveryRetried(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		n := len(times)
+		mu.Unlock()
+
+		// fail the first two attempts.
+		if n < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}))
+	defer srv.Close()
+
+	backoff := 20 * time.Millisecond
+
+	s := newStore(srv.URL)
+	d := newDispatcher(t, s, Config{Client: srv.Client(), Backoff: backoff, MaxAttempts: 5})
+
+	d.Publish(1, models.EventSnippetCreated, nil)
+
+	deliveries := s.wait(t, 3)
+
+	for i, want := range []int{503, 503, 200} {
+		got := deliveries[i]
+		if got.Attempt != i+1 || got.StatusCode != want || (got.Error == "") != (want == 200) {
+			t.Errorf("delivery %d: got %+v, want status %d", i, got, want)
+		}
+	}
+
+	// the wait doubles after every failed attempt.
+	mu.Lock()
+	defer mu.Unlock()
+	for i, want := range []time.Duration{backoff, 2 * backoff} {
+		if gap := times[i+1].Sub(times[i]); gap < want {
+			t.Errorf("retry %d came after %s, want at least %s", i+1, gap, want)
+		}
+	}
+
+	// a success isn't retried.
+	select {
+	case <-s.logged:
+		t.Error("got a delivery after the successful one")
+	case <-time.After(8 * backoff):
+	}
+}
+
+func TestDeliveryGivesUp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	s := newStore(srv.URL)
+	d := newDispatcher(t, s, Config{Client: srv.Client(), Backoff: time.Millisecond, MaxAttempts: 2})
+
+	d.Publish(1, models.EventSnippetCreated, nil)
+
+	deliveries := s.wait(t, 2)
+	if deliveries[1].Attempt != 2 || deliveries[1].Response != "500 Internal Server Error" {
+		t.Errorf("got delivery %+v", deliveries[1])
+	}
+
+	select {
+	case <-s.logged:
+		t.Error("got a third attempt with MaxAttempts 2")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDeliveryRefusesInternalAddresses(t *testing.T) {
+	hit := make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit <- struct{}{}
+	}))
+	defer srv.Close()
+
+	// the default client, the test server is on 127.0.0.1.
+	s := newStore(srv.URL)
+	d := newDispatcher(t, s, Config{MaxAttempts: 1})
+
+	d.Publish(1, models.EventSnippetCreated, nil)
+
+	got := s.wait(t, 1)[0]
+	if !strings.Contains(got.Error, ErrForbiddenAddress.Error()) || got.StatusCode != 0 {
+		t.Errorf("got delivery %+v, want it refused", got)
+	}
+
+	select {
+	case <-hit:
+		t.Error("the receiver got the delivery")
+	default:
+	}
+}
+
+func TestDeliveryDoesNotFollowRedirects(t *testing.T) {
+	followed := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			followed <- struct{}{}
+			return
+		}
+		http.Redirect(w, r, "/internal", http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	// the default client's redirect handling, but allowed to reach the test
+	// server.
+	client := newClient()
+	client.Transport = srv.Client().Transport
+
+	s := newStore(srv.URL)
+	d := newDispatcher(t, s, Config{Client: client, MaxAttempts: 1})
+
+	d.Publish(1, models.EventSnippetCreated, nil)
+
+	got := s.wait(t, 1)[0]
+	if got.StatusCode != http.StatusTemporaryRedirect || got.Error == "" {
+		t.Errorf("got delivery %+v, want a failed 307", got)
+	}
+
+	select {
+	case <-followed:
+		t.Error("the redirect was followed")
+	default:
+	}
+}
+
+func TestCheckAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.100.100.200", false},
+		{"fd00:ec2::254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+	}
+
+	for _, tt := range tests {
+		err := checkAddr(netip.MustParseAddr(tt.addr))
+		if (err == nil) != tt.allowed {
+			t.Errorf("checkAddr(%s) got %v, want allowed %t", tt.addr, err, tt.allowed)
+		}
+		if err != nil && !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("checkAddr(%s) got %v, want ErrForbiddenAddress", tt.addr, err)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://example.com/hook", true},
+		{"http://93.184.216.34:8080/hook", true},
+		{"http://localhost:8080/hook", false},
+		{"http://LOCALHOST./hook", false},
+		{"http://api.localhost/hook", false},
+		{"http://127.0.0.1/hook", false},
+		{"http://[::1]:9000/hook", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://192.168.0.10/hook", false},
+	}
+
+	for _, tt := range tests {
+		err := CheckURL(tt.url)
+		if (err == nil) != tt.allowed {
+			t.Errorf("CheckURL(%q) got %v, want allowed %t", tt.url, err, tt.allowed)
+		}
+	}
+}
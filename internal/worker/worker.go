@@ -0,0 +1,22 @@
+// Package worker holds helpers for the goroutines that run in the background,
+// outside of any request.
+package worker
+
+import (
+	"log/slog"
+)
+
+// Recover() logs a panic in a background goroutine instead of letting it crash
+// the whole server. It has to be deferred directly, at the top of the
+// function doing the work:
+//
+//	defer worker.Recover(logger, "view counter flush")
+//
+// NOTE: recoverFromPanic() in cmd/web only covers the goroutine serving a
+// request, so every goroutine started outside of one needs this. args are
+// added to the log entry, e.g. the id of the job that panicked.
+func Recover(logger *slog.Logger, name string, args ...any) {
+	if err := recover(); err != nil {
+		logger.Error(name+" panicked", append([]any{"error", err}, args...)...)
+	}
+}
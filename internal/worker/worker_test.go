@@ -0,0 +1,24 @@
+package worker
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	func() {
+		defer Recover(logger, "test job", "job_id", 7)
+		panic("boom")
+	}()
+
+	for _, want := range []string{`msg="test job panicked"`, "error=boom", "job_id=7"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log %q doesn't contain %q", buf.String(), want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+-- Sample snippets for development. Run it once the migrations are applied:
+--
+--   docker compose exec -T postgres psql -U postgres snippetbox < seed.sql
+
+INSERT INTO snippets (title, content, created, updated, expires) VALUES (
+    'An old silent pond',
+    E'An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.\n\n– Matsuo Bashō',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC' + INTERVAL '365 days'
+);
+
+INSERT INTO snippets (title, content, created, updated, expires) VALUES (
+    'Over the wintry forest',
+    E'Over the wintry\nforest, winds howl in rage\nwith no leaves to blow.\n\n– Natsume Soseki',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC' + INTERVAL '365 days'
+);
+
+INSERT INTO snippets (title, content, created, updated, expires) VALUES (
+    'First autumn morning',
+    E'First autumn morning\nthe mirror I stare into\nshows my father''s face.\n\n– Murakami Kijo',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC' + INTERVAL '7 days'
+);
+
+-- Save the dummy records as their first revision.
+INSERT INTO snippet_revisions (snippet_id, revision, title, content, content_type, created)
+SELECT id, revision, title, content, content_type, created FROM snippets;
@@ -0,0 +1,10 @@
+// Package ui holds the HTML templates and static files, embedded so the
+// binary works from any directory.
+package ui
+
+import "embed"
+
+// Files holds the html and static directories.
+//
+//go:embed "html" "static"
+var Files embed.FS
@@ -5,4 +5,69 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// Live updates. The server pushes new snippets and view/star counts over the
+// /events stream, elements marked with data-views/data-stars hold the counts
+// for the snippet id in the attribute.
+function setCounts(attribute, update) {
+	var elements = document.querySelectorAll("[" + attribute + "='" + update.id + "']");
+	for (var i = 0; i < elements.length; i++) {
+		elements[i].textContent = update.count;
+	}
+}
+
+function addSnippet(table, snippet) {
+	var row = document.createElement("tr");
+
+	var title = document.createElement("td");
+	var link = document.createElement("a");
+	link.href = "/snippet/view/" + snippet.id;
+	link.textContent = snippet.title;
+	title.appendChild(link);
+
+	var created = document.createElement("td");
+	created.textContent = snippet.created;
+
+	var views = document.createElement("td");
+	views.setAttribute("data-views", snippet.id);
+	views.textContent = snippet.views;
+
+	var id = document.createElement("td");
+	id.textContent = "#" + snippet.id;
+
+	row.appendChild(title);
+	row.appendChild(created);
+	row.appendChild(views);
+	row.appendChild(id);
+
+	// the first row is the header.
+	var rows = table.querySelectorAll("tr");
+	rows[0].parentNode.insertBefore(row, rows[1] || null);
+
+	// keep the page the same size, the snippet pushed off the end is on the
+	// next page now.
+	var limit = parseInt(table.getAttribute("data-live-new"), 10);
+	if (rows.length > limit) {
+		rows[rows.length - 1].remove();
+	}
+}
+
+if (window.EventSource && document.body.hasAttribute("data-live") && document.querySelector("[data-views], [data-stars], [data-live-new]")) {
+	var events = new EventSource("/events");
+
+	events.addEventListener("views", function (e) {
+		setCounts("data-views", JSON.parse(e.data));
+	});
+
+	events.addEventListener("stars", function (e) {
+		setCounts("data-stars", JSON.parse(e.data));
+	});
+
+	events.addEventListener("snippet", function (e) {
+		var table = document.querySelector("table[data-live-new]");
+		if (table) {
+			addSnippet(table, JSON.parse(e.data));
+		}
+	});
+}